@@ -12,10 +12,38 @@ import (
 	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/auth"
 	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/booking"
 	clients_handler "github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/clients"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/companies"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/currency"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/deposits"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/folio"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/groups"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/holds"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/icalsync"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/invoices"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/nightaudit"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/notifications"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/overbooking"
+	payments_handler "github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/payments"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/promo"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/property"
 	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/rooms"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/shifts"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/stayhours"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/taxes"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/vouchers"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers/waitlist"
 	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/middleware"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/payments"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/scheduler"
 	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/server"
 	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	db_booking "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/booking"
+	db_holds "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/holds"
+	db_idempotency "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/idempotency"
+	db_nightaudit "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/nightaudit"
+	db_waitlist "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/waitlist"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
@@ -32,6 +60,32 @@ func main() {
 	}
 	var databaseClient storage.DatabaseClient
 
+	var holdsConfig config.HoldsConfig
+	if err := holdsConfig.ReadConfig(); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	var idempotencyConfig config.IdempotencyConfig
+	if err := idempotencyConfig.ReadConfig(); err != nil {
+		log.Fatal(err.Error())
+	}
+	idempotencyTTL := time.Duration(idempotencyConfig.TTLHours) * time.Hour
+
+	var nightAuditConfig config.NightAuditConfig
+	if err := nightAuditConfig.ReadConfig(); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	var paymentsConfig config.PaymentsConfig
+	if err := paymentsConfig.ReadConfig(); err != nil {
+		log.Fatal(err.Error())
+	}
+	refundThreshold := money.Units(paymentsConfig.RefundApprovalThreshold)
+	paymentProvider, err := payments.New(paymentsConfig.Provider, paymentsConfig.WebhookSecret)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
 	startupLog, err := logger.New("System Startup", "main.go", nil)
 	if err != nil {
 		log.Fatal(err.Error())
@@ -54,12 +108,44 @@ func main() {
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173", "https://localhost:5173", "http://127.0.0.1:5173"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With"},
-		ExposeHeaders:    []string{"Content-Length", "Content-Type"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", middleware.IdempotencyHeader},
+		ExposeHeaders:    []string{"Content-Length", "Content-Type", middleware.ReplayedHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
+	// Повтор запроса к этим маршрутам не должен создать вторую запись или провести деньги дважды
+	router.Use(middleware.Idempotency(pool, idempotencyTTL,
+		"/booking/book",
+		"/clients/add-client",
+		"/companies/create-company",
+		"/deposits/create-policy",
+		"/folio/create-folio",
+		"/folio/post-adjustment",
+		"/folio/post-charge",
+		"/folio/post-payment",
+		"/folio/post-refund",
+		"/folio/transfer-charge",
+		"/groups/add-booking",
+		"/groups/create-group",
+		"/holds/convert-hold",
+		"/holds/create-hold",
+		"/invoices/credit-note",
+		"/invoices/issue",
+		"/invoices/issue-company",
+		"/payments/authorise",
+		"/payments/capture",
+		"/payments/refund",
+		"/promo/create-code",
+		"/rooms/block-room",
+		"/stay-hours/create-request",
+		"/taxes/create-tax",
+		"/vouchers/issue-voucher",
+		"/vouchers/redeem-voucher",
+		"/waitlist/add-entry",
+		"/waitlist/book-entry",
+	))
+
 	//var __master_user_init__ users.Users
 	//if err := __master_user_init__.Test(pool); err != nil {
 	//	log.Fatal(err.Error())
@@ -78,6 +164,97 @@ func main() {
 	bookingHandler := booking.NewHandler(pool)
 	bookingHandler.InitHandler(router)
 
+	groupHandler := groups.NewHandler(pool, startupLog)
+	groupHandler.InitHandler(router)
+
+	holdHandler := holds.NewHandler(pool, startupLog, time.Duration(holdsConfig.TTLMinutes)*time.Minute)
+	holdHandler.InitHandler(router)
+
+	waitlistHandler := waitlist.NewHandler(pool, startupLog)
+	waitlistHandler.InitHandler(router)
+
+	notificationHandler := notifications.NewHandler(pool, startupLog)
+	notificationHandler.InitHandler(router)
+
+	overbookingHandler := overbooking.NewHandler(pool, startupLog)
+	overbookingHandler.InitHandler(router)
+
+	icalHandler := icalsync.NewHandler(pool, startupLog)
+	icalHandler.InitHandler(router)
+
+	propertyHandler := property.NewHandler(pool, startupLog)
+	propertyHandler.InitHandler(router)
+
+	folioHandler := folio.NewHandler(pool, startupLog, refundThreshold)
+	folioHandler.InitHandler(router)
+
+	nightAuditHandler := nightaudit.NewHandler(pool, startupLog)
+	nightAuditHandler.InitHandler(router)
+
+	stayHoursHandler := stayhours.NewHandler(pool, startupLog)
+	stayHoursHandler.InitHandler(router)
+
+	invoiceHandler := invoices.NewHandler(pool, startupLog)
+	invoiceHandler.InitHandler(router)
+
+	paymentHandler := payments_handler.NewHandler(pool, startupLog, paymentProvider, refundThreshold)
+	paymentHandler.InitHandler(router)
+
+	taxHandler := taxes.NewHandler(pool, startupLog)
+	taxHandler.InitHandler(router)
+
+	currencyHandler := currency.NewHandler(pool, startupLog)
+	currencyHandler.InitHandler(router)
+
+	promoHandler := promo.NewHandler(pool, startupLog)
+	promoHandler.InitHandler(router)
+
+	companyHandler := companies.NewHandler(pool, startupLog)
+	companyHandler.InitHandler(router)
+
+	voucherHandler := vouchers.NewHandler(pool, startupLog)
+	voucherHandler.InitHandler(router)
+
+	shiftHandler := shifts.NewHandler(pool, startupLog)
+	shiftHandler.InitHandler(router)
+
+	depositHandler := deposits.NewHandler(pool, startupLog)
+	depositHandler.InitHandler(router)
+
+	// Background jobs
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	scheduler.Every(jobsCtx, "Holds Sweeper", time.Duration(holdsConfig.SweepInterval)*time.Second,
+		func(ctx context.Context) error {
+			return db_holds.ExpireHolds(ctx, pool)
+		})
+
+	// Отмены, переносы и истёкшие удержания освобождают номера для листа ожидания
+	scheduler.Every(jobsCtx, "Waitlist Matcher", time.Minute,
+		func(ctx context.Context) error {
+			return db_waitlist.MatchFreedInventory(ctx, pool)
+		})
+
+	scheduler.Every(jobsCtx, "Idempotency Keys Cleanup", time.Hour,
+		func(ctx context.Context) error {
+			return db_idempotency.DeleteExpired(ctx, pool, idempotencyTTL)
+		})
+
+	// Подтверждает оплаченные предварительные брони и отменяет неоплаченные после льготного срока
+	scheduler.Every(jobsCtx, "Deposits Sweeper", time.Hour,
+		func(ctx context.Context) error {
+			return db_booking.ProcessDeposits(ctx, pool)
+		})
+
+	// Закрывает все прошедшие операционные дни, если аудит не провели вручную
+	if err := scheduler.Daily(jobsCtx, "Night Audit", nightAuditConfig.RunAt,
+		func(ctx context.Context) error {
+			return db_nightaudit.CatchUp(ctx, pool)
+		}); err != nil {
+		log.Fatal(err.Error())
+	}
+
 	initingServer := &server.Server{}
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"log"
 
 	"github.com/ilyakaznacheev/cleanenv"
@@ -38,3 +39,80 @@ func (c *StorageConfig) ReadConfig() error {
 
 	return nil
 }
+
+// Настройки временных удержаний номеров
+type HoldsConfig struct {
+	TTLMinutes    int `env:"HOLD_TTL_MINUTES" env-default:"15"`
+	SweepInterval int `env:"HOLD_SWEEP_INTERVAL_SECONDS" env-default:"60"`
+}
+
+func (h *HoldsConfig) ReadConfig() error {
+	err := cleanenv.ReadConfig(".env", h)
+	if err != nil {
+		log.Printf("Ошибка при чтении файла с конфигом: %s", err)
+		return err
+	}
+
+	if h.TTLMinutes <= 0 || h.SweepInterval <= 0 {
+		return errors.New("HOLD_TTL_MINUTES and HOLD_SWEEP_INTERVAL_SECONDS must be positive")
+	}
+
+	return nil
+}
+
+type IdempotencyConfig struct {
+	TTLHours int `env:"IDEMPOTENCY_KEY_TTL_HOURS" env-default:"24"`
+}
+
+func (i *IdempotencyConfig) ReadConfig() error {
+	err := cleanenv.ReadConfig(".env", i)
+	if err != nil {
+		log.Printf("Ошибка при чтении файла с конфигом: %s", err)
+		return err
+	}
+
+	// Ключи с нулевым сроком удалялись бы сразу, и повторы запросов не распознавались бы
+	if i.TTLHours <= 0 {
+		return errors.New("IDEMPOTENCY_KEY_TTL_HOURS must be positive")
+	}
+
+	return nil
+}
+
+// Время ежедневного запуска ночного аудита
+type NightAuditConfig struct {
+	RunAt string `env:"NIGHT_AUDIT_TIME" env-default:"03:00"`
+}
+
+func (n *NightAuditConfig) ReadConfig() error {
+	err := cleanenv.ReadConfig(".env", n)
+	if err != nil {
+		log.Printf("Ошибка при чтении файла с конфигом: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+// Платёжный провайдер и секрет подписи его уведомлений.
+// Возвраты больше порога (в единицах базовой валюты) требуют одобрения менеджера
+type PaymentsConfig struct {
+	Provider                string `env:"PAYMENT_PROVIDER" env-default:"fake"`
+	WebhookSecret           string `env:"PAYMENT_WEBHOOK_SECRET"`
+	RefundApprovalThreshold int64  `env:"REFUND_APPROVAL_THRESHOLD" env-default:"5000"`
+}
+
+func (p *PaymentsConfig) ReadConfig() error {
+	err := cleanenv.ReadConfig(".env", p)
+	if err != nil {
+		log.Printf("Ошибка при чтении файла с конфигом: %s", err)
+		return err
+	}
+
+	// С пустым секретом подпись уведомлений может подделать кто угодно
+	if p.WebhookSecret == "" {
+		return errors.New("PAYMENT_WEBHOOK_SECRET must be set")
+	}
+
+	return nil
+}
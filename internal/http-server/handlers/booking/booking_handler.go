@@ -3,7 +3,9 @@ package booking
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers"
 	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
 	db_booking "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/booking"
 	"github.com/gin-gonic/gin"
@@ -21,6 +23,14 @@ type HandlerBooking struct {
 func (h *HandlerBooking) InitHandler(router *gin.Engine) {
 	router.POST("/booking/book", h.CreateBook)
 	router.GET("/booking/book-list", h.GetBooks)
+	router.PUT("/booking/edit-book", h.EditBook)
+	router.POST("/booking/cancel-book", h.CancelBook)
+	router.GET("/booking/available-rooms", h.GetAvailableRooms)
+	router.GET("/booking/find-by-confirmation", h.FindByConfirmation)
+	router.POST("/booking/check-in", h.CheckIn)
+	router.POST("/booking/check-out", h.CheckOut)
+	router.POST("/booking/move-room", h.MoveRoom)
+	router.GET("/booking/room-moves", h.GetRoomMoves)
 }
 
 func (h *HandlerBooking) CreateBook(c *gin.Context) {
@@ -29,6 +39,7 @@ func (h *HandlerBooking) CreateBook(c *gin.Context) {
 	if err := c.ShouldBindJSON(&booking); err != nil {
 		fmt.Println(err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{"response": data.WrongData})
+		return
 	}
 
 	if err := booking.Create(h.db); err != nil {
@@ -36,7 +47,7 @@ func (h *HandlerBooking) CreateBook(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"response": "done"})
+	c.JSON(http.StatusCreated, gin.H{"response": booking})
 }
 
 func (h *HandlerBooking) GetBooks(c *gin.Context) {
@@ -51,3 +62,161 @@ func (h *HandlerBooking) GetBooks(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"response": result})
 }
+
+func (h *HandlerBooking) EditBook(c *gin.Context) {
+	var booking db_booking.Bookings
+
+	if err := c.ShouldBindJSON(&booking); err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"response": data.WrongData})
+		return
+	}
+
+	if err := booking.Edit(h.db); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"response": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": "done"})
+}
+
+func (h *HandlerBooking) CancelBook(c *gin.Context) {
+	var booking db_booking.Bookings
+
+	if err := c.ShouldBindJSON(&booking); err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"response": data.WrongData})
+		return
+	}
+
+	if err := booking.Cancel(h.db); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"response": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": "done"})
+}
+
+func (h *HandlerBooking) GetAvailableRooms(c *gin.Context) {
+	checkin, err := handlers.ParseDate(c.Query("check_in"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"response": data.WrongData})
+		return
+	}
+	checkout, err := handlers.ParseDate(c.Query("check_out"))
+	if err != nil || !checkout.Time.After(checkin.Time) {
+		c.JSON(http.StatusBadRequest, gin.H{"response": data.WrongDates})
+		return
+	}
+
+	guests, _ := strconv.Atoi(c.DefaultQuery("guests", "0"))
+
+	rooms, err := db_booking.SearchAvailability(c.Request.Context(), h.db, c.Query("room_type"), guests, checkin, checkout, c.Query("currency"), c.Query("promo_code"))
+	if err != nil {
+		fmt.Println(err.Error())
+		if err.Error() == data.WrongCurrency || err.Error() == data.RateNotFound {
+			c.JSON(http.StatusBadRequest, gin.H{"response": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"response": data.InternalError})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": rooms})
+}
+
+func (h *HandlerBooking) FindByConfirmation(c *gin.Context) {
+	booking, err := db_booking.FindByConfirmation(h.db, c.Query("code"), c.Query("surname"))
+	if err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"response": data.BookingNotFound})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": booking})
+}
+
+func (h *HandlerBooking) CheckIn(c *gin.Context) {
+	var booking db_booking.Bookings
+
+	if err := c.ShouldBindJSON(&booking); err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"response": data.WrongData})
+		return
+	}
+
+	if err := booking.CheckIn(h.db); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"response": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": "done"})
+}
+
+// Токен менеджера нужен только для выезда с непогашенным балансом
+type checkOutRequest struct {
+	Id           int    `json:"id"`
+	ManagerToken string `json:"manager_token"`
+}
+
+func (h *HandlerBooking) CheckOut(c *gin.Context) {
+	var request checkOutRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"response": data.WrongData})
+		return
+	}
+
+	var overrideBy string
+	if request.ManagerToken != "" {
+		manager, ok := handlers.ManagerFromToken(request.ManagerToken)
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"response": data.NotManager})
+			return
+		}
+		overrideBy = manager
+	}
+
+	booking := db_booking.Bookings{Id: request.Id}
+	if err := booking.CheckOut(h.db, overrideBy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"response": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": "done"})
+}
+
+func (h *HandlerBooking) MoveRoom(c *gin.Context) {
+	var move db_booking.RoomMoves
+
+	if err := c.ShouldBindJSON(&move); err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"response": data.WrongData})
+		return
+	}
+
+	if err := move.Move(h.db); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"response": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": move})
+}
+
+func (h *HandlerBooking) GetRoomMoves(c *gin.Context) {
+	bookingId, err := strconv.Atoi(c.Query("booking_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"response": data.WrongData})
+		return
+	}
+
+	moves, err := db_booking.GetMoves(h.db, bookingId)
+	if err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"response": data.InternalError})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": moves})
+}
@@ -2,7 +2,10 @@ package clients_handler
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers"
 	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
 	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
 	db_clients "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/clients"
@@ -28,23 +31,39 @@ func (h *Handler) InitHandler(router *gin.Engine) {
 	router.POST("/clients/add-client", h.AddClient)
 	router.PUT("/clients/edit-client", h.EditClient)
 	router.GET("/clients/get-clients-list", h.GetClients)
+	router.GET("/clients/search", h.Search)
+	router.GET("/clients/duplicates", h.Duplicates)
+	router.POST("/clients/merge-clients", h.MergeClients)
+	router.GET("/clients/merge-log", h.MergeLog)
 }
 
+// force - добавить клиента, даже если найдены возможные дубли
+type addClientRequest struct {
+	db_clients.Clients
+	Force bool `json:"force"`
+}
+
+// AddClient при возможных дублях отвечает 409 со списком дублей в response
 func (h *Handler) AddClient(c *gin.Context) {
-	var clients db_clients.Clients
+	var request addClientRequest
 
-	if err := c.ShouldBindJSON(&clients); err != nil {
+	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
 		return
 	}
 
-	if err := clients.AddClient(h.db); err != nil {
+	duplicates, err := request.Clients.AddClient(h.db, request.Force)
+	if err != nil {
 		logger.New("error", moduleName, err)
+		if err.Error() == data.ClientDuplicate {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "response": duplicates})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"response": "done"})
+	c.JSON(http.StatusOK, gin.H{"response": request.Clients})
 }
 
 func (h *Handler) EditClient(c *gin.Context) {
@@ -75,3 +94,126 @@ func (h *Handler) GetClients(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"response": clientsArr})
 }
+
+// Search - поиск клиентов постранично: q, created_from, created_to (2006-01-02),
+// tags (через запятую), sort (relevance, name, created_at), order (asc, desc), limit, cursor
+func (h *Handler) Search(c *gin.Context) {
+	params := db_clients.SearchParams{
+		Query:  c.Query("q"),
+		Sort:   c.Query("sort"),
+		Cursor: c.Query("cursor"),
+	}
+
+	var err error
+	if value := c.Query("created_from"); value != "" {
+		if params.CreatedFrom, err = handlers.ParseDate(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+			return
+		}
+	}
+	if value := c.Query("created_to"); value != "" {
+		if params.CreatedTo, err = handlers.ParseDate(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+			return
+		}
+	}
+	if value := c.Query("tags"); value != "" {
+		params.Tags = strings.Split(value, ",")
+	}
+	if value := c.Query("limit"); value != "" {
+		if params.Limit, err = strconv.Atoi(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+			return
+		}
+	}
+
+	// Без order: по убыванию релевантности и даты создания, имя - по возрастанию
+	switch c.Query("order") {
+	case "":
+		params.Desc = params.Sort != db_clients.SortName
+	case "asc":
+	case "desc":
+		params.Desc = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	result, err := db_clients.Search(h.db, params)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		if err.Error() == data.WrongData || err.Error() == data.WrongCursor {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": result})
+}
+
+// Duplicates - отчёт о возможных дублях клиентов (limit пар, по умолчанию 100)
+func (h *Handler) Duplicates(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	pairs, err := db_clients.DuplicatesReport(h.db, limit)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": pairs})
+}
+
+// MergeClients объединяет карточки в одну; в журнале сохраняется, кто объединил
+func (h *Handler) MergeClients(c *gin.Context) {
+	var request db_clients.MergeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	username, ok := handlers.UserFromRequest(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": data.NotAuthorised})
+		return
+	}
+	request.MergedBy = username
+
+	merges, err := request.Merge(h.db)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		if err.Error() == data.ClientNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": merges})
+}
+
+// MergeLog - журнал объединений, client_id не обязателен
+func (h *Handler) MergeLog(c *gin.Context) {
+	clientId, err := strconv.Atoi(c.DefaultQuery("client_id", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	merges, err := db_clients.GetMerges(h.db, clientId)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": merges})
+}
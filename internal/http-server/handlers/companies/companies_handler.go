@@ -0,0 +1,130 @@
+package companies
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_companies "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/companies"
+	db_folio "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/folio"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const moduleName = "CompaniesModule"
+
+func NewHandler(db *pgxpool.Pool, logger *logger.Logger) *Handler {
+	return &Handler{db: db, logger: logger}
+}
+
+type Handler struct {
+	db     *pgxpool.Pool
+	logger *logger.Logger
+}
+
+func (h *Handler) InitHandler(router *gin.Engine) {
+	router.POST("/companies/create-company", h.CreateCompany)
+	router.PUT("/companies/edit-company", h.EditCompany)
+	router.GET("/companies/get-list", h.GetList)
+	router.GET("/companies/get-company", h.GetCompany)
+	router.GET("/companies/get-folios", h.GetFolios)
+	router.GET("/companies/city-ledger", h.CityLedger)
+}
+
+func (h *Handler) CreateCompany(c *gin.Context) {
+	var company db_companies.Companies
+	if err := c.ShouldBindJSON(&company); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := company.Create(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"response": company})
+}
+
+func (h *Handler) EditCompany(c *gin.Context) {
+	var company db_companies.Companies
+	if err := c.ShouldBindJSON(&company); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := company.Edit(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		if err.Error() == data.CompanyNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": company})
+}
+
+func (h *Handler) GetList(c *gin.Context) {
+	companies, err := db_companies.GetList(h.db)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": companies})
+}
+
+func (h *Handler) GetCompany(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	company, err := db_companies.GetByID(h.db, id)
+	if err != nil {
+		if err.Error() == data.CompanyNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": company})
+}
+
+// GetFolios - счета компании по всем броням (city ledger по компании)
+func (h *Handler) GetFolios(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	folios, err := db_folio.GetByCompany(h.db, id)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": folios})
+}
+
+func (h *Handler) CityLedger(c *gin.Context) {
+	ledger, err := db_companies.CityLedger(h.db)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": ledger})
+}
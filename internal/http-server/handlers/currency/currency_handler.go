@@ -0,0 +1,91 @@
+package currency
+
+import (
+	"net/http"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_currency "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/currency"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const moduleName = "CurrencyModule"
+
+func NewHandler(db *pgxpool.Pool, logger *logger.Logger) *Handler {
+	return &Handler{db: db, logger: logger}
+}
+
+type Handler struct {
+	db     *pgxpool.Pool
+	logger *logger.Logger
+}
+
+func (h *Handler) InitHandler(router *gin.Engine) {
+	router.PUT("/currency/set-rate", h.SetRate)
+	router.POST("/currency/delete-rate", h.DeleteRate)
+	router.GET("/currency/get-rates", h.GetRates)
+	router.GET("/currency/convert", h.Convert)
+}
+
+func (h *Handler) SetRate(c *gin.Context) {
+	var rate db_currency.ExchangeRates
+	if err := c.ShouldBindJSON(&rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := rate.Set(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": rate})
+}
+
+func (h *Handler) DeleteRate(c *gin.Context) {
+	var rate db_currency.ExchangeRates
+	if err := c.ShouldBindJSON(&rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := rate.Delete(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": "done"})
+}
+
+func (h *Handler) GetRates(c *gin.Context) {
+	rates, err := db_currency.GetRates(h.db)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": rates})
+}
+
+// Convert пересчитывает сумму: ?amount=100&from=USD&to=EUR
+func (h *Handler) Convert(c *gin.Context) {
+	amount, err := money.Parse(c.Query("amount"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	result, err := db_currency.Convert(h.db, amount, c.Query("from"), c.Query("to"))
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": result})
+}
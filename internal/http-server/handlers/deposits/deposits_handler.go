@@ -0,0 +1,161 @@
+package deposits
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_booking "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/booking"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const moduleName = "DepositsModule"
+
+func NewHandler(db *pgxpool.Pool, logger *logger.Logger) *Handler {
+	return &Handler{db: db, logger: logger}
+}
+
+type Handler struct {
+	db     *pgxpool.Pool
+	logger *logger.Logger
+}
+
+func (h *Handler) InitHandler(router *gin.Engine) {
+	router.POST("/deposits/create-policy", h.CreatePolicy)
+	router.PUT("/deposits/edit-policy", h.EditPolicy)
+	router.GET("/deposits/get-policies", h.GetPolicies)
+	router.GET("/deposits/get-schedule", h.GetSchedule)
+	router.PUT("/deposits/set-schedule", h.SetSchedule)
+	router.GET("/deposits/overdue", h.Overdue)
+	router.POST("/deposits/confirm-booking", h.ConfirmBooking)
+}
+
+type scheduleRequest struct {
+	BookingId int                   `json:"booking_id"`
+	Deposits  []db_booking.Deposits `json:"deposits"`
+}
+
+func (h *Handler) CreatePolicy(c *gin.Context) {
+	var policy db_booking.DepositPolicies
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := policy.Create(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"response": policy})
+}
+
+func (h *Handler) EditPolicy(c *gin.Context) {
+	var policy db_booking.DepositPolicies
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := policy.Edit(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		if err.Error() == data.PolicyNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": policy})
+}
+
+func (h *Handler) GetPolicies(c *gin.Context) {
+	list, err := db_booking.GetDepositPolicies(h.db)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": list})
+}
+
+func (h *Handler) GetSchedule(c *gin.Context) {
+	bookingId, err := strconv.Atoi(c.Query("booking_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	schedule, err := db_booking.GetDeposits(h.db, bookingId)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": schedule})
+}
+
+// SetSchedule задаёт график вручную; правила тарифа к брони больше не применяются
+func (h *Handler) SetSchedule(c *gin.Context) {
+	var request scheduleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := db_booking.SetDeposits(h.db, request.BookingId, request.Deposits); err != nil {
+		logger.New("error", moduleName, err)
+		if err.Error() == data.BookingNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedule, err := db_booking.GetDeposits(h.db, request.BookingId)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": schedule})
+}
+
+func (h *Handler) Overdue(c *gin.Context) {
+	list, err := db_booking.GetOverdueDeposits(h.db)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": list})
+}
+
+func (h *Handler) ConfirmBooking(c *gin.Context) {
+	var booking db_booking.Bookings
+	if err := c.ShouldBindJSON(&booking); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := booking.Confirm(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		if err.Error() == data.BookingNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": booking})
+}
@@ -0,0 +1,160 @@
+package folio
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_folio "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/folio"
+	db_payments "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/payments"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const moduleName = "FolioModule"
+
+// refundThreshold - сумма в базовой валюте, выше которой возврат требует одобрения менеджера
+func NewHandler(db *pgxpool.Pool, logger *logger.Logger, refundThreshold money.Decimal) *Handler {
+	return &Handler{db: db, logger: logger, refundThreshold: refundThreshold}
+}
+
+type Handler struct {
+	db              *pgxpool.Pool
+	logger          *logger.Logger
+	refundThreshold money.Decimal
+}
+
+// Ручной возврат по счёту (наличными и т.п.); причина обязательна
+type refundRequest struct {
+	FolioId int           `json:"folio_id"`
+	Amount  money.Decimal `json:"amount"`
+	Method  string        `json:"method"`
+	Reason  string        `json:"reason"`
+}
+
+func (h *Handler) InitHandler(router *gin.Engine) {
+	router.GET("/folio/get-folio", h.GetFolio)
+	router.GET("/folio/get-folios", h.GetFolios)
+	router.POST("/folio/create-folio", h.CreateFolio)
+	router.POST("/folio/post-charge", h.post(db_folio.EntryCharge))
+	router.POST("/folio/post-payment", h.post(db_folio.EntryPayment))
+	router.POST("/folio/post-refund", h.PostRefund)
+	router.POST("/folio/post-adjustment", h.post(db_folio.EntryAdjustment))
+	router.POST("/folio/transfer-charge", h.TransferCharge)
+}
+
+func (h *Handler) GetFolio(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	folio, err := db_folio.GetByID(h.db, id)
+	if err != nil {
+		if err.Error() == data.FolioNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": folio})
+}
+
+func (h *Handler) GetFolios(c *gin.Context) {
+	bookingId, err := strconv.Atoi(c.Query("booking_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	folios, err := db_folio.GetByBooking(h.db, bookingId)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": folios})
+}
+
+func (h *Handler) CreateFolio(c *gin.Context) {
+	var folio db_folio.Folios
+	if err := c.ShouldBindJSON(&folio); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := folio.Create(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"response": folio})
+}
+
+// Начисления, оплаты, возвраты и корректировки отличаются только видом строки
+func (h *Handler) post(entryType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var charge db_folio.Charges
+		if err := c.ShouldBindJSON(&charge); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+			return
+		}
+		charge.EntryType = entryType
+		charge.ShiftId = nil
+
+		// Оплаты привязываются к открытой смене кассира
+		if entryType == db_folio.EntryPayment {
+			shiftId, ok := handlers.RequireShift(c, h.db)
+			if !ok {
+				return
+			}
+			charge.ShiftId = shiftId
+		}
+
+		if err := charge.Post(h.db); err != nil {
+			logger.New("error", moduleName, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"response": charge})
+	}
+}
+
+// PostRefund оформляет возврат заявкой: до порога он проводится сразу,
+// крупный ждёт одобрения менеджера (/payments/approve-refund)
+func (h *Handler) PostRefund(c *gin.Context) {
+	var request refundRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	refund := db_payments.RefundRequests{FolioId: request.FolioId, Amount: request.Amount, Method: request.Method, Reason: request.Reason}
+	handlers.SubmitRefund(c, h.db, nil, h.refundThreshold, refund, moduleName)
+}
+
+func (h *Handler) TransferCharge(c *gin.Context) {
+	var request db_folio.TransferRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := request.Transfer(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": "done"})
+}
@@ -0,0 +1,167 @@
+package groups
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_booking "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/booking"
+	db_groups "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/groups"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const moduleName = "GroupsModule"
+
+func NewHandler(db *pgxpool.Pool, logger *logger.Logger) *Handler {
+	return &Handler{db: db, logger: logger}
+}
+
+type Handler struct {
+	db     *pgxpool.Pool
+	logger *logger.Logger
+}
+
+func (h *Handler) InitHandler(router *gin.Engine) {
+	router.POST("/groups/create-group", h.CreateGroup)
+	router.PUT("/groups/edit-group", h.EditGroup)
+	router.PUT("/groups/edit-group-dates", h.EditGroupDates)
+	router.POST("/groups/add-booking", h.AddBooking)
+	router.POST("/groups/cancel-group", h.CancelGroup)
+	router.PUT("/groups/rooming-list", h.SetRoomingList)
+	router.GET("/groups/get-group", h.GetGroup)
+	router.GET("/groups/get-groups-list", h.GetGroups)
+}
+
+type addBookingRequest struct {
+	GroupId int                 `json:"group_id"`
+	Booking db_booking.Bookings `json:"booking"`
+}
+
+func (h *Handler) CreateGroup(c *gin.Context) {
+	var group db_groups.Groups
+	if err := c.ShouldBindJSON(&group); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := group.Create(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"response": group})
+}
+
+func (h *Handler) EditGroup(c *gin.Context) {
+	var group db_groups.Groups
+	if err := c.ShouldBindJSON(&group); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := group.Edit(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": "done"})
+}
+
+func (h *Handler) EditGroupDates(c *gin.Context) {
+	var request db_groups.DatesRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := request.ChangeDates(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": "done"})
+}
+
+func (h *Handler) AddBooking(c *gin.Context) {
+	var request addBookingRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	group := db_groups.Groups{Id: request.GroupId}
+	if err := group.AddBooking(h.db, &request.Booking); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"response": request.Booking})
+}
+
+func (h *Handler) CancelGroup(c *gin.Context) {
+	var group db_groups.Groups
+	if err := c.ShouldBindJSON(&group); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := group.Cancel(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": "done"})
+}
+
+func (h *Handler) SetRoomingList(c *gin.Context) {
+	var group db_groups.Groups
+	if err := c.ShouldBindJSON(&group); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := group.SetRoomingList(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": "done"})
+}
+
+func (h *Handler) GetGroup(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	group, err := db_groups.GetGroup(h.db, id)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": group})
+}
+
+func (h *Handler) GetGroups(c *gin.Context) {
+	var group db_groups.Groups
+
+	groups, err := group.GetGroups(h.db)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": groups})
+}
@@ -0,0 +1,99 @@
+package holds
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_booking "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/booking"
+	db_holds "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/holds"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const moduleName = "HoldsModule"
+
+func NewHandler(db *pgxpool.Pool, logger *logger.Logger, ttl time.Duration) *Handler {
+	return &Handler{db: db, logger: logger, ttl: ttl}
+}
+
+type Handler struct {
+	db     *pgxpool.Pool
+	logger *logger.Logger
+	ttl    time.Duration
+}
+
+func (h *Handler) InitHandler(router *gin.Engine) {
+	router.POST("/holds/create-hold", h.CreateHold)
+	router.POST("/holds/release-hold", h.ReleaseHold)
+	router.POST("/holds/convert-hold", h.ConvertHold)
+	router.GET("/holds/get-holds-list", h.GetHolds)
+}
+
+type convertRequest struct {
+	Id      int                 `json:"id"`
+	Booking db_booking.Bookings `json:"booking"`
+}
+
+func (h *Handler) CreateHold(c *gin.Context) {
+	var hold db_holds.Holds
+	if err := c.ShouldBindJSON(&hold); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := hold.Create(h.db, h.ttl); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"response": hold})
+}
+
+func (h *Handler) ReleaseHold(c *gin.Context) {
+	var hold db_holds.Holds
+	if err := c.ShouldBindJSON(&hold); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := hold.Release(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": "done"})
+}
+
+func (h *Handler) ConvertHold(c *gin.Context) {
+	var request convertRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	hold := db_holds.Holds{Id: request.Id}
+	if err := hold.Convert(h.db, &request.Booking); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"response": request.Booking})
+}
+
+func (h *Handler) GetHolds(c *gin.Context) {
+	var hold db_holds.Holds
+
+	holds, err := hold.GetActive(h.db)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": holds})
+}
@@ -0,0 +1,133 @@
+package icalsync
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/ical"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_icalsync "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/icalsync"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const moduleName = "ICalModule"
+
+func NewHandler(db *pgxpool.Pool, logger *logger.Logger) *Handler {
+	return &Handler{db: db, logger: logger}
+}
+
+type Handler struct {
+	db     *pgxpool.Pool
+	logger *logger.Logger
+}
+
+func (h *Handler) InitHandler(router *gin.Engine) {
+	router.GET("/ical/room-feed", h.RoomFeed)
+	router.GET("/ical/room-type-feed", h.RoomTypeFeed)
+	router.POST("/ical/import", h.ImportFile)
+	router.POST("/ical/import-url", h.ImportURL)
+}
+
+func (h *Handler) writeFeed(c *gin.Context, name string, roomId int, roomType string) {
+	events, err := db_icalsync.Export(h.db, roomId, roomType)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": data.InternalError})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := ical.Write(&buf, name, events); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": data.InternalError})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", name+".ics"))
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", buf.Bytes())
+}
+
+func (h *Handler) RoomFeed(c *gin.Context) {
+	roomId, err := strconv.Atoi(c.Query("room_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	h.writeFeed(c, fmt.Sprintf("room-%d", roomId), roomId, "")
+}
+
+func (h *Handler) RoomTypeFeed(c *gin.Context) {
+	roomType := c.Query("room_type")
+	if roomType == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	h.writeFeed(c, "room-type-"+roomType, 0, roomType)
+}
+
+// ImportFile принимает multipart-форму: file, room_id и необязательный client_id
+func (h *Handler) ImportFile(c *gin.Context) {
+	var request db_icalsync.ImportRequest
+	if err := c.ShouldBind(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+	defer file.Close()
+
+	events, err := ical.Parse(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.importEvents(c, &request, events)
+}
+
+func (h *Handler) ImportURL(c *gin.Context) {
+	var request db_icalsync.ImportRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Url == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	events, err := db_icalsync.FetchURL(request.Url)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		if err.Error() == data.ForbiddenURL || err.Error() == data.WrongData {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.importEvents(c, &request, events)
+}
+
+func (h *Handler) importEvents(c *gin.Context, request *db_icalsync.ImportRequest, events []ical.Event) {
+	result, err := request.Import(h.db, events)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": result})
+}
@@ -0,0 +1,180 @@
+package invoices
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/invoice"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_invoices "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/invoices"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const moduleName = "InvoicesModule"
+
+func NewHandler(db *pgxpool.Pool, logger *logger.Logger) *Handler {
+	return &Handler{db: db, logger: logger}
+}
+
+type Handler struct {
+	db     *pgxpool.Pool
+	logger *logger.Logger
+}
+
+func (h *Handler) InitHandler(router *gin.Engine) {
+	router.POST("/invoices/issue", h.Issue)
+	router.POST("/invoices/issue-company", h.IssueCompany)
+	router.POST("/invoices/credit-note", h.CreditNote)
+	router.GET("/invoices/get-invoice", h.GetInvoice)
+	router.GET("/invoices/get-list", h.GetList)
+	router.GET("/invoices/render-html", h.RenderHTML)
+	router.GET("/invoices/render-pdf", h.RenderPDF)
+}
+
+func (h *Handler) Issue(c *gin.Context) {
+	var inv db_invoices.Invoices
+	if err := c.ShouldBindJSON(&inv); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := inv.Issue(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"response": inv})
+}
+
+// IssueCompany выставляет сводный счёт компании за период
+func (h *Handler) IssueCompany(c *gin.Context) {
+	var inv db_invoices.Invoices
+	if err := c.ShouldBindJSON(&inv); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := inv.IssueCompany(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		if err.Error() == data.CompanyNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"response": inv})
+}
+
+func (h *Handler) CreditNote(c *gin.Context) {
+	var inv db_invoices.Invoices
+	if err := c.ShouldBindJSON(&inv); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := inv.CreditNote(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"response": inv})
+}
+
+func (h *Handler) getInvoice(c *gin.Context) (*db_invoices.Invoices, bool) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return nil, false
+	}
+
+	inv, err := db_invoices.GetByID(h.db, id)
+	if err != nil {
+		if err.Error() == data.InvoiceNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	return inv, true
+}
+
+func (h *Handler) GetInvoice(c *gin.Context) {
+	inv, ok := h.getInvoice(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": inv})
+}
+
+// GetList возвращает счета фолио (folio_id) или сводные счета компании (company_id)
+func (h *Handler) GetList(c *gin.Context) {
+	var invoices []db_invoices.Invoices
+	var err error
+	if companyParam := c.Query("company_id"); companyParam != "" {
+		companyId, convErr := strconv.Atoi(companyParam)
+		if convErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+			return
+		}
+		invoices, err = db_invoices.GetByCompany(h.db, companyId)
+	} else {
+		folioId, convErr := strconv.Atoi(c.Query("folio_id"))
+		if convErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+			return
+		}
+		invoices, err = db_invoices.GetByFolio(h.db, folioId)
+	}
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": invoices})
+}
+
+func (h *Handler) RenderHTML(c *gin.Context) {
+	inv, ok := h.getInvoice(c)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := invoice.WriteHTML(&buf, inv.Document()); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": data.InternalError})
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
+
+func (h *Handler) RenderPDF(c *gin.Context) {
+	inv, ok := h.getInvoice(c)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := invoice.WritePDF(&buf, inv.Document()); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": data.InternalError})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", inv.InvoiceNumber+".pdf"))
+	c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/users"
+)
+
+// ManagerFromToken проверяет токен менеджера, подтверждающего операцию
+// (выезд с долгом, крупный возврат и т.п.), и возвращает его имя
+func ManagerFromToken(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+
+	var jwtManager users.JWTToken
+	claims, err := jwtManager.VerifyToken(token)
+	if err != nil {
+		return "", false
+	}
+
+	role, _ := claims["role"].(string)
+	if role != data.Admin_manager && role != data.Main_manager {
+		return "", false
+	}
+
+	username, ok := claims["username"].(string)
+	return username, ok
+}
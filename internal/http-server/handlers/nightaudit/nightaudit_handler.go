@@ -0,0 +1,93 @@
+package nightaudit
+
+import (
+	"net/http"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_nightaudit "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/nightaudit"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const moduleName = "NightAuditModule"
+
+func NewHandler(db *pgxpool.Pool, logger *logger.Logger) *Handler {
+	return &Handler{db: db, logger: logger}
+}
+
+type Handler struct {
+	db     *pgxpool.Pool
+	logger *logger.Logger
+}
+
+func (h *Handler) InitHandler(router *gin.Engine) {
+	router.POST("/night-audit/run", h.Run)
+	router.GET("/night-audit/get-list", h.GetList)
+	router.GET("/night-audit/get-report", h.GetReport)
+}
+
+type runRequest struct {
+	RunBy string `json:"run_by" binding:"required"`
+}
+
+func (h *Handler) Run(c *gin.Context) {
+	var request runRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	audit, err := db_nightaudit.Run(c.Request.Context(), h.db, request.RunBy)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": audit})
+}
+
+func (h *Handler) GetList(c *gin.Context) {
+	from, err := handlers.ParseDate(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongDates})
+		return
+	}
+	to, err := handlers.ParseDate(c.Query("to"))
+	if err != nil || to.Time.Before(from.Time) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongDates})
+		return
+	}
+
+	audits, err := db_nightaudit.GetList(h.db, from, to)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": audits})
+}
+
+func (h *Handler) GetReport(c *gin.Context) {
+	businessDate, err := handlers.ParseDate(c.Query("business_date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongDates})
+		return
+	}
+
+	audit, err := db_nightaudit.GetReport(h.db, businessDate)
+	if err != nil {
+		if err.Error() == data.AuditNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": audit})
+}
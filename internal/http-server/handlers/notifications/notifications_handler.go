@@ -0,0 +1,56 @@
+package notifications
+
+import (
+	"net/http"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_notifications "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/notifications"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const moduleName = "NotificationsModule"
+
+func NewHandler(db *pgxpool.Pool, logger *logger.Logger) *Handler {
+	return &Handler{db: db, logger: logger}
+}
+
+type Handler struct {
+	db     *pgxpool.Pool
+	logger *logger.Logger
+}
+
+func (h *Handler) InitHandler(router *gin.Engine) {
+	router.GET("/notifications/get-list", h.GetNotifications)
+	router.POST("/notifications/mark-read", h.MarkRead)
+}
+
+func (h *Handler) GetNotifications(c *gin.Context) {
+	var notification db_notifications.Notifications
+
+	list, err := notification.GetNotifications(h.db, c.Query("unread") == "true")
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": list})
+}
+
+func (h *Handler) MarkRead(c *gin.Context) {
+	var notification db_notifications.Notifications
+	if err := c.ShouldBindJSON(&notification); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := notification.MarkRead(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": "done"})
+}
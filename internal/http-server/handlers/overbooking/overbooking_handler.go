@@ -0,0 +1,93 @@
+package overbooking
+
+import (
+	"net/http"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_overbooking "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/overbooking"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const moduleName = "OverbookingModule"
+
+func NewHandler(db *pgxpool.Pool, logger *logger.Logger) *Handler {
+	return &Handler{db: db, logger: logger}
+}
+
+type Handler struct {
+	db     *pgxpool.Pool
+	logger *logger.Logger
+}
+
+func (h *Handler) InitHandler(router *gin.Engine) {
+	router.PUT("/overbooking/set-allowance", h.SetAllowance)
+	router.GET("/overbooking/get-allowances", h.GetAllowances)
+	router.GET("/overbooking/report", h.GetReport)
+}
+
+func parsePeriod(c *gin.Context) (pgtype.Date, pgtype.Date, bool) {
+	from, err := handlers.ParseDate(c.Query("from"))
+	if err != nil {
+		return from, from, false
+	}
+	to, err := handlers.ParseDate(c.Query("to"))
+	if err != nil || to.Time.Before(from.Time) {
+		return from, to, false
+	}
+	return from, to, true
+}
+
+func (h *Handler) SetAllowance(c *gin.Context) {
+	var request db_overbooking.AllowanceRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := request.SetAllowance(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": "done"})
+}
+
+func (h *Handler) GetAllowances(c *gin.Context) {
+	from, to, ok := parsePeriod(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongDates})
+		return
+	}
+
+	var allowance db_overbooking.Allowances
+	allowances, err := allowance.GetAllowances(h.db, from, to)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": allowances})
+}
+
+func (h *Handler) GetReport(c *gin.Context) {
+	from, to, ok := parsePeriod(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongDates})
+		return
+	}
+
+	report, err := db_overbooking.GetReport(h.db, from, to)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": report})
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/jackc/pgtype"
+)
+
+// ParseDate разбирает дату из query-параметра в формате 2006-01-02
+func ParseDate(value string) (pgtype.Date, error) {
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return pgtype.Date{}, err
+	}
+	return pgtype.Date{Time: t, Status: pgtype.Present}, nil
+}
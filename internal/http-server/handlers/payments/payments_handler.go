@@ -0,0 +1,267 @@
+package payments
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/payments"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_payments "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/payments"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const moduleName = "PaymentsModule"
+
+// refundThreshold - сумма в базовой валюте, выше которой возврат требует одобрения менеджера
+func NewHandler(db *pgxpool.Pool, logger *logger.Logger, provider payments.Provider, refundThreshold money.Decimal) *Handler {
+	return &Handler{db: db, logger: logger, provider: provider, refundThreshold: refundThreshold}
+}
+
+type Handler struct {
+	db              *pgxpool.Pool
+	logger          *logger.Logger
+	provider        payments.Provider
+	refundThreshold money.Decimal
+}
+
+func (h *Handler) InitHandler(router *gin.Engine) {
+	router.POST("/payments/authorise", h.Authorise)
+	router.POST("/payments/capture", h.Capture)
+	router.POST("/payments/refund", h.Refund)
+	router.GET("/payments/refund-requests", h.RefundRequests)
+	router.POST("/payments/approve-refund", h.ApproveRefund)
+	router.POST("/payments/reject-refund", h.RejectRefund)
+	router.POST("/payments/void", h.Void)
+	router.POST("/payments/webhook", h.Webhook)
+	router.GET("/payments/get-list", h.GetList)
+}
+
+// Валюта не обязательна: по умолчанию базовая валюта отеля
+type authoriseRequest struct {
+	FolioId  int           `json:"folio_id"`
+	Amount   money.Decimal `json:"amount"`
+	Currency string        `json:"currency"`
+	Token    string        `json:"token"`
+}
+
+// Для списания и возврата нулевая сумма означает "всю доступную"
+type operationRequest struct {
+	Id     int           `json:"id"`
+	Amount money.Decimal `json:"amount"`
+}
+
+// Причина возврата обязательна
+type refundRequest struct {
+	Id     int           `json:"id"`
+	Amount money.Decimal `json:"amount"`
+	Reason string        `json:"reason"`
+}
+
+type decisionRequest struct {
+	Id           int    `json:"id"`
+	ManagerToken string `json:"manager_token"`
+	Notes        string `json:"notes"`
+}
+
+func (h *Handler) Authorise(c *gin.Context) {
+	var request authoriseRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	payment := db_payments.Payments{FolioId: request.FolioId, Amount: request.Amount, Currency: request.Currency}
+	if err := payment.Authorise(h.db, h.provider, request.Token); err != nil {
+		logger.New("error", moduleName, err)
+		status := http.StatusBadRequest
+		if errors.Is(err, payments.ErrDeclined) {
+			status = http.StatusPaymentRequired
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"response": payment})
+}
+
+// Списание проводится в открытой смене кассира (shiftId), снятие блокировки - без неё
+func (h *Handler) operation(c *gin.Context, needShift bool, run func(request operationRequest, shiftId *int) (*db_payments.Payments, error)) {
+	var request operationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	var shiftId *int
+	if needShift {
+		var ok bool
+		if shiftId, ok = handlers.RequireShift(c, h.db); !ok {
+			return
+		}
+	}
+
+	payment, err := run(request, shiftId)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": payment})
+}
+
+func (h *Handler) Capture(c *gin.Context) {
+	h.operation(c, true, func(request operationRequest, shiftId *int) (*db_payments.Payments, error) {
+		return db_payments.Capture(h.db, h.provider, request.Id, request.Amount, shiftId)
+	})
+}
+
+// Refund проводит возврат сразу или, если сумма больше порога, ставит заявку
+// в очередь на одобрение (ответ 202 с заявкой)
+func (h *Handler) Refund(c *gin.Context) {
+	var request refundRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	refund := db_payments.RefundRequests{PaymentId: &request.Id, Amount: request.Amount, Reason: request.Reason}
+	handlers.SubmitRefund(c, h.db, h.provider, h.refundThreshold, refund, moduleName)
+}
+
+// RefundRequests - заявки на возврат, по умолчанию очередь ожидающих одобрения
+func (h *Handler) RefundRequests(c *gin.Context) {
+	status := c.DefaultQuery("status", db_payments.RefundPending)
+	if status == "all" {
+		status = ""
+	}
+
+	list, err := db_payments.GetRefundRequests(h.db, status)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": list})
+}
+
+// decision проверяет токен менеджера и применяет его решение по заявке
+func (h *Handler) decision(c *gin.Context, needShift bool, run func(request decisionRequest, manager string, shiftId *int) (*db_payments.RefundRequests, error)) {
+	var request decisionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	manager, ok := handlers.ManagerFromToken(request.ManagerToken)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": data.NotManager})
+		return
+	}
+
+	var shiftId *int
+	if needShift {
+		if shiftId, ok = handlers.RequireShift(c, h.db); !ok {
+			return
+		}
+	}
+
+	refund, err := run(request, manager, shiftId)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		if err.Error() == data.RefundRequestNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err.Error() == data.RefundNotPending {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err.Error() == data.RefundOwnApproval {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": refund})
+}
+
+// ApproveRefund - возврат проводится через провайдера в смене кассира, выполняющего запрос
+func (h *Handler) ApproveRefund(c *gin.Context) {
+	h.decision(c, true, func(request decisionRequest, manager string, shiftId *int) (*db_payments.RefundRequests, error) {
+		return db_payments.ApproveRefund(h.db, h.provider, request.Id, manager, request.Notes, shiftId)
+	})
+}
+
+func (h *Handler) RejectRefund(c *gin.Context) {
+	h.decision(c, false, func(request decisionRequest, manager string, shiftId *int) (*db_payments.RefundRequests, error) {
+		return db_payments.RejectRefund(h.db, request.Id, manager, request.Notes)
+	})
+}
+
+func (h *Handler) Void(c *gin.Context) {
+	h.operation(c, false, func(request operationRequest, shiftId *int) (*db_payments.Payments, error) {
+		return db_payments.Void(h.db, h.provider, request.Id)
+	})
+}
+
+// Webhook принимает уведомления провайдера. Подпись проверяется по сырому телу запроса
+func (h *Handler) Webhook(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	event, err := h.provider.ParseWebhook(body, c.GetHeader(payments.SignatureHeader))
+	if err != nil {
+		logger.New("error", moduleName, err)
+		status := http.StatusBadRequest
+		if errors.Is(err, payments.ErrBadSignature) {
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := db_payments.HandleWebhook(c.Request.Context(), h.db, h.provider.Name(), event); err != nil {
+		logger.New("error", moduleName, err)
+		if err.Error() == data.PaymentNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err.Error() == data.CaptureTooLarge {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": data.InternalError})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": "done"})
+}
+
+func (h *Handler) GetList(c *gin.Context) {
+	folioId, err := strconv.Atoi(c.Query("folio_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	list, err := db_payments.GetByFolio(h.db, folioId)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": list})
+}
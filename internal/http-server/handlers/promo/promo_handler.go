@@ -0,0 +1,105 @@
+package promo
+
+import (
+	"net/http"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_promo "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/promo"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const moduleName = "PromoModule"
+
+func NewHandler(db *pgxpool.Pool, logger *logger.Logger) *Handler {
+	return &Handler{db: db, logger: logger}
+}
+
+type Handler struct {
+	db     *pgxpool.Pool
+	logger *logger.Logger
+}
+
+func (h *Handler) InitHandler(router *gin.Engine) {
+	router.POST("/promo/create-code", h.CreateCode)
+	router.PUT("/promo/edit-code", h.EditCode)
+	router.GET("/promo/get-list", h.GetList)
+	router.GET("/promo/redemptions", h.Redemptions)
+}
+
+func (h *Handler) CreateCode(c *gin.Context) {
+	var promo db_promo.PromoCodes
+	if err := c.ShouldBindJSON(&promo); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := promo.Create(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"response": promo})
+}
+
+func (h *Handler) EditCode(c *gin.Context) {
+	var promo db_promo.PromoCodes
+	if err := c.ShouldBindJSON(&promo); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := promo.Edit(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		if err.Error() == data.PromoNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": promo})
+}
+
+func (h *Handler) GetList(c *gin.Context) {
+	list, err := db_promo.GetList(h.db)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": list})
+}
+
+// Redemptions - отчёт по применениям промокодов. Код и период не обязательны
+func (h *Handler) Redemptions(c *gin.Context) {
+	var from, to pgtype.Date
+	var err error
+	if value := c.Query("from"); value != "" {
+		if from, err = handlers.ParseDate(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+			return
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = handlers.ParseDate(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+			return
+		}
+	}
+
+	list, err := db_promo.GetRedemptions(h.db, c.Query("code"), from, to)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": list})
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/payments"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_payments "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/payments"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// SubmitRefund оформляет заявку на возврат от имени пользователя запроса в его
+// открытой смене: возврат до порога проводится сразу (200), крупный ждёт одобрения (202)
+func SubmitRefund(c *gin.Context, db *pgxpool.Pool, provider payments.Provider, threshold money.Decimal,
+	refund db_payments.RefundRequests, moduleName string) {
+	shiftId, ok := RequireShift(c, db)
+	if !ok {
+		return
+	}
+	refund.RequestedBy, _ = UserFromRequest(c)
+
+	if err := refund.RequestRefund(db, provider, threshold, shiftId); err != nil {
+		logger.New("error", moduleName, err)
+		if err.Error() == data.PaymentNotFound || err.Error() == data.FolioNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if refund.Status == db_payments.RefundPending {
+		c.JSON(http.StatusAccepted, gin.H{"response": refund})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"response": refund})
+}
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers"
 	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
 	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
 	db_rooms "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/rooms"
+	db_tapechart "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/tapechart"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
@@ -23,6 +25,12 @@ type Handler struct {
 func (h *Handler) InitHandler(router *gin.Engine) {
 	router.POST("/rooms/edit-room-status", h.EditStatus)
 	router.GET("/rooms/get-rooms", h.GetRooms)
+	router.PUT("/rooms/edit-room-occupancy", h.EditOccupancy)
+	router.GET("/rooms/tape-chart", h.GetTapeChart)
+	router.POST("/rooms/block-room", h.BlockRoom)
+	router.POST("/rooms/unblock-room", h.UnblockRoom)
+	router.GET("/rooms/housekeeping-tasks", h.GetHousekeepingTasks)
+	router.POST("/rooms/complete-housekeeping-task", h.CompleteHousekeepingTask)
 }
 
 func (h *Handler) EditStatus(c *gin.Context) {
@@ -42,6 +50,23 @@ func (h *Handler) EditStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"response": "done"})
 }
 
+func (h *Handler) EditOccupancy(c *gin.Context) {
+	var roomRequest db_rooms.Rooms
+	if err := c.ShouldBindJSON(&roomRequest); err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"response": data.WrongData})
+		return
+	}
+
+	if err := roomRequest.EditRoomOccupancy(h.db); err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"response": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": "done"})
+}
+
 func (h *Handler) GetRooms(c *gin.Context) {
 	var roomRequest db_rooms.Rooms
 
@@ -53,3 +78,84 @@ func (h *Handler) GetRooms(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"response": rooms})
 }
+
+func (h *Handler) GetTapeChart(c *gin.Context) {
+	from, err := handlers.ParseDate(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"response": data.WrongData})
+		return
+	}
+	to, err := handlers.ParseDate(c.Query("to"))
+	if err != nil || !to.Time.After(from.Time) {
+		c.JSON(http.StatusBadRequest, gin.H{"response": data.WrongDates})
+		return
+	}
+
+	chart, err := db_tapechart.GetChart(h.db, from, to)
+	if err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"response": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": chart})
+}
+
+func (h *Handler) BlockRoom(c *gin.Context) {
+	var block db_rooms.RoomBlocks
+	if err := c.ShouldBindJSON(&block); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"response": data.WrongData})
+		return
+	}
+
+	if err := block.Create(h.db); err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"response": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"response": block})
+}
+
+func (h *Handler) UnblockRoom(c *gin.Context) {
+	var block db_rooms.RoomBlocks
+	if err := c.ShouldBindJSON(&block); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"response": data.WrongData})
+		return
+	}
+
+	if err := block.Delete(h.db); err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"response": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": "done"})
+}
+
+func (h *Handler) GetHousekeepingTasks(c *gin.Context) {
+	tasks, err := db_rooms.GetTasks(h.db, c.Query("status"))
+	if err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"response": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": tasks})
+}
+
+func (h *Handler) CompleteHousekeepingTask(c *gin.Context) {
+	var task db_rooms.HousekeepingTasks
+	if err := c.ShouldBindJSON(&task); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"response": data.WrongData})
+		return
+	}
+
+	if err := task.Complete(h.db); err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"response": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": "done"})
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_shifts "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/shifts"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/users"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// UserFromRequest возвращает имя пользователя из токена в заголовке
+// Authorization ("Bearer <token>")
+func UserFromRequest(c *gin.Context) (string, bool) {
+	token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+	if token == "" {
+		return "", false
+	}
+
+	var jwtManager users.JWTToken
+	claims, err := jwtManager.VerifyToken(token)
+	if err != nil {
+		return "", false
+	}
+
+	username, ok := claims["username"].(string)
+	return username, ok && username != ""
+}
+
+// RequireShift возвращает открытую кассовую смену пользователя запроса.
+// Если смены нет, ответ с ошибкой уже отправлен
+func RequireShift(c *gin.Context, db *pgxpool.Pool) (*int, bool) {
+	username, ok := UserFromRequest(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": data.NotAuthorised})
+		return nil, false
+	}
+
+	id, err := db_shifts.CurrentID(db, username)
+	if err != nil {
+		if err.Error() == data.ShiftNotOpen {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": data.InternalError})
+		return nil, false
+	}
+
+	return &id, true
+}
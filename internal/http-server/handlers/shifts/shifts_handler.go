@@ -0,0 +1,200 @@
+package shifts
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_shifts "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/shifts"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const moduleName = "ShiftsModule"
+
+func NewHandler(db *pgxpool.Pool, logger *logger.Logger) *Handler {
+	return &Handler{db: db, logger: logger}
+}
+
+type Handler struct {
+	db     *pgxpool.Pool
+	logger *logger.Logger
+}
+
+func (h *Handler) InitHandler(router *gin.Engine) {
+	router.POST("/shifts/open-shift", h.OpenShift)
+	router.GET("/shifts/current", h.Current)
+	router.POST("/shifts/close-shift", h.CloseShift)
+	router.POST("/shifts/sign-off", h.SignOff)
+	router.GET("/shifts/get-shift", h.GetShift)
+	router.GET("/shifts/get-list", h.GetList)
+}
+
+// Смена открывается и закрывается пользователем из токена запроса
+func (h *Handler) user(c *gin.Context) (string, bool) {
+	username, ok := handlers.UserFromRequest(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": data.NotAuthorised})
+	}
+	return username, ok
+}
+
+func (h *Handler) OpenShift(c *gin.Context) {
+	var shift db_shifts.Shifts
+	if err := c.ShouldBindJSON(&shift); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+	username, ok := h.user(c)
+	if !ok {
+		return
+	}
+	shift.Username = username
+
+	if err := shift.Open(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		if err.Error() == data.ShiftAlreadyOpen {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"response": shift})
+}
+
+// Current - открытая смена пользователя с текущими итогами (X-отчёт)
+func (h *Handler) Current(c *gin.Context) {
+	username, ok := h.user(c)
+	if !ok {
+		return
+	}
+
+	shift, err := db_shifts.Current(h.db, username)
+	if err != nil {
+		if err.Error() == data.ShiftNotOpen {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": shift})
+}
+
+// CloseShift закрывает смену и возвращает отчёт закрытия
+func (h *Handler) CloseShift(c *gin.Context) {
+	var request db_shifts.CloseRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+	username, ok := h.user(c)
+	if !ok {
+		return
+	}
+
+	shift, err := request.Close(h.db, username)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		if err.Error() == data.ShiftNotOpen {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": shift})
+}
+
+type signOffRequest struct {
+	Id           int    `json:"id"`
+	ManagerToken string `json:"manager_token"`
+	Notes        string `json:"notes"`
+}
+
+// SignOff - менеджер подписывает расхождение закрытой смены
+func (h *Handler) SignOff(c *gin.Context) {
+	var request signOffRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	manager, ok := handlers.ManagerFromToken(request.ManagerToken)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": data.NotManager})
+		return
+	}
+
+	if err := db_shifts.SignOff(h.db, request.Id, manager, request.Notes); err != nil {
+		logger.New("error", moduleName, err)
+		if err.Error() == data.ShiftNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err.Error() == data.ShiftOwnSignOff {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": "done"})
+}
+
+func (h *Handler) GetShift(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	shift, err := db_shifts.GetByID(h.db, id)
+	if err != nil {
+		if err.Error() == data.ShiftNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": shift})
+}
+
+// GetList - смены за период; status=discrepancy - ждущие подписи менеджера
+func (h *Handler) GetList(c *gin.Context) {
+	var from, to pgtype.Date
+	var err error
+	if value := c.Query("from"); value != "" {
+		if from, err = handlers.ParseDate(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+			return
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = handlers.ParseDate(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+			return
+		}
+	}
+
+	shifts, err := db_shifts.GetList(h.db, c.Query("status"), from, to)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": shifts})
+}
@@ -0,0 +1,138 @@
+package stayhours
+
+import (
+	"net/http"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_stayhours "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/stayhours"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const moduleName = "StayHoursModule"
+
+func NewHandler(db *pgxpool.Pool, logger *logger.Logger) *Handler {
+	return &Handler{db: db, logger: logger}
+}
+
+type Handler struct {
+	db     *pgxpool.Pool
+	logger *logger.Logger
+}
+
+func (h *Handler) InitHandler(router *gin.Engine) {
+	router.PUT("/stay-hours/set-fee", h.SetFee)
+	router.POST("/stay-hours/delete-fee", h.DeleteFee)
+	router.GET("/stay-hours/get-fees", h.GetFees)
+	router.POST("/stay-hours/create-request", h.CreateRequest)
+	router.POST("/stay-hours/approve-request", h.ApproveRequest)
+	router.POST("/stay-hours/reject-request", h.RejectRequest)
+	router.GET("/stay-hours/get-requests", h.GetRequests)
+}
+
+func (h *Handler) SetFee(c *gin.Context) {
+	var fee db_stayhours.Fees
+	if err := c.ShouldBindJSON(&fee); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := fee.SetFee(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": fee})
+}
+
+func (h *Handler) DeleteFee(c *gin.Context) {
+	var fee db_stayhours.Fees
+	if err := c.ShouldBindJSON(&fee); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := fee.DeleteFee(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": "done"})
+}
+
+func (h *Handler) GetFees(c *gin.Context) {
+	fees, err := db_stayhours.GetFees(h.db)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": fees})
+}
+
+func (h *Handler) CreateRequest(c *gin.Context) {
+	var request db_stayhours.Requests
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := request.Create(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"response": request})
+}
+
+func (h *Handler) ApproveRequest(c *gin.Context) {
+	var request db_stayhours.Requests
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := request.Approve(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		status := http.StatusBadRequest
+		if err.Error() == data.TimeConflict {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": request})
+}
+
+func (h *Handler) RejectRequest(c *gin.Context) {
+	var request db_stayhours.Requests
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := request.Reject(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": "done"})
+}
+
+func (h *Handler) GetRequests(c *gin.Context) {
+	requests, err := db_stayhours.GetRequests(h.db, c.Query("status"))
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": requests})
+}
@@ -0,0 +1,111 @@
+package taxes
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_taxes "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/taxes"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const moduleName = "TaxesModule"
+
+func NewHandler(db *pgxpool.Pool, logger *logger.Logger) *Handler {
+	return &Handler{db: db, logger: logger}
+}
+
+type Handler struct {
+	db     *pgxpool.Pool
+	logger *logger.Logger
+}
+
+func (h *Handler) InitHandler(router *gin.Engine) {
+	router.POST("/taxes/create-tax", h.CreateTax)
+	router.PUT("/taxes/edit-tax", h.EditTax)
+	router.POST("/taxes/delete-tax", h.DeleteTax)
+	router.GET("/taxes/get-list", h.GetList)
+	router.GET("/taxes/booking-breakdown", h.BookingBreakdown)
+}
+
+func (h *Handler) CreateTax(c *gin.Context) {
+	var tax db_taxes.Taxes
+	if err := c.ShouldBindJSON(&tax); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := tax.Create(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"response": tax})
+}
+
+func (h *Handler) EditTax(c *gin.Context) {
+	var tax db_taxes.Taxes
+	if err := c.ShouldBindJSON(&tax); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := tax.Edit(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": tax})
+}
+
+func (h *Handler) DeleteTax(c *gin.Context) {
+	var tax db_taxes.Taxes
+	if err := c.ShouldBindJSON(&tax); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := tax.Delete(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": "done"})
+}
+
+func (h *Handler) GetList(c *gin.Context) {
+	taxes, err := db_taxes.GetList(h.db)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": taxes})
+}
+
+func (h *Handler) BookingBreakdown(c *gin.Context) {
+	bookingId, err := strconv.Atoi(c.Query("booking_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	breakdown, err := db_taxes.BookingBreakdown(h.db, bookingId)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		if err.Error() == data.BookingNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": breakdown})
+}
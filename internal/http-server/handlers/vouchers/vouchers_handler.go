@@ -0,0 +1,103 @@
+package vouchers
+
+import (
+	"net/http"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/handlers"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_vouchers "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/vouchers"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const moduleName = "VouchersModule"
+
+func NewHandler(db *pgxpool.Pool, logger *logger.Logger) *Handler {
+	return &Handler{db: db, logger: logger}
+}
+
+type Handler struct {
+	db     *pgxpool.Pool
+	logger *logger.Logger
+}
+
+func (h *Handler) InitHandler(router *gin.Engine) {
+	router.POST("/vouchers/issue-voucher", h.IssueVoucher)
+	router.POST("/vouchers/redeem-voucher", h.RedeemVoucher)
+	router.GET("/vouchers/get-balance", h.GetBalance)
+	router.GET("/vouchers/liability", h.Liability)
+}
+
+func (h *Handler) IssueVoucher(c *gin.Context) {
+	var voucher db_vouchers.Vouchers
+	if err := c.ShouldBindJSON(&voucher); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+	shiftId, ok := handlers.RequireShift(c, h.db)
+	if !ok {
+		return
+	}
+	voucher.ShiftId = shiftId
+
+	if err := voucher.Issue(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"response": voucher})
+}
+
+func (h *Handler) RedeemVoucher(c *gin.Context) {
+	var request db_vouchers.RedeemRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+	shiftId, ok := handlers.RequireShift(c, h.db)
+	if !ok {
+		return
+	}
+	request.ShiftId = shiftId
+
+	payment, err := request.Redeem(h.db)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		if err.Error() == data.VoucherNotFound || err.Error() == data.FolioNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": payment})
+}
+
+func (h *Handler) GetBalance(c *gin.Context) {
+	voucher, err := db_vouchers.GetByCode(h.db, c.Query("code"))
+	if err != nil {
+		if err.Error() == data.VoucherNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": voucher})
+}
+
+func (h *Handler) Liability(c *gin.Context) {
+	report, err := db_vouchers.LiabilityReport(h.db)
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": report})
+}
@@ -0,0 +1,97 @@
+package waitlist
+
+import (
+	"net/http"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_booking "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/booking"
+	db_waitlist "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/waitlist"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const moduleName = "WaitlistModule"
+
+func NewHandler(db *pgxpool.Pool, logger *logger.Logger) *Handler {
+	return &Handler{db: db, logger: logger}
+}
+
+type Handler struct {
+	db     *pgxpool.Pool
+	logger *logger.Logger
+}
+
+func (h *Handler) InitHandler(router *gin.Engine) {
+	router.POST("/waitlist/add-entry", h.AddEntry)
+	router.POST("/waitlist/cancel-entry", h.CancelEntry)
+	router.POST("/waitlist/book-entry", h.BookEntry)
+	router.GET("/waitlist/get-list", h.GetList)
+}
+
+type bookRequest struct {
+	Id      int                 `json:"id"`
+	Booking db_booking.Bookings `json:"booking"`
+}
+
+func (h *Handler) AddEntry(c *gin.Context) {
+	var entry db_waitlist.Waitlist
+	if err := c.ShouldBindJSON(&entry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := entry.AddEntry(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"response": entry})
+}
+
+func (h *Handler) CancelEntry(c *gin.Context) {
+	var entry db_waitlist.Waitlist
+	if err := c.ShouldBindJSON(&entry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	if err := entry.Cancel(h.db); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": "done"})
+}
+
+func (h *Handler) BookEntry(c *gin.Context) {
+	var request bookRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+		return
+	}
+
+	entry := db_waitlist.Waitlist{Id: request.Id}
+	if err := entry.Book(h.db, &request.Booking); err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"response": request.Booking})
+}
+
+func (h *Handler) GetList(c *gin.Context) {
+	var entry db_waitlist.Waitlist
+
+	list, err := entry.GetList(h.db, c.Query("status"))
+	if err != nil {
+		logger.New("error", moduleName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response": list})
+}
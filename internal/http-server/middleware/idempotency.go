@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_idempotency "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/idempotency"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	moduleName = "IdempotencyMiddleware"
+
+	IdempotencyHeader = "Idempotency-Key"
+	ReplayedHeader    = "Idempotent-Replayed"
+)
+
+// Запоминает тело ответа, чтобы сохранить его для повторов
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency - для POST-запросов с заголовком Idempotency-Key к маршрутам routes
+// (создание записей и движение денег) сохраняет первый ответ и отдаёт его же
+// на повтор с тем же ключом и телом. Повтор ключа с другим телом отклоняется.
+// Ответы с ошибкой сервера не сохраняются, чтобы запрос можно было повторить
+func Idempotency(db *pgxpool.Pool, ttl time.Duration, routes ...string) gin.HandlerFunc {
+	guarded := make(map[string]bool)
+	for _, route := range routes {
+		guarded[route] = true
+	}
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyHeader)
+		if key == "" || c.Request.Method != http.MethodPost || !guarded[c.FullPath()] {
+			c.Next()
+			return
+		}
+		if len(key) > 255 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": data.WrongData})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n"))
+		hash.Write(body)
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+
+		stored, reserved, err := db_idempotency.Reserve(c.Request.Context(), db, key, requestHash, ttl)
+		if err != nil {
+			logger.New("error", moduleName, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": data.InternalError})
+			return
+		}
+
+		if !reserved {
+			switch {
+			case stored.RequestHash != requestHash:
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": data.IdempotencyKeyReused})
+			case stored.StatusCode == 0:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": data.IdempotencyInProgress})
+			default:
+				c.Header(ReplayedHeader, "true")
+				c.Data(stored.StatusCode, stored.ContentType, stored.ResponseBody)
+				c.Abort()
+			}
+			return
+		}
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		// Ключ освобождается и при панике обработчика. Контекст запроса не используется:
+		// после отключения клиента он уже отменён, и ключ остался бы занятым до конца TTL
+		// (таймаут задают сами Save и Release)
+		saved := false
+		defer func() {
+			if saved {
+				return
+			}
+			if err := db_idempotency.Release(context.Background(), db, key); err != nil {
+				logger.New("error", moduleName, err)
+			}
+		}()
+
+		c.Next()
+
+		status := writer.Status()
+		if status >= http.StatusInternalServerError {
+			return
+		}
+
+		result := db_idempotency.Keys{
+			Key:          key,
+			StatusCode:   status,
+			ResponseBody: writer.body.Bytes(),
+			ContentType:  writer.Header().Get("Content-Type"),
+		}
+		if err := result.Save(context.Background(), db); err != nil {
+			logger.New("error", moduleName, err)
+			return
+		}
+		saved = true
+	}
+}
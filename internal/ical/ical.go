@@ -0,0 +1,171 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const dateLayout = "20060102"
+
+// Event - событие календаря занятости (даты без времени, End не включается)
+type Event struct {
+	UID       string
+	Summary   string
+	Start     time.Time
+	End       time.Time
+	Cancelled bool
+}
+
+// Write формирует VCALENDAR с событиями на целые дни
+func Write(w io.Writer, name string, events []Event) error {
+	var b strings.Builder
+	line := func(format string, args ...interface{}) {
+		b.WriteString(fold(fmt.Sprintf(format, args...)))
+		b.WriteString("\r\n")
+	}
+
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//HotelCrm//Occupancy//RU")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:%s", escape(name))
+	for _, event := range events {
+		line("BEGIN:VEVENT")
+		line("UID:%s", escape(event.UID))
+		line("DTSTAMP:%s", stamp)
+		line("DTSTART;VALUE=DATE:%s", event.Start.Format(dateLayout))
+		line("DTEND;VALUE=DATE:%s", event.End.Format(dateLayout))
+		line("SUMMARY:%s", escape(event.Summary))
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Parse читает события VEVENT. Время в DTSTART/DTEND отбрасывается,
+// событие без DTEND считается однодневным
+func Parse(r io.Reader) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	var current *Event
+	for _, raw := range lines {
+		name, value := splitLine(raw)
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			current = &Event{}
+		case name == "END" && value == "VEVENT":
+			if current == nil {
+				continue
+			}
+			if current.UID == "" || current.Start.IsZero() {
+				return nil, errors.New("ical: event without UID or DTSTART")
+			}
+			if current.End.IsZero() || !current.End.After(current.Start) {
+				current.End = current.Start.AddDate(0, 0, 1)
+			}
+			events = append(events, *current)
+			current = nil
+		case current == nil:
+			continue
+		case name == "UID":
+			current.UID = unescape(value)
+		case name == "SUMMARY":
+			current.Summary = unescape(value)
+		case name == "STATUS":
+			current.Cancelled = strings.EqualFold(value, "CANCELLED")
+		case name == "DTSTART" || name == "DTEND":
+			date, err := parseDate(value)
+			if err != nil {
+				return nil, err
+			}
+			if name == "DTSTART" {
+				current.Start = date
+			} else {
+				current.End = date
+			}
+		}
+	}
+
+	return events, nil
+}
+
+// Для DATE-TIME важна только календарная дата заезда/выезда
+func parseDate(value string) (time.Time, error) {
+	if len(value) < len(dateLayout) {
+		return time.Time{}, fmt.Errorf("ical: wrong date %q", value)
+	}
+	return time.Parse(dateLayout, value[:len(dateLayout)])
+}
+
+// Длинные строки по RFC 5545 продолжаются на следующей строке с пробелом в начале
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += text[1:]
+			continue
+		}
+		if text != "" {
+			lines = append(lines, text)
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+// Параметры свойства (;VALUE=DATE, ;TZID=...) не используются
+func splitLine(line string) (name, value string) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return strings.ToUpper(line), ""
+	}
+	head, value := line[:colon], line[colon+1:]
+	if semicolon := strings.Index(head, ";"); semicolon >= 0 {
+		head = head[:semicolon]
+	}
+	return strings.ToUpper(head), value
+}
+
+func fold(line string) string {
+	const limit = 75
+	if len(line) <= limit {
+		return line
+	}
+
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > limit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+var unescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+func escape(s string) string   { return escaper.Replace(s) }
+func unescape(s string) string { return unescaper.Replace(s) }
@@ -0,0 +1,96 @@
+package ical
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []Event
+		wantErr bool
+	}{
+		{
+			name: "all-day event",
+			input: "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:abc@example.com\r\nDTSTART;VALUE=DATE:20261001\r\n" +
+				"DTEND;VALUE=DATE:20261004\r\nSUMMARY:Reserved\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+			want: []Event{{UID: "abc@example.com", Summary: "Reserved", Start: day(2026, 10, 1), End: day(2026, 10, 4)}},
+		},
+		{
+			name: "date-time and missing end",
+			input: "BEGIN:VEVENT\nUID:1\nDTSTART;TZID=Europe/Moscow:20261001T140000\nEND:VEVENT\n" +
+				"BEGIN:VEVENT\nUID:2\nDTSTART:20261005T120000Z\nDTEND:20261005T180000Z\nEND:VEVENT\n",
+			want: []Event{
+				{UID: "1", Start: day(2026, 10, 1), End: day(2026, 10, 2)},
+				{UID: "2", Start: day(2026, 10, 5), End: day(2026, 10, 6)},
+			},
+		},
+		{
+			name: "folded and escaped lines",
+			input: "BEGIN:VEVENT\r\nUID:long\r\n -uid\r\nSUMMARY:Smith\\, John\\; VIP\\nlate\r\nSTATUS:cancelled\r\n" +
+				"DTSTART:20261001\r\nDTEND:20261002\r\nEND:VEVENT\r\n",
+			want: []Event{{UID: "long-uid", Summary: "Smith, John; VIP\nlate", Start: day(2026, 10, 1), End: day(2026, 10, 2), Cancelled: true}},
+		},
+		{
+			name:  "properties outside events are ignored",
+			input: "BEGIN:VCALENDAR\nUID:calendar\nDTSTART:bad\nEND:VEVENT\nEND:VCALENDAR\n",
+		},
+		{
+			name:    "event without uid",
+			input:   "BEGIN:VEVENT\nDTSTART:20261001\nEND:VEVENT\n",
+			wantErr: true,
+		},
+		{
+			name:    "wrong date",
+			input:   "BEGIN:VEVENT\nUID:1\nDTSTART:2026-10\nEND:VEVENT\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteParse(t *testing.T) {
+	events := []Event{
+		{UID: "booking-1@hotel", Summary: "Занято", Start: day(2026, 10, 1), End: day(2026, 10, 3)},
+		{UID: "booking-2@hotel", Summary: strings.Repeat("Очень длинное описание; с запятыми, ", 5), Start: day(2026, 10, 3), End: day(2026, 10, 4)},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "Номер 101", events); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line longer than 75 octets: %q", line)
+		}
+	}
+
+	got, err := Parse(&buf)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if !reflect.DeepEqual(got, events) {
+		t.Errorf("round trip = %+v, want %+v", got, events)
+	}
+}
@@ -0,0 +1,108 @@
+package invoice
+
+import (
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+)
+
+// Party - реквизиты продавца или покупателя
+type Party struct {
+	Name    string
+	TaxId   string
+	Address string
+}
+
+// Line - строка счёта
+type Line struct {
+	Date        time.Time
+	Description string
+	Amount      money.Decimal
+}
+
+// Tax - итог по одному налогу
+type Tax struct {
+	Name   string
+	Amount money.Decimal
+}
+
+// Document - данные счёта или корректировочного счёта для печати
+type Document struct {
+	Title     string
+	Number    string
+	IssueDate time.Time
+	// Номер исправляемого счёта (для корректировочного счёта)
+	Corrects string
+	// Код подтверждения брони (пустой - не печатается)
+	Booking string
+	// Срок оплаты при отсрочке (нулевая дата - не печатается)
+	DueDate time.Time
+	// Период сводного счёта компании (нулевые даты - не печатаются)
+	PeriodFrom time.Time
+	PeriodTo   time.Time
+	Seller     Party
+	Buyer      Party
+	// Валюта всех сумм документа
+	Currency string
+	Lines    []Line
+	Taxes    []Tax
+	NetTotal money.Decimal
+	TaxTotal money.Decimal
+	Total    money.Decimal
+}
+
+func amount(value money.Decimal) string {
+	return value.String()
+}
+
+func date(value time.Time) string {
+	return value.Format("02.01.2006")
+}
+
+var htmlTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"money": amount,
+	"date":  date,
+	"inc":   func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} № {{.Number}}</title>
+<style>
+body { font-family: Arial, sans-serif; font-size: 14px; margin: 32px; }
+table { border-collapse: collapse; width: 100%; margin-top: 16px; }
+th, td { border: 1px solid #999; padding: 4px 8px; text-align: left; }
+td.num, th.num { text-align: right; }
+.parties { display: flex; gap: 48px; margin-top: 16px; }
+</style>
+</head>
+<body>
+<h1>{{.Title}} № {{.Number}} от {{date .IssueDate}}</h1>
+{{if .Corrects}}<p>Корректировка счёта № {{.Corrects}}</p>{{end}}
+{{if .Booking}}<p>Бронирование № {{.Booking}}</p>{{end}}
+{{if not .PeriodFrom.IsZero}}<p>За период с {{date .PeriodFrom}} по {{date .PeriodTo}}</p>{{end}}
+{{if not .DueDate.IsZero}}<p>Оплатить до {{date .DueDate}}</p>{{end}}
+<div class="parties">
+<div><strong>Продавец</strong><br>{{.Seller.Name}}<br>ИНН {{.Seller.TaxId}}<br>{{.Seller.Address}}</div>
+<div><strong>Покупатель</strong><br>{{.Buyer.Name}}{{if .Buyer.TaxId}}<br>ИНН {{.Buyer.TaxId}}{{end}}{{if .Buyer.Address}}<br>{{.Buyer.Address}}{{end}}</div>
+</div>
+<table>
+<tr><th>№</th><th>Дата</th><th>Наименование</th><th class="num">Сумма, {{.Currency}}</th></tr>
+{{range $i, $line := .Lines}}<tr><td>{{$i | inc}}</td><td>{{date $line.Date}}</td><td>{{$line.Description}}</td><td class="num">{{money $line.Amount}}</td></tr>
+{{end}}</table>
+<table>
+<tr><td>Итого без налогов</td><td class="num">{{money .NetTotal}}</td></tr>
+{{range .Taxes}}<tr><td>{{.Name}}</td><td class="num">{{money .Amount}}</td></tr>
+{{end}}<tr><td>Налоги всего</td><td class="num">{{money .TaxTotal}}</td></tr>
+<tr><th>Всего к оплате</th><th class="num">{{money .Total}}</th></tr>
+</table>
+</body>
+</html>
+`))
+
+// WriteHTML печатает документ в HTML
+func WriteHTML(w io.Writer, doc Document) error {
+	return htmlTemplate.Execute(w, doc)
+}
@@ -0,0 +1,166 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	pageWidth    = 595 // A4, пункты
+	pageHeight   = 842
+	pageMargin   = 50
+	fontSize     = 9
+	lineHeight   = 13
+	linesPerPage = (pageHeight - 2*pageMargin) / lineHeight
+	lineWidth    = 90 // символов Courier 9pt в ширину страницы с полями
+)
+
+// WritePDF печатает документ в PDF. Стандартные шрифты PDF не содержат
+// кириллицы, поэтому текст транслитерируется, а таблица выравнивается
+// моноширинным шрифтом Courier
+func WritePDF(w io.Writer, doc Document) error {
+	var lines []string
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, transliterate(fmt.Sprintf(format, args...)))
+	}
+
+	add("%s No. %s ot %s", doc.Title, doc.Number, date(doc.IssueDate))
+	if doc.Corrects != "" {
+		add("Korrektirovka scheta No. %s", doc.Corrects)
+	}
+	if doc.Booking != "" {
+		add("Bronirovanie No. %s", doc.Booking)
+	}
+	if !doc.PeriodFrom.IsZero() {
+		add("Za period s %s po %s", date(doc.PeriodFrom), date(doc.PeriodTo))
+	}
+	if !doc.DueDate.IsZero() {
+		add("Oplatit do %s", date(doc.DueDate))
+	}
+	add("")
+	add("Prodavec: %s", doc.Seller.Name)
+	add("INN %s", doc.Seller.TaxId)
+	add("%s", doc.Seller.Address)
+	add("")
+	add("Pokupatel: %s", doc.Buyer.Name)
+	if doc.Buyer.TaxId != "" {
+		add("INN %s", doc.Buyer.TaxId)
+	}
+	if doc.Buyer.Address != "" {
+		add("%s", doc.Buyer.Address)
+	}
+	add("")
+	add("%-4s %-10s %-58s %14s", "No.", "Data", "Naimenovanie", "Summa, "+doc.Currency)
+	add("%s", strings.Repeat("-", lineWidth))
+	for i, line := range doc.Lines {
+		description := transliterate(line.Description)
+		if utf8.RuneCountInString(description) > 58 {
+			description = string([]rune(description)[:57]) + "~"
+		}
+		add("%-4d %-10s %-58s %14s", i+1, date(line.Date), description, amount(line.Amount))
+	}
+	add("%s", strings.Repeat("-", lineWidth))
+	add("%-75s %14s", "Itogo bez nalogov", amount(doc.NetTotal))
+	for _, tax := range doc.Taxes {
+		add("%-75s %14s", tax.Name, amount(tax.Amount))
+	}
+	add("%-75s %14s", "Nalogi vsego", amount(doc.TaxTotal))
+	add("%-75s %14s", "Vsego k oplate", amount(doc.Total))
+
+	var pages [][]string
+	for len(lines) > linesPerPage {
+		pages = append(pages, lines[:linesPerPage])
+		lines = lines[linesPerPage:]
+	}
+	pages = append(pages, lines)
+
+	_, err := w.Write(buildPDF(pages))
+	return err
+}
+
+// buildPDF собирает PDF 1.4: каталог, дерево страниц, шрифт и по
+// странице с потоком содержимого на каждый блок строк
+func buildPDF(pages [][]string) []byte {
+	var buf bytes.Buffer
+	var offsets []int
+
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+
+	// Объекты 1-3, затем пары (страница, содержимое) начиная с 4
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range pages {
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", fontSize, lineHeight, pageMargin, pageHeight-pageMargin)
+		for _, line := range page {
+			fmt.Fprintf(&content, "(%s) Tj T*\n", escapePDF(line))
+		}
+		content.WriteString("ET")
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 5+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return buf.Bytes()
+}
+
+var pdfEscaper = strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`)
+
+// Символы вне ASCII после транслитерации заменяются на "?"
+func escapePDF(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r > 126 || r < 32 {
+			r = '?'
+		}
+		b.WriteRune(r)
+	}
+	return pdfEscaper.Replace(b.String())
+}
+
+var translit = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", '№': "No.",
+}
+
+func transliterate(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		lower := []rune(strings.ToLower(string(r)))[0]
+		latin, ok := translit[lower]
+		if !ok {
+			b.WriteRune(r)
+			continue
+		}
+		if lower != r && latin != "" {
+			latin = strings.ToUpper(latin[:1]) + latin[1:]
+		}
+		b.WriteString(latin)
+	}
+	return b.String()
+}
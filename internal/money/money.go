@@ -0,0 +1,305 @@
+// Package money - точные денежные суммы и курсы валют без ошибок округления float64
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgtype"
+)
+
+var (
+	ErrInvalidAmount   = errors.New("invalid amount")
+	ErrInvalidCurrency = errors.New("invalid currency code")
+)
+
+// Decimal - сумма с точностью до сотых, хранится целым числом копеек.
+// Складывается и сравнивается обычными операторами, умножение и деление -
+// методами с округлением половины от нуля.
+// В JSON записывается числом ("12.30"), читается из числа или строки
+type Decimal int64
+
+// Rate - курс или коэффициент с точностью до 6 знаков после запятой
+type Rate int64
+
+const (
+	decimalDigits = 2
+	rateDigits    = 6
+
+	centsPerUnit = 100
+	rateUnit     = 1000000
+
+	// UnitRate - курс 1 (валюта к самой себе)
+	UnitRate Rate = rateUnit
+)
+
+// Cents создаёт сумму из копеек
+func Cents(cents int64) Decimal {
+	return Decimal(cents)
+}
+
+// Units создаёт сумму из целых единиц валюты
+func Units(units int64) Decimal {
+	return Decimal(units * centsPerUnit)
+}
+
+// Parse разбирает сумму вида "-1234.5"; больше двух знаков после запятой округляются
+func Parse(value string) (Decimal, error) {
+	v, err := parseFixed(value, decimalDigits)
+	return Decimal(v), err
+}
+
+// ParseRate разбирает курс вида "92.456789"
+func ParseRate(value string) (Rate, error) {
+	v, err := parseFixed(value, rateDigits)
+	return Rate(v), err
+}
+
+func (d Decimal) Cents() int64 {
+	return int64(d)
+}
+
+func (d Decimal) String() string {
+	return formatFixed(int64(d), decimalDigits)
+}
+
+func (d Decimal) Abs() Decimal {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// Mul умножает сумму на целое число (ночей, гостей)
+func (d Decimal) Mul(n int) Decimal {
+	return d * Decimal(n)
+}
+
+// Div делит сумму на целое число с округлением до копейки
+func (d Decimal) Div(n int) Decimal {
+	if n == 0 {
+		return 0
+	}
+	return Decimal(mulDiv(int64(d), 1, int64(n)))
+}
+
+// Percent - процент от суммы; процент задаётся суммой того же вида (20.00 = 20%)
+func (d Decimal) Percent(percent Decimal) Decimal {
+	return Decimal(mulDiv(int64(d), int64(percent), 100*centsPerUnit))
+}
+
+// WithoutPercent выделяет из суммы, включающей процент, сумму без него
+func (d Decimal) WithoutPercent(percent Decimal) Decimal {
+	return Decimal(mulDiv(int64(d), 100*centsPerUnit, 100*centsPerUnit+int64(percent)))
+}
+
+// MulRate умножает сумму на курс
+func (d Decimal) MulRate(rate Rate) Decimal {
+	return Decimal(mulDiv(int64(d), int64(rate), rateUnit))
+}
+
+// DivRate делит сумму на курс
+func (d Decimal) DivRate(rate Rate) Decimal {
+	if rate == 0 {
+		return 0
+	}
+	return Decimal(mulDiv(int64(d), rateUnit, int64(rate)))
+}
+
+func (r Rate) String() string {
+	return formatFixed(int64(r), rateDigits)
+}
+
+// Money - сумма в конкретной валюте
+type Money struct {
+	Amount   Decimal `json:"amount"`
+	Currency string  `json:"currency"`
+}
+
+func (m Money) String() string {
+	return m.Amount.String() + " " + m.Currency
+}
+
+// NormalizeCurrency проверяет трёхбуквенный код ISO 4217 и приводит его к верхнему регистру
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 3 {
+		return "", ErrInvalidCurrency
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return "", ErrInvalidCurrency
+		}
+	}
+	return code, nil
+}
+
+// a * b / c с округлением половины от нуля без переполнения
+func mulDiv(a, b, c int64) int64 {
+	num := new(big.Int).Mul(big.NewInt(a), big.NewInt(b))
+	den := big.NewInt(c)
+	if den.Sign() < 0 {
+		num.Neg(num)
+		den.Neg(den)
+	}
+
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	rem.Abs(rem).Mul(rem, big.NewInt(2))
+	if rem.Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+	return quo.Int64()
+}
+
+func parseFixed(value string, digits int) (int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, ErrInvalidAmount
+	}
+
+	// Экспоненциальная запись приходит от JSON-клиентов и из float8-колонок
+	if strings.ContainsAny(value, "eE") {
+		f, ok := new(big.Float).SetString(value)
+		if !ok {
+			return 0, ErrInvalidAmount
+		}
+		value = f.Text('f', digits+1)
+	}
+
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimPrefix(strings.TrimPrefix(value, "-"), "+")
+
+	whole, fraction, _ := strings.Cut(value, ".")
+	if whole == "" && fraction == "" {
+		return 0, ErrInvalidAmount
+	}
+	if whole == "" {
+		whole = "0"
+	}
+
+	// Лишние знаки дробной части округляются по первому отброшенному
+	roundUp := false
+	if len(fraction) > digits {
+		roundUp = fraction[digits] >= '5'
+		fraction = fraction[:digits]
+	}
+	fraction += strings.Repeat("0", digits-len(fraction))
+
+	for _, part := range []string{whole, fraction} {
+		for _, r := range part {
+			if r < '0' || r > '9' {
+				return 0, ErrInvalidAmount
+			}
+		}
+	}
+
+	v, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidAmount
+	}
+	if roundUp {
+		v++
+	}
+	if negative {
+		v = -v
+	}
+	return v, nil
+}
+
+func formatFixed(v int64, digits int) string {
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	s := strconv.FormatInt(v, 10)
+	if len(s) <= digits {
+		s = strings.Repeat("0", digits-len(s)+1) + s
+	}
+	return sign + s[:len(s)-digits] + "." + s[len(s)-digits:]
+}
+
+func unmarshalFixed(b []byte, digits int) (int64, error) {
+	s := string(b)
+	if s == "null" {
+		return 0, nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	return parseFixed(s, digits)
+}
+
+// Значение из базы: numeric приходит строкой, float8 - числом
+func scanFixed(src interface{}, digits int) (int64, error) {
+	switch v := src.(type) {
+	case nil:
+		return 0, nil
+	case string:
+		return parseFixed(v, digits)
+	case []byte:
+		return parseFixed(string(v), digits)
+	case float64:
+		return parseFixed(strconv.FormatFloat(v, 'f', -1, 64), digits)
+	case int64:
+		return parseFixed(strconv.FormatInt(v, 10), digits)
+	}
+	return 0, fmt.Errorf("cannot scan %T into money", src)
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	v, err := unmarshalFixed(b, decimalDigits)
+	*d = Decimal(v)
+	return err
+}
+
+func (d *Decimal) Scan(src interface{}) error {
+	v, err := scanFixed(src, decimalDigits)
+	*d = Decimal(v)
+	return err
+}
+
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// EncodeText передаёт сумму в запрос текстом, иначе pgx записал бы копейки как целые единицы
+func (d Decimal) EncodeText(ci *pgtype.ConnInfo, buf []byte) ([]byte, error) {
+	return append(buf, d.String()...), nil
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Rate) UnmarshalJSON(b []byte) error {
+	v, err := unmarshalFixed(b, rateDigits)
+	*r = Rate(v)
+	return err
+}
+
+func (r *Rate) Scan(src interface{}) error {
+	v, err := scanFixed(src, rateDigits)
+	*r = Rate(v)
+	return err
+}
+
+func (r Rate) Value() (driver.Value, error) {
+	return r.String(), nil
+}
+
+func (r Rate) EncodeText(ci *pgtype.ConnInfo, buf []byte) ([]byte, error) {
+	return append(buf, r.String()...), nil
+}
@@ -0,0 +1,166 @@
+package money
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Decimal
+		wantErr bool
+	}{
+		{value: "12.30", want: 1230},
+		{value: "-1234.5", want: -123450},
+		{value: "+3", want: 300},
+		{value: ".5", want: 50},
+		{value: "5.", want: 500},
+		{value: " 7.01 ", want: 701},
+		{value: "1.994", want: 199},
+		{value: "1.995", want: 200},
+		{value: "0.005", want: 1},
+		{value: "-0.005", want: -1},
+		{value: "1e2", want: 10000},
+		{value: "1.5E-1", want: 15},
+		{value: "", wantErr: true},
+		{value: "-", wantErr: true},
+		{value: "abc", wantErr: true},
+		{value: "1.2.3", wantErr: true},
+		{value: "1,5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q) = %v, want error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Rate
+	}{
+		{value: "1", want: UnitRate},
+		{value: "92.456789", want: 92456789},
+		{value: "0.0000005", want: 1},
+		{value: "0.0000004", want: 0},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRate(tt.value)
+		if err != nil {
+			t.Errorf("ParseRate(%q) error: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		value Decimal
+		want  string
+	}{
+		{value: 0, want: "0.00"},
+		{value: Cents(5), want: "0.05"},
+		{value: Cents(-5), want: "-0.05"},
+		{value: Units(12), want: "12.00"},
+		{value: Cents(-123450), want: "-1234.50"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.value.String(); got != tt.want {
+			t.Errorf("Decimal(%d).String() = %q, want %q", int64(tt.value), got, tt.want)
+		}
+	}
+
+	if got := Rate(92456789).String(); got != "92.456789" {
+		t.Errorf("Rate.String() = %q, want %q", got, "92.456789")
+	}
+}
+
+func TestMulDiv(t *testing.T) {
+	tests := []struct {
+		a, b, c int64
+		want    int64
+	}{
+		{a: 10, b: 1, c: 3, want: 3},
+		{a: 20, b: 1, c: 3, want: 7},
+		{a: 5, b: 1, c: 2, want: 3},
+		{a: -5, b: 1, c: 2, want: -3},
+		{a: 5, b: 1, c: -2, want: -3},
+		{a: -5, b: 1, c: -2, want: 3},
+		{a: 7, b: 1, c: 4, want: 2},
+		{a: 1 << 62, b: 4, c: 8, want: 1 << 61},
+	}
+
+	for _, tt := range tests {
+		if got := mulDiv(tt.a, tt.b, tt.c); got != tt.want {
+			t.Errorf("mulDiv(%d, %d, %d) = %d, want %d", tt.a, tt.b, tt.c, got, tt.want)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	rate, _ := ParseRate("92.456789")
+
+	tests := []struct {
+		name string
+		got  Decimal
+		want Decimal
+	}{
+		{name: "div", got: Units(10).Div(3), want: Cents(333)},
+		{name: "div by zero", got: Units(10).Div(0), want: 0},
+		{name: "mul", got: Cents(1050).Mul(3), want: Cents(3150)},
+		{name: "percent", got: Units(100).Percent(Units(20)), want: Units(20)},
+		{name: "percent rounding", got: Cents(999).Percent(Cents(1250)), want: Cents(125)},
+		{name: "without percent", got: Units(120).WithoutPercent(Units(20)), want: Units(100)},
+		{name: "mul rate", got: Units(10).MulRate(rate), want: Cents(92457)},
+		{name: "div rate", got: Cents(92457).DivRate(rate), want: Units(10)},
+		{name: "div zero rate", got: Units(10).DivRate(0), want: 0},
+		{name: "abs", got: Cents(-15).Abs(), want: Cents(15)},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeCurrency(t *testing.T) {
+	tests := []struct {
+		code    string
+		want    string
+		wantErr bool
+	}{
+		{code: "RUB", want: "RUB"},
+		{code: " usd ", want: "USD"},
+		{code: "US", wantErr: true},
+		{code: "EURO", wantErr: true},
+		{code: "U1D", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeCurrency(tt.code)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeCurrency(%q) error = %v, wantErr %v", tt.code, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeCurrency(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
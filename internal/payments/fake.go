@@ -0,0 +1,140 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+)
+
+// DeclineToken - токен карты, по которому фейковый провайдер отклоняет платёж
+const DeclineToken = "decline"
+
+type fakePayment struct {
+	status     string
+	authorised money.Decimal
+	captured   money.Decimal
+	refunded   money.Decimal
+}
+
+// Fake - провайдер для разработки и тестов: хранит платежи в памяти
+// и подписывает уведомления HMAC-SHA256 общим секретом
+type Fake struct {
+	secret   []byte
+	mutex    sync.Mutex
+	payments map[string]*fakePayment
+}
+
+func NewFake(webhookSecret string) *Fake {
+	return &Fake{secret: []byte(webhookSecret), payments: make(map[string]*fakePayment)}
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+func (f *Fake) Authorise(ctx context.Context, request AuthoriseRequest) (Result, error) {
+	if request.Amount <= 0 || request.Token == DeclineToken {
+		return Result{Status: Failed}, ErrDeclined
+	}
+
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return Result{}, err
+	}
+	reference := "fake_" + hex.EncodeToString(buf)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.payments[reference] = &fakePayment{status: Authorised, authorised: request.Amount}
+
+	return Result{Reference: reference, Status: Authorised}, nil
+}
+
+func (f *Fake) Capture(ctx context.Context, reference string, amount money.Decimal) (Result, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	payment, ok := f.payments[reference]
+	if !ok {
+		return Result{}, ErrUnknownPayment
+	}
+	if payment.status != Authorised || amount <= 0 || amount > payment.authorised {
+		return Result{}, ErrWrongState
+	}
+	payment.status = Captured
+	payment.captured = amount
+
+	return Result{Reference: reference, Status: Captured}, nil
+}
+
+func (f *Fake) Refund(ctx context.Context, reference string, amount money.Decimal) (Result, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	payment, ok := f.payments[reference]
+	if !ok {
+		return Result{}, ErrUnknownPayment
+	}
+	if payment.status != Captured || amount <= 0 || payment.refunded+amount > payment.captured {
+		return Result{}, ErrWrongState
+	}
+	payment.refunded += amount
+	if payment.refunded == payment.captured {
+		payment.status = Refunded
+	}
+
+	return Result{Reference: reference, Status: payment.status}, nil
+}
+
+func (f *Fake) Void(ctx context.Context, reference string) (Result, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	payment, ok := f.payments[reference]
+	if !ok {
+		return Result{}, ErrUnknownPayment
+	}
+	if payment.status != Authorised {
+		return Result{}, ErrWrongState
+	}
+	payment.status = Voided
+
+	return Result{Reference: reference, Status: Voided}, nil
+}
+
+func (f *Fake) mac(body []byte) []byte {
+	mac := hmac.New(sha256.New, f.secret)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// Sign подписывает тело уведомления (для эмуляции вызовов провайдера)
+func (f *Fake) Sign(body []byte) string {
+	return hex.EncodeToString(f.mac(body))
+}
+
+func (f *Fake) ParseWebhook(body []byte, signature string) (*WebhookEvent, error) {
+	if len(f.secret) == 0 {
+		return nil, ErrBadSignature
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, f.mac(body)) {
+		return nil, ErrBadSignature
+	}
+
+	var event WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, ErrBadWebhook
+	}
+	if event.EventId == "" || event.Reference == "" || event.Status == "" {
+		return nil, ErrBadWebhook
+	}
+
+	return &event, nil
+}
@@ -0,0 +1,75 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+)
+
+const (
+	// Payment statuses
+	Authorised = "authorised" // Сумма заблокирована на карте
+	Captured   = "captured"   // Списана
+	Refunded   = "refunded"   // Возвращена полностью
+	Voided     = "voided"     // Блокировка снята без списания
+	Failed     = "failed"     // Отклонена
+)
+
+// SignatureHeader - заголовок с подписью уведомления провайдера
+const SignatureHeader = "X-Payment-Signature"
+
+var (
+	ErrDeclined       = errors.New("payment declined")
+	ErrUnknownPayment = errors.New("payment not found at provider")
+	ErrWrongState     = errors.New("operation not allowed in current payment state")
+	ErrBadSignature   = errors.New("webhook signature is invalid")
+	ErrBadWebhook     = errors.New("webhook payload is invalid")
+)
+
+// AuthoriseRequest - данные для блокировки суммы
+type AuthoriseRequest struct {
+	Amount      money.Decimal
+	Currency    string
+	Token       string // Токен карты, выданный платёжной формой провайдера
+	Description string
+}
+
+// Result - ответ провайдера по операции
+type Result struct {
+	Reference string // Идентификатор платежа у провайдера
+	Status    string
+}
+
+// WebhookEvent - уведомление провайдера об изменении статуса платежа.
+// RefundedTotal - сколько всего возвращено по платежу у провайдера
+// (для уведомлений о возврате; без него возврат считается полным)
+type WebhookEvent struct {
+	EventId       string        `json:"event_id"`
+	Reference     string        `json:"reference"`
+	Status        string        `json:"status"`
+	Amount        money.Decimal `json:"amount"`
+	RefundedTotal money.Decimal `json:"refunded_total"`
+}
+
+// Provider - платёжный провайдер (эквайринг)
+type Provider interface {
+	Name() string
+	Authorise(ctx context.Context, request AuthoriseRequest) (Result, error)
+	Capture(ctx context.Context, reference string, amount money.Decimal) (Result, error)
+	Refund(ctx context.Context, reference string, amount money.Decimal) (Result, error)
+	Void(ctx context.Context, reference string) (Result, error)
+	// ParseWebhook проверяет подпись уведомления и разбирает его
+	ParseWebhook(body []byte, signature string) (*WebhookEvent, error)
+}
+
+// New создаёт провайдера по имени из конфигурации
+func New(name, webhookSecret string) (Provider, error) {
+	switch name {
+	case "fake":
+		return NewFake(webhookSecret), nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", name)
+	}
+}
@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/http-server/logger"
+)
+
+// Job - фоновая задача, выполняемая по расписанию
+type Job func(ctx context.Context) error
+
+// Every запускает задачу с заданным интервалом, пока не будет отменён ctx.
+// Ошибки задачи пишутся в лог и не останавливают расписание.
+// Задача с неположительным интервалом не запускается
+func Every(ctx context.Context, name string, interval time.Duration, job Job) {
+	if interval <= 0 {
+		logger.Error(name, "scheduler.go", fmt.Errorf("invalid interval %s", interval))
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := job(ctx); err != nil {
+					logger.Error(name, "scheduler.go", err)
+				}
+			}
+		}
+	}()
+}
+
+// Daily запускает задачу каждый день в заданное время (формат "15:04", местное время)
+func Daily(ctx context.Context, name, at string, job Job) error {
+	clock, err := time.Parse("15:04", at)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			now := time.Now()
+			next := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+
+			timer := time.NewTimer(next.Sub(now))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+				if err := job(ctx); err != nil {
+					logger.Error(name, "scheduler.go", err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
@@ -7,9 +7,71 @@ const (
 	Cleaner       = "cleaner"
 
 	// Errors
-	UserExists    = "user already exists"
-	UserNotFound  = "user not found"
-	WrongPassword = "wrong password"
-	InternalError = "internal server error"
-	WrongData     = "wrong data"
+	UserExists            = "user already exists"
+	UserNotFound          = "user not found"
+	WrongPassword         = "wrong password"
+	InternalError         = "internal server error"
+	WrongData             = "wrong data"
+	WrongDates            = "check-out date must be after check-in date"
+	BookingNotFound       = "booking not found"
+	RoomNotAvailable      = "room is not available for these dates"
+	RoomNotFound          = "room does not exist"
+	BlockNotFound         = "room block not found"
+	OccupancyExceeded     = "guests count exceeds room maximum occupancy"
+	GroupNotFound         = "group not found"
+	HoldNotFound          = "hold not found or expired"
+	WaitlistNotFound      = "waitlist entry not found"
+	FolioNotFound         = "folio not found"
+	AuditNotFound         = "night audit not found"
+	AuditTooEarly         = "business date has not ended yet"
+	WrongTime             = "time must be in HH:MM format"
+	RequestNotFound       = "request not found"
+	RequestExists         = "request already exists"
+	OutsideSchedule       = "requested time is outside the fee schedule"
+	TimeConflict          = "room is occupied by another booking at the requested time"
+	TaskNotFound          = "housekeeping task not found"
+	WrongMoveDate         = "move date must be within the stay"
+	BookingMoved          = "booking has room moves, change its room with a move"
+	FolioClosed           = "folio is closed"
+	ChargeNotFound        = "charge not found"
+	RefundExceedsPaid     = "refund exceeds the amount paid"
+	BalanceNotZero        = "folio balance must be settled before check-out"
+	NotManager            = "manager authorisation required"
+	InvoiceNotFound       = "invoice not found"
+	InvoiceCredited       = "invoice already has a credit note"
+	NothingToInvoice      = "folio has no charges to invoice"
+	PaymentNotFound       = "payment not found"
+	CaptureTooLarge       = "captured amount exceeds the authorised amount"
+	TaxNotFound           = "tax not found"
+	WrongCurrency         = "unknown currency"
+	RateNotFound          = "exchange rate not found"
+	CurrencyInUse         = "base currency cannot be changed once bookings or payments exist"
+	PromoNotFound         = "promo code not found"
+	PromoNotApplicable    = "promo code does not apply to this booking"
+	PromoExhausted        = "promo code usage limit reached"
+	CompanyNotFound       = "company not found"
+	CompanyInactive       = "company account is inactive"
+	CreditLimitExceeded   = "company credit limit exceeded"
+	VoucherNotFound       = "voucher not found"
+	VoucherNotActive      = "voucher is expired or fully redeemed"
+	VoucherNotApplicable  = "voucher is not valid for this booking"
+	ShiftNotFound         = "cashier shift not found"
+	ShiftNoDiscrepancy    = "cashier shift has no discrepancy to sign off"
+	ShiftNotOpen          = "no open cashier shift"
+	ShiftAlreadyOpen      = "cashier shift is already open"
+	ShiftOwnSignOff       = "manager cannot sign off their own cashier shift"
+	NotAuthorised         = "authorisation required"
+	PolicyNotFound        = "deposit policy not found"
+	RefundReasonRequired  = "refund reason is required"
+	RefundRequestNotFound = "refund request not found"
+	RefundNotPending      = "refund request is already decided"
+	RefundOwnApproval     = "manager cannot approve their own refund request"
+	WrongCursor           = "invalid pagination cursor"
+	ClientNotFound        = "client not found"
+	ClientDuplicate       = "client looks like a duplicate"
+	ForbiddenURL          = "url is not allowed"
+	CalendarTooLarge      = "calendar is too large"
+
+	IdempotencyKeyReused  = "idempotency key was already used with a different request"
+	IdempotencyInProgress = "request with this idempotency key is still in progress"
 )
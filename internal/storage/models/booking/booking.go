@@ -2,61 +2,876 @@ package db_booking
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_companies "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/companies"
+	db_currency "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/currency"
+	db_folio "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/folio"
+	db_notifications "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/notifications"
+	db_promo "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/promo"
+	db_property "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/property"
+	db_rooms "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/rooms"
 	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
+const (
+	// Booking statuses
+	Tentative  = "tentative"   // Предварительная, ждёт предоплаты
+	Confirmed  = "confirmed"   // Подтверждена
+	CheckedIn  = "checked_in"  // Гость проживает
+	CheckedOut = "checked_out" // Гость выехал
+	NoShow     = "no_show"     // Гость не заехал
+	Cancelled  = "cancelled"   // Отменена
+)
+
+// InactiveStatuses - брони в этих статусах не занимают номер
+var InactiveStatuses = []string{Cancelled, NoShow}
+
+// RoomStaysQ - занятость номеров по броням с учётом переездов: бронь
+// с сегментами даёт строку на каждый сегмент, остальные - одну строку.
+// Используется вместо таблицы Bookings в запросах занятости номеров
+const RoomStaysQ = `(SELECT b.id, COALESCE(s.room_id, b.room_id) AS room_id,
+		COALESCE(s.date_from, b.check_in_date) AS check_in_date,
+		COALESCE(s.date_to, b.check_out_date) AS check_out_date,
+		b.status, b.client_id, b.notes
+	FROM Bookings b LEFT JOIN BookingSegments s ON s.booking_id = b.id)`
+
 type Bookings struct {
-	Id         int                `json:"id"`
-	ClientId   int                `json:"client_id"`
-	RoomId     int                `json:"room_id"`
-	Checkin    pgtype.Date        `json:"check_in_data"`
-	Checkout   pgtype.Date        `json:"check_out_data"`
-	TotalPrice float64            `json:"total_price"`
-	Notes      string             `json:"notes"`
-	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+	Id          int                `json:"id"`
+	ClientId    int                `json:"client_id"`
+	RoomId      int                `json:"room_id"`
+	GroupId     *int               `json:"group_id,omitempty"`
+	Checkin     pgtype.Date        `json:"check_in_data"`
+	Checkout    pgtype.Date        `json:"check_out_data"`
+	TotalPrice  money.Decimal      `json:"total_price"`
+	Notes       string             `json:"notes"`
+	Status      string             `json:"status"`
+	ExternalUid *string            `json:"external_uid,omitempty"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+
+	// Код подтверждения, который сообщается гостю (вида ABCD-2345)
+	ConfirmationCode string `json:"confirmation_code"`
+
+	// Размещение: взрослые, дети с возрастами и поимённый список проживающих
+	Adults    int         `json:"adults"`
+	Children  int         `json:"children"`
+	ChildAges []int       `json:"child_ages"`
+	Occupants []Occupants `json:"occupants"`
+
+	// Число гостей по категориям освобождения от налогов (например, {"child": 1})
+	ExemptGuests map[string]int `json:"exempt_guests"`
+
+	// Компания, для сотрудника которой бронь: цена считается по её договорному тарифу
+	CompanyId *int `json:"company_id,omitempty"`
+
+	// Промокод и скидка по нему; TotalPrice указывается уже со скидкой
+	PromoCode string        `json:"promo_code"`
+	Discount  money.Decimal `json:"discount"`
+
+	// Время заезда/выезда ("15:04") по одобренному запросу на ранний заезд или
+	// поздний выезд и фактическое время. При создании и изменении брони не задаются
+	RequestedArrival   *string            `json:"requested_arrival_time"`
+	RequestedDeparture *string            `json:"requested_departure_time"`
+	ActualArrival      pgtype.Timestamptz `json:"actual_arrival"`
+	ActualDeparture    pgtype.Timestamptz `json:"actual_departure"`
+
+	// Сегменты проживания по номерам, если гость переезжал (иначе пусто)
+	Segments []Segments `json:"segments"`
+}
+
+// Occupants - проживающий по брони, связанный с карточкой клиента
+type Occupants struct {
+	ClientId int    `json:"client_id"`
+	FullName string `json:"full_name"`
+}
+
+const selectBookingQ = `SELECT id, client_id, room_id, group_id, check_in_date, check_out_date,
+	total_price, notes, status, external_uid, created_at,
+	adults, children, COALESCE(child_ages, '{}'), COALESCE(confirmation_code, ''),
+	requested_arrival_time, requested_departure_time, actual_arrival, actual_departure,
+	COALESCE(exempt_guests, '{}'), company_id, COALESCE(promo_code, ''), COALESCE(discount, 0) FROM Bookings`
+
+func scanBooking(row pgx.Row, b *Bookings) error {
+	return row.Scan(
+		&b.Id,
+		&b.ClientId,
+		&b.RoomId,
+		&b.GroupId,
+		&b.Checkin,
+		&b.Checkout,
+		&b.TotalPrice,
+		&b.Notes,
+		&b.Status,
+		&b.ExternalUid,
+		&b.CreatedAt,
+		&b.Adults,
+		&b.Children,
+		&b.ChildAges,
+		&b.ConfirmationCode,
+		&b.RequestedArrival,
+		&b.RequestedDeparture,
+		&b.ActualArrival,
+		&b.ActualDeparture,
+		&b.ExemptGuests,
+		&b.CompanyId,
+		&b.PromoCode,
+		&b.Discount,
+	)
+}
+
+// Nights - количество ночей проживания
+func (b *Bookings) Nights() int {
+	return int(b.Checkout.Time.Sub(b.Checkin.Time).Hours() / 24)
+}
+
+func (b *Bookings) validateDates() error {
+	if b.Checkin.Status != pgtype.Present || b.Checkout.Status != pgtype.Present {
+		return errors.New(data.WrongData)
+	}
+	if !b.Checkout.Time.After(b.Checkin.Time) {
+		return errors.New(data.WrongDates)
+	}
+	return nil
+}
+
+// CheckRoomAvailable проверяет, что номер не занят другими бронями
+// и действующими удержаниями (holds) на указанные даты.
+// Занятый номер продаётся сверх фонда, только если свободных номеров его типа
+// не осталось, а квота овербукинга не исчерпана ни в одну из ночей.
+// Внутри транзакции номера этого типа блокируются до её завершения
+func CheckRoomAvailable(ctx context.Context, q storage.Querier, roomId, excludeBookingId int, checkin, checkout pgtype.Date) error {
+	var roomType string
+	if err := q.QueryRow(ctx, "SELECT room_type FROM rooms WHERE id = $1", roomId).Scan(&roomType); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New(data.RoomNotFound)
+		}
+		return err
+	}
+	if _, err := q.Exec(ctx, "SELECT id FROM rooms WHERE room_type = $1 FOR UPDATE", roomType); err != nil {
+		return err
+	}
+
+	checkQ := `SELECT
+		(SELECT COUNT(*) FROM ` + RoomStaysQ + ` b
+			WHERE room_id = $1 AND id <> $2 AND status <> ALL($3)
+			AND check_in_date < $5 AND check_out_date > $4)
+		+
+		(SELECT COUNT(*) FROM RoomHolds
+			WHERE room_id = $1 AND status = 'active' AND expires_at > now()
+			AND check_in_date < $5 AND check_out_date > $4)`
+
+	// Номер, выведенный из эксплуатации, не продаётся даже по квоте овербукинга
+	var blocked int
+	blockQ := "SELECT COUNT(*) FROM RoomBlocks WHERE room_id = $1 AND date_from < $3 AND date_to > $2"
+	if err := q.QueryRow(ctx, blockQ, roomId, checkin, checkout).Scan(&blocked); err != nil {
+		return err
+	}
+	if blocked > 0 {
+		return errors.New(data.RoomNotAvailable)
+	}
+
+	var count int
+	if err := q.QueryRow(ctx, checkQ, roomId, excludeBookingId, InactiveStatuses, checkin, checkout).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+
+	free, err := freeRoomCount(ctx, q, roomType, excludeBookingId, checkin, checkout)
+	if err != nil {
+		return err
+	}
+	if free > 0 {
+		return errors.New(data.RoomNotAvailable)
+	}
+
+	capacity, err := TypeCapacity(ctx, q, excludeBookingId, checkin, checkout)
+	if err != nil {
+		return err
+	}
+	if capacity[roomType] > 0 {
+		return nil
+	}
+
+	return errors.New(data.RoomNotAvailable)
+}
+
+// freeRoomCount - сколько номеров типа свободны на все даты периода
+// (без учёта брони excludeBookingId)
+func freeRoomCount(ctx context.Context, q storage.Querier, roomType string, excludeBookingId int, checkin, checkout pgtype.Date) (int, error) {
+	freeQ := `SELECT COUNT(*) FROM rooms
+		WHERE room_type = $1
+		AND NOT EXISTS (SELECT 1 FROM ` + RoomStaysQ + ` b
+			WHERE b.room_id = rooms.id AND b.id <> $2 AND b.status <> ALL($5)
+			AND b.check_in_date < $4 AND b.check_out_date > $3)
+		AND NOT EXISTS (SELECT 1 FROM RoomHolds h
+			WHERE h.room_id = rooms.id AND h.status = 'active' AND h.expires_at > now()
+			AND h.check_in_date < $4 AND h.check_out_date > $3)
+		AND NOT EXISTS (SELECT 1 FROM RoomBlocks rb
+			WHERE rb.room_id = rooms.id AND rb.date_from < $4 AND rb.date_to > $3)`
+
+	var free int
+	err := q.QueryRow(ctx, freeQ, roomType, excludeBookingId, checkin, checkout, InactiveStatuses).Scan(&free)
+	return free, err
+}
+
+// TypeCapacity возвращает, сколько ещё номеров каждого типа можно продать
+// на каждую ночь периода: физический фонд + квота овербукинга
+// - номера вне эксплуатации - проданные ночи
+func TypeCapacity(ctx context.Context, q storage.Querier, excludeBookingId int, checkin, checkout pgtype.Date) (map[string]int, error) {
+	capacityQ := `WITH nights AS (
+			SELECT d::date AS night FROM generate_series($1::date, $2::date - 1, interval '1 day') d
+		), types AS (
+			SELECT room_type, COUNT(*) AS physical FROM rooms GROUP BY room_type
+		)
+		SELECT t.room_type, MIN(t.physical + COALESCE(a.allowance, 0)
+			- (SELECT COUNT(*) FROM RoomBlocks rb JOIN rooms r ON r.id = rb.room_id
+				WHERE r.room_type = t.room_type AND rb.date_from <= n.night AND rb.date_to > n.night)
+			- (SELECT COUNT(*) FROM ` + RoomStaysQ + ` b JOIN rooms r ON r.id = b.room_id
+				WHERE r.room_type = t.room_type AND b.id <> $3 AND b.status <> ALL($4)
+				AND b.check_in_date <= n.night AND b.check_out_date > n.night)
+			- (SELECT COUNT(*) FROM RoomHolds h JOIN rooms r ON r.id = h.room_id
+				WHERE r.room_type = t.room_type AND h.status = 'active' AND h.expires_at > now()
+				AND h.check_in_date <= n.night AND h.check_out_date > n.night))
+		FROM types t
+		CROSS JOIN nights n
+		LEFT JOIN OverbookingAllowances a ON a.room_type = t.room_type AND a.stay_date = n.night
+		GROUP BY t.room_type`
+
+	rows, err := q.Query(ctx, capacityQ, checkin, checkout, excludeBookingId, InactiveStatuses)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	capacity := make(map[string]int)
+	for rows.Next() {
+		var roomType string
+		var left int
+		if err := rows.Scan(&roomType, &left); err != nil {
+			return nil, err
+		}
+		capacity[roomType] = left
+	}
+
+	return capacity, rows.Err()
+}
+
+// RoomFreeCond - SQL-условие "номер свободен от проживаний, удержаний и
+// блокировок на период". Аргументы - SQL-выражения номера, дат заезда и выезда
+// и параметра со списком неактивных статусов броней (InactiveStatuses)
+func RoomFreeCond(roomId, checkin, checkout, inactive string) string {
+	return `NOT EXISTS (SELECT 1 FROM ` + RoomStaysQ + ` b
+			WHERE b.room_id = ` + roomId + ` AND b.status <> ALL(` + inactive + `)
+			AND b.check_in_date < ` + checkout + ` AND b.check_out_date > ` + checkin + `)
+		AND NOT EXISTS (SELECT 1 FROM RoomHolds h
+			WHERE h.room_id = ` + roomId + ` AND h.status = 'active' AND h.expires_at > now()
+			AND h.check_in_date < ` + checkout + ` AND h.check_out_date > ` + checkin + `)
+		AND NOT EXISTS (SELECT 1 FROM RoomBlocks rb
+			WHERE rb.room_id = ` + roomId + ` AND rb.date_from < ` + checkout + ` AND rb.date_to > ` + checkin + `)`
+}
+
+// FindAvailableRooms ищет номера нужного типа, свободные на все даты периода
+// и вмещающие guests человек. Пустой roomType - любой тип, guests = 0 - без фильтра
+func FindAvailableRooms(ctx context.Context, q storage.Querier, roomType string, guests int, checkin, checkout pgtype.Date) ([]db_rooms.Rooms, error) {
+	where := `WHERE ($1 = '' OR room_type = $1)
+		AND ($5 = 0 OR max_occupancy = 0 OR max_occupancy >= $5)
+		AND ` + RoomFreeCond("rooms.id", "$2", "$3", "$4") + `
+		ORDER BY room_number`
+
+	return db_rooms.QueryList(ctx, q, where, roomType, checkin, checkout, InactiveStatuses, guests)
+}
+
+// AvailableRoom - номер в результатах поиска. Overbooking означает,
+// что номер занят и продаётся сверх фонда в пределах квоты
+type AvailableRoom struct {
+	db_rooms.Rooms
+	Overbooking bool `json:"overbooking"`
+	// Стоимость всего проживания в запрошенной валюте и скидка по промокоду в ней же
+	Quote    money.Money   `json:"quote"`
+	Discount money.Decimal `json:"discount"`
+}
+
+// SearchAvailability возвращает свободные номера, а занятые номера типа - только
+// если свободных номеров этого типа не осталось и квота овербукинга не исчерпана.
+// Стоимость пересчитывается в currency по текущему курсу (пусто - базовая валюта)
+// со скидкой по промокоду, если он подходит к типу номера
+func SearchAvailability(ctx context.Context, q storage.Querier, roomType string, guests int, checkin, checkout pgtype.Date,
+	currency, promoCode string) ([]AvailableRoom, error) {
+	if currency == "" {
+		settings, err := db_property.GetTx(ctx, q, false)
+		if err != nil {
+			return nil, err
+		}
+		currency = settings.BaseCurrency
+	}
+	rate, err := db_currency.RateTx(ctx, q, currency)
+	if err != nil {
+		return nil, err
+	}
+	currency, _ = money.NormalizeCurrency(currency)
+
+	// Свободные номера считаются без учёта вместимости: пока номер типа свободен, овербукинга нет
+	free, err := FindAvailableRooms(ctx, q, roomType, 0, checkin, checkout)
+	if err != nil {
+		return nil, err
+	}
+
+	capacity, err := TypeCapacity(ctx, q, 0, checkin, checkout)
+	if err != nil {
+		return nil, err
+	}
+
+	isFree := make(map[int]bool)
+	freeByType := make(map[string]int)
+	result := make([]AvailableRoom, 0, len(free))
+	for _, room := range free {
+		isFree[room.Id] = true
+		freeByType[room.RoomType]++
+		if guests == 0 || room.MaxOccupancy == 0 || room.MaxOccupancy >= guests {
+			result = append(result, AvailableRoom{Rooms: room})
+		}
+	}
+
+	occupiedQ := `WHERE ($1 = '' OR room_type = $1)
+		AND ($4 = 0 OR max_occupancy = 0 OR max_occupancy >= $4)
+		AND NOT EXISTS (SELECT 1 FROM RoomBlocks rb
+			WHERE rb.room_id = rooms.id AND rb.date_from < $3 AND rb.date_to > $2)
+		ORDER BY room_number`
+	all, err := db_rooms.QueryList(ctx, q, occupiedQ, roomType, checkin, checkout, guests)
+	if err != nil {
+		return nil, err
+	}
+	for _, room := range all {
+		if !isFree[room.Id] && freeByType[room.RoomType] == 0 && capacity[room.RoomType] > 0 {
+			result = append(result, AvailableRoom{Rooms: room, Overbooking: true})
+		}
+	}
+
+	adults := guests
+	if adults == 0 {
+		adults = 1
+	}
+	nights := int(checkout.Time.Sub(checkin.Time).Hours() / 24)
+	for i := range result {
+		price := result[i].NightlyPrice(adults, nil).Mul(nights)
+		var discount money.Decimal
+		if promoCode != "" {
+			stay := db_promo.Stay{RoomType: result[i].RoomType, Checkin: checkin, Checkout: checkout}
+			promo, err := db_promo.FindTx(ctx, q, promoCode, stay, false)
+			switch {
+			case err == nil:
+				discount = promo.Discount(price)
+			case err.Error() != data.PromoNotApplicable && err.Error() != data.PromoExhausted:
+				return nil, err
+			}
+		}
+		result[i].Quote = money.Money{Amount: (price - discount).DivRate(rate), Currency: currency}
+		result[i].Discount = discount.DivRate(rate)
+	}
+
+	return result, nil
+}
+
+func (b *Bookings) checkRoomAvailable(ctx context.Context, q storage.Querier) error {
+	return CheckRoomAvailable(ctx, q, b.RoomId, b.Id, b.Checkin, b.Checkout)
+}
+
+// Проверка состава гостей и вместимости номера. Возвращает номер для расчёта цены
+func (b *Bookings) validateOccupancy(ctx context.Context, q storage.Querier) (*db_rooms.Rooms, error) {
+	if b.Adults == 0 {
+		b.Adults = 1
+	}
+	if b.Children == 0 {
+		b.Children = len(b.ChildAges)
+	}
+	if b.Adults < 0 || b.Children != len(b.ChildAges) {
+		return nil, errors.New(data.WrongData)
+	}
+	for _, age := range b.ChildAges {
+		if age < 0 || age > 17 {
+			return nil, errors.New(data.WrongData)
+		}
+	}
+
+	room, err := db_rooms.GetRoomByIDTx(ctx, q, b.RoomId)
+	if err != nil {
+		return nil, err
+	}
+
+	guests := b.Adults + b.Children
+	if room.MaxOccupancy > 0 && guests > room.MaxOccupancy {
+		return nil, errors.New(data.OccupancyExceeded)
+	}
+	if len(b.Occupants) > guests {
+		return nil, errors.New(data.OccupancyExceeded)
+	}
+	for _, count := range b.ExemptGuests {
+		if count < 0 || count > guests {
+			return nil, errors.New(data.WrongData)
+		}
+	}
+	if b.ExemptGuests == nil {
+		b.ExemptGuests = map[string]int{}
+	}
+
+	return room, nil
+}
+
+// applyCompanyRate подставляет договорную цену компании вместо цены номера.
+// Новые брони на неактивную компанию не принимаются
+func (b *Bookings) applyCompanyRate(ctx context.Context, q storage.Querier, room *db_rooms.Rooms) error {
+	if b.CompanyId == nil {
+		return nil
+	}
+
+	company, err := db_companies.GetByIDTx(ctx, q, *b.CompanyId)
+	if err != nil {
+		return err
+	}
+	if !company.Active {
+		return errors.New(data.CompanyInactive)
+	}
+	if rate, ok := company.Rate(room.RoomType); ok {
+		room.PricePerNight = rate
+	}
+
+	return nil
+}
+
+// Если цена не передана - считаем по тарифу номера с доплатами за гостей
+func (b *Bookings) calculatePrice(room *db_rooms.Rooms) {
+	if b.TotalPrice > 0 {
+		return
+	}
+
+	b.TotalPrice = room.NightlyPrice(b.Adults, b.ChildAges).Mul(b.Nights())
+}
+
+// Список проживающих перезаписывается целиком
+func (b *Bookings) saveOccupants(ctx context.Context, q storage.Querier) error {
+	if _, err := q.Exec(ctx, "DELETE FROM BookingOccupants WHERE booking_id = $1", b.Id); err != nil {
+		return err
+	}
+
+	for _, occupant := range b.Occupants {
+		if _, err := q.Exec(ctx, "INSERT INTO BookingOccupants(booking_id, client_id) VALUES($1, $2)", b.Id, occupant.ClientId); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Подгрузка проживающих одним запросом для всех броней выборки
+func loadOccupants(ctx context.Context, q storage.Querier, bookings []Bookings) error {
+	if len(bookings) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(bookings))
+	index := make(map[int]int, len(bookings))
+	for i := range bookings {
+		ids[i] = bookings[i].Id
+		index[bookings[i].Id] = i
+		bookings[i].Occupants = []Occupants{}
+	}
+
+	rows, err := q.Query(ctx, `SELECT o.booking_id, o.client_id, c.full_name
+		FROM BookingOccupants o JOIN Clients c ON c.id = o.client_id
+		WHERE o.booking_id = ANY($1) ORDER BY o.booking_id, o.id`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bookingId int
+		var occupant Occupants
+		if err := rows.Scan(&bookingId, &occupant.ClientId, &occupant.FullName); err != nil {
+			return err
+		}
+		i := index[bookingId]
+		bookings[i].Occupants = append(bookings[i].Occupants, occupant)
+	}
+
+	return rows.Err()
+}
+
+// CreateTx создаёт бронь в рамках переданного соединения или транзакции
+func (b *Bookings) CreateTx(ctx context.Context, q storage.Querier) error {
+	if err := b.validateDates(); err != nil {
+		return err
+	}
+	// Время заезда и выезда меняется только одобрением запроса с доплатой
+	b.RequestedArrival, b.RequestedDeparture = nil, nil
+	room, err := b.validateOccupancy(ctx, q)
+	if err != nil {
+		return err
+	}
+	if err := b.checkRoomAvailable(ctx, q); err != nil {
+		return err
+	}
+	if err := b.applyCompanyRate(ctx, q, room); err != nil {
+		return err
+	}
+	b.calculatePrice(room)
+
+	var promo *db_promo.PromoCodes
+	b.Discount = 0
+	if b.PromoCode != "" {
+		stay := db_promo.Stay{ClientId: b.ClientId, RoomType: room.RoomType, Checkin: b.Checkin, Checkout: b.Checkout}
+		if promo, err = db_promo.FindTx(ctx, q, b.PromoCode, stay, true); err != nil {
+			return err
+		}
+		b.PromoCode = promo.Code
+		b.Discount = promo.Discount(b.TotalPrice)
+		b.TotalPrice -= b.Discount
+	}
+
+	if err := b.generateConfirmationCode(ctx, q); err != nil {
+		return err
+	}
+	// Предварительная бронь подтверждается после оплаты первого этапа предоплаты
+	if b.Status != Tentative {
+		b.Status = Confirmed
+	}
+
+	createQ :=
+		`INSERT INTO Bookings(client_id, room_id, group_id, check_in_date, check_out_date, total_price, notes, status, external_uid,
+			adults, children, child_ages, confirmation_code, requested_arrival_time, requested_departure_time, exempt_guests,
+			company_id, promo_code, discount)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, NULLIF($18, ''), $19)
+		RETURNING id, created_at
+	`
+
+	if err := q.QueryRow(ctx, createQ,
+		b.ClientId, b.RoomId, b.GroupId, b.Checkin, b.Checkout, b.TotalPrice, b.Notes, b.Status, b.ExternalUid,
+		b.Adults, b.Children, b.ChildAges, b.ConfirmationCode, b.RequestedArrival, b.RequestedDeparture, b.ExemptGuests,
+		b.CompanyId, b.PromoCode, b.Discount,
+	).Scan(&b.Id, &b.CreatedAt); err != nil {
+		return err
+	}
+
+	if promo != nil {
+		if err := promo.RedeemTx(ctx, q, b.Id, b.ClientId, b.Discount); err != nil {
+			return err
+		}
+	}
+
+	if err := b.scheduleDepositsTx(ctx, q, b.CreatedAt.Time); err != nil {
+		return err
+	}
+
+	return b.saveOccupants(ctx, q)
 }
 
 func (b *Bookings) Create(db *pgxpool.Pool) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	createQ :=
-		`INSERT INTO Bookings(client_id, room_id, check_in_date, check_out_date, total_price, notes)
-		VALUES($1, $2, $3, $4, $5, $6)
-	`
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
 
-	_, err := db.Exec(ctx, createQ)
+	if err := b.CreateTx(ctx, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// EditTx меняет номер, даты, состав гостей и заметки брони.
+// При смене номера, дат или снятии промокода, а также при нулевой цене
+// цена пересчитывается по тарифу номера
+func (b *Bookings) EditTx(ctx context.Context, q storage.Querier) error {
+	if err := b.validateDates(); err != nil {
+		return err
+	}
+	room, err := b.validateOccupancy(ctx, q)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	// Номер и даты брони с переездами меняются только через переезд
+	current, err := GetByIDTx(ctx, q, b.Id)
+	if err != nil {
+		return err
+	}
+	// Время заезда и выезда меняется только одобрением запроса с доплатой
+	b.RequestedArrival, b.RequestedDeparture = current.RequestedArrival, current.RequestedDeparture
+	stayChanged := b.RoomId != current.RoomId || !b.Checkin.Time.Equal(current.Checkin.Time) || !b.Checkout.Time.Equal(current.Checkout.Time)
+	if len(current.Segments) > 0 {
+		if stayChanged {
+			return errors.New(data.BookingMoved)
+		}
+		if b.TotalPrice <= 0 {
+			b.TotalPrice = segmentsTotal(current.Segments)
+		}
+	} else if err := b.checkRoomAvailable(ctx, q); err != nil {
+		return err
+	}
+
+	// Промокод проверяется по новым датам и номеру: неподходящий снимается
+	// вместе со скидкой, а цена по тарифу пересчитывается со скидкой
+	b.PromoCode, b.Discount = current.PromoCode, current.Discount
+	promoDropped := false
+	if b.PromoCode != "" {
+		stay := db_promo.Stay{
+			ClientId: current.ClientId,
+			RoomType: room.RoomType,
+			Checkin:  b.Checkin,
+			Checkout: b.Checkout,
+			BookedAt: current.CreatedAt.Time,
+		}
+		promo, err := db_promo.RecheckTx(ctx, q, b.Id, stay)
+		if err != nil {
+			return err
+		}
+		if promo == nil {
+			b.PromoCode, b.Discount = "", 0
+			promoDropped = true
+		}
+	}
+	switch {
+	case len(current.Segments) > 0:
+		// Цена брони с переездами складывается из тарифов отрезков, снятая скидка возвращается в цену
+		if promoDropped {
+			b.TotalPrice += current.Discount
+		}
+	case stayChanged || promoDropped || b.TotalPrice <= 0:
+		if err := b.applyCompanyRate(ctx, q, room); err != nil {
+			return err
+		}
+		b.calculatePrice(room)
+		if b.PromoCode != "" {
+			if b.Discount, err = db_promo.RepriceTx(ctx, q, b.Id, b.TotalPrice); err != nil {
+				return err
+			}
+			b.TotalPrice -= b.Discount
+		}
+	}
+
+	editQ := `UPDATE Bookings
+		SET room_id = $1, check_in_date = $2, check_out_date = $3, total_price = $4, notes = $5,
+			adults = $6, children = $7, child_ages = $8, requested_arrival_time = $9, requested_departure_time = $10,
+			exempt_guests = $11, discount = $12, company_id = $13, promo_code = NULLIF($14, '')
+		WHERE id = $15 AND status IN ($16, $17, $18)`
+
+	tag, err := q.Exec(ctx, editQ, b.RoomId, b.Checkin, b.Checkout, b.TotalPrice, b.Notes,
+		b.Adults, b.Children, b.ChildAges, b.RequestedArrival, b.RequestedDeparture, b.ExemptGuests, b.Discount,
+		b.CompanyId, b.PromoCode, b.Id, Tentative, Confirmed, CheckedIn)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New(data.BookingNotFound)
+	}
+
+	// Сумма и даты брони могли измениться - график предоплаты строится заново
+	b.GroupId = current.GroupId
+	if err := b.scheduleDepositsTx(ctx, q, current.CreatedAt.Time); err != nil {
+		return err
+	}
+
+	return b.saveOccupants(ctx, q)
 }
 
-func (b *Bookings) Get(db *pgxpool.Pool) ([]Bookings, error) {
+func (b *Bookings) Edit(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := b.EditTx(ctx, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (b *Bookings) CancelTx(ctx context.Context, q storage.Querier) error {
+	cancelQ := "UPDATE Bookings SET status = $1 WHERE id = $2 AND status IN ($3, $4)"
+
+	tag, err := q.Exec(ctx, cancelQ, Cancelled, b.Id, Tentative, Confirmed)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New(data.BookingNotFound)
+	}
+	b.Status = Cancelled
+
+	// Промокод отменённой брони снова доступен в пределах лимитов
+	return db_promo.ReleaseTx(ctx, q, b.Id)
+}
+
+func (b *Bookings) Cancel(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := b.CancelTx(ctx, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// CheckInTx заселяет гостя: бронь переходит в проживание, номер - в занятые
+func (b *Bookings) CheckInTx(ctx context.Context, q storage.Querier) error {
+	checkInQ := "UPDATE Bookings SET status = $1, actual_arrival = now() WHERE id = $2 AND status = $3 RETURNING room_id, actual_arrival"
+	if err := q.QueryRow(ctx, checkInQ, CheckedIn, b.Id, Confirmed).Scan(&b.RoomId, &b.ActualArrival); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New(data.BookingNotFound)
+		}
+		return err
+	}
+	b.Status = CheckedIn
+
+	// При запланированном переезде гость заселяется в номер первого сегмента
+	var firstRoomId int
+	err := q.QueryRow(ctx, "SELECT room_id FROM BookingSegments WHERE booking_id = $1 ORDER BY date_from LIMIT 1", b.Id).Scan(&firstRoomId)
+	if err == nil {
+		b.RoomId = firstRoomId
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	return db_rooms.SetStatusTx(ctx, q, b.RoomId, db_rooms.Occupied)
+}
+
+func (b *Bookings) CheckIn(db *pgxpool.Pool) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	getBookingQ := "SELECT id, client_id, room_id, check_in_date, check_out_date, total_price, notes FROM Bookings"
-	rows, err := db.Query(ctx, getBookingQ)
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := b.CheckInTx(ctx, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// CheckOutTx выселяет гостя, номер уходит на уборку, счета закрываются.
+// Выезд с ненулевым балансом возможен только с разрешения менеджера
+// (overrideBy - его имя, фиксируется в уведомлениях для персонала)
+func (b *Bookings) CheckOutTx(ctx context.Context, q storage.Querier, overrideBy string) error {
+	balance, err := db_folio.BookingBalanceTx(ctx, q, b.Id)
+	if err != nil {
+		return err
+	}
+	if balance != 0 {
+		if overrideBy == "" {
+			return errors.New(data.BalanceNotZero)
+		}
+		message := fmt.Sprintf("Бронь #%d: выезд с балансом %s разрешил %s", b.Id, balance, overrideBy)
+		if err := db_notifications.Notify(ctx, q, "Выезд с долгом", message); err != nil {
+			return err
+		}
+	}
+
+	checkOutQ := "UPDATE Bookings SET status = $1, actual_departure = now() WHERE id = $2 AND status = $3 RETURNING room_id, actual_departure"
+	if err := q.QueryRow(ctx, checkOutQ, CheckedOut, b.Id, CheckedIn).Scan(&b.RoomId, &b.ActualDeparture); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New(data.BookingNotFound)
+		}
+		return err
+	}
+	b.Status = CheckedOut
+
+	if err := db_rooms.SetStatusTx(ctx, q, b.RoomId, db_rooms.Cleaning); err != nil {
+		return err
+	}
+	if err := db_folio.CloseTx(ctx, q, b.Id); err != nil {
+		return err
+	}
+
+	settings, err := db_property.GetTx(ctx, q, false)
+	if err != nil {
+		return err
+	}
+	task := db_rooms.HousekeepingTasks{
+		RoomId:    b.RoomId,
+		BookingId: &b.Id,
+		TaskType:  db_rooms.TaskDepartureClean,
+		DueDate:   settings.BusinessDate,
+	}
+	return task.CreateTx(ctx, q)
+}
+
+func (b *Bookings) CheckOut(db *pgxpool.Pool, overrideBy string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := b.CheckOutTx(ctx, tx, overrideBy); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func GetByIDTx(ctx context.Context, q storage.Querier, id int) (*Bookings, error) {
+	bookings, err := QueryList(ctx, q, "WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(bookings) == 0 {
+		return nil, errors.New(data.BookingNotFound)
+	}
+
+	return &bookings[0], nil
+}
+
+func GetByID(db *pgxpool.Pool, id int) (*Bookings, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return GetByIDTx(ctx, db, id)
+}
+
+// QueryList выполняет выборку броней с произвольным условием
+func QueryList(ctx context.Context, q storage.Querier, where string, args ...interface{}) ([]Bookings, error) {
+	rows, err := q.Query(ctx, selectBookingQ+" "+where, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+
 	var bookings []Bookings
 	for rows.Next() {
 		var booking Bookings
-		if err := rows.Scan(
-			&booking.Id,
-			&booking.ClientId,
-			&booking.RoomId,
-			&booking.Checkin,
-			&booking.Checkout,
-			&booking.TotalPrice,
-		); err != nil {
+		if err := scanBooking(rows, &booking); err != nil {
 			return nil, err
 		}
 		bookings = append(bookings, booking)
@@ -65,6 +880,21 @@ func (b *Bookings) Get(db *pgxpool.Pool) ([]Bookings, error) {
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	rows.Close()
+
+	if err := loadOccupants(ctx, q, bookings); err != nil {
+		return nil, err
+	}
+	if err := loadSegments(ctx, q, bookings); err != nil {
+		return nil, err
+	}
 
 	return bookings, nil
 }
+
+func (b *Bookings) Get(db *pgxpool.Pool) ([]Bookings, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return QueryList(ctx, db, "ORDER BY id")
+}
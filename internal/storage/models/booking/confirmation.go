@@ -0,0 +1,165 @@
+package db_booking
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Алфавит без похожих символов (0/O, 1/I/L), чтобы код было легко продиктовать
+const confirmationAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+const confirmationLength = 8
+
+func randomConfirmationCode() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(confirmationAlphabet)))
+	for i := 0; i < confirmationLength; i++ {
+		if i == confirmationLength/2 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(confirmationAlphabet[n.Int64()])
+	}
+
+	return b.String(), nil
+}
+
+// NormalizeConfirmationCode приводит введённый код к виду XXXX-XXXX
+func NormalizeConfirmationCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	if len(code) != confirmationLength {
+		return code
+	}
+	return code[:confirmationLength/2] + "-" + code[confirmationLength/2:]
+}
+
+// Генерация уникального кода подтверждения. Проверяем заранее, а не ловим
+// нарушение уникальности, чтобы не ломать внешнюю транзакцию
+func (b *Bookings) generateConfirmationCode(ctx context.Context, q storage.Querier) error {
+	for attempt := 0; attempt < 5; attempt++ {
+		code, err := randomConfirmationCode()
+		if err != nil {
+			return err
+		}
+
+		var exists bool
+		if err := q.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM Bookings WHERE confirmation_code = $1)", code).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			b.ConfirmationCode = code
+			return nil
+		}
+	}
+
+	return errors.New("failed to generate unique confirmation code")
+}
+
+// Окончания отчеств, в том числе в латинском написании
+var patronymicSuffixes = []string{"ович", "евич", "ич", "овна", "евна", "ична", "ovich", "evich", "ovna", "evna", "ichna"}
+
+func looksPatronymic(word string) bool {
+	word = strings.ToLower(word)
+	for _, suffix := range patronymicSuffixes {
+		if len(word) > len(suffix) && strings.HasSuffix(word, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// patronymicIndex - позиция отчества в имени из трёх и более слов: первое слово
+// с окончанием отчества сразу после слова без него (после личного имени).
+// Так "Шостакович Дмитрий Дмитриевич" и "Дмитрий Дмитриевич Шостакович"
+// разбираются одинаково. -1 - отчества нет
+func patronymicIndex(parts []string) int {
+	if len(parts) < 3 {
+		return -1
+	}
+	for i := 1; i < len(parts); i++ {
+		if looksPatronymic(parts[i]) && !looksPatronymic(parts[i-1]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// surnameMatches ищет фамилию среди слов полного имени без учёта регистра:
+// имя может быть записано с фамилией в начале или в конце, фамилия из
+// нескольких слов должна совпасть подряд идущими словами. Отчество фамилией
+// не считается
+func surnameMatches(fullName, surname string) bool {
+	parts := strings.Fields(fullName)
+	wanted := strings.Fields(surname)
+	if len(wanted) == 0 {
+		return false
+	}
+	patronymic := patronymicIndex(parts)
+
+	for i := 0; i+len(wanted) <= len(parts); i++ {
+		if patronymic >= i && patronymic < i+len(wanted) {
+			continue
+		}
+		matched := true
+		for j, word := range wanted {
+			if !strings.EqualFold(parts[i+j], word) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// FindByConfirmation ищет бронь по коду подтверждения и фамилии гостя -
+// владельца брони или одного из проживающих
+func FindByConfirmation(db *pgxpool.Pool, code, surname string) (*Bookings, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	surname = strings.TrimSpace(surname)
+	if surname == "" {
+		return nil, errors.New(data.BookingNotFound)
+	}
+
+	bookings, err := QueryList(ctx, db, "WHERE confirmation_code = $1", NormalizeConfirmationCode(code))
+	if err != nil {
+		return nil, err
+	}
+	if len(bookings) == 0 {
+		return nil, errors.New(data.BookingNotFound)
+	}
+	booking := &bookings[0]
+
+	var clientName string
+	if err := db.QueryRow(ctx, "SELECT full_name FROM Clients WHERE id = $1", booking.ClientId).Scan(&clientName); err != nil {
+		return nil, err
+	}
+
+	names := []string{clientName}
+	for _, occupant := range booking.Occupants {
+		names = append(names, occupant.FullName)
+	}
+	for _, name := range names {
+		if surnameMatches(name, surname) {
+			return booking, nil
+		}
+	}
+
+	return nil, errors.New(data.BookingNotFound)
+}
@@ -0,0 +1,86 @@
+package db_booking
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeConfirmationCode(t *testing.T) {
+	tests := map[string]string{
+		"ABCD-2345":    "ABCD-2345",
+		"abcd2345":     "ABCD-2345",
+		" ab cd-23 45": "ABCD-2345",
+		"abc-234":      "ABC234",
+		"ABCD-23456":   "ABCD23456",
+		"":             "",
+	}
+
+	for code, want := range tests {
+		if got := NormalizeConfirmationCode(code); got != want {
+			t.Errorf("NormalizeConfirmationCode(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+func TestRandomConfirmationCode(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		code, err := randomConfirmationCode()
+		if err != nil {
+			t.Fatalf("randomConfirmationCode() error: %v", err)
+		}
+		if len(code) != confirmationLength+1 || code[confirmationLength/2] != '-' {
+			t.Fatalf("randomConfirmationCode() = %q, want XXXX-XXXX", code)
+		}
+		if NormalizeConfirmationCode(strings.ToLower(code)) != code {
+			t.Fatalf("code %q does not survive normalization", code)
+		}
+		for _, r := range strings.Replace(code, "-", "", 1) {
+			if !strings.ContainsRune(confirmationAlphabet, r) {
+				t.Fatalf("code %q contains %q outside the alphabet", code, r)
+			}
+		}
+	}
+}
+
+func TestSurnameMatches(t *testing.T) {
+	tests := []struct {
+		fullName string
+		surname  string
+		want     bool
+	}{
+		{fullName: "Ivan Petrov", surname: "Petrov", want: true},
+		{fullName: "Ivan Petrov", surname: "petrov", want: true},
+		{fullName: "Ivan  Petrov ", surname: "PETROV", want: true},
+		{fullName: "Petrov Ivan", surname: "Petrov", want: true},
+		{fullName: "Anna Maria Schmidt", surname: "Schmidt", want: true},
+		{fullName: "Petrov", surname: "Petrov", want: true},
+		{fullName: "Ivan Petrov", surname: "Petro", want: false},
+		{fullName: "Ivan Petrov", surname: "Sidorov", want: false},
+		{fullName: "", surname: "Petrov", want: false},
+		{fullName: "Ivan Petrov", surname: "  ", want: false},
+		// Фамилия первой, с отчеством
+		{fullName: "Иванов Иван Иванович", surname: "Иванов", want: true},
+		{fullName: "Иванов Иван Иванович", surname: "иванов", want: true},
+		{fullName: "Иванов Иван Иванович", surname: "Иванович", want: false},
+		{fullName: "Иван Иванович Иванов", surname: "Иванов", want: true},
+		{fullName: "Иван Иванович Иванов", surname: "Иванович", want: false},
+		{fullName: "Петрова Анна Сергеевна", surname: "Сергеевна", want: false},
+		{fullName: "Petrova Anna Sergeevna", surname: "Petrova", want: true},
+		// Фамилия с окончанием отчества
+		{fullName: "Шостакович Дмитрий Дмитриевич", surname: "Шостакович", want: true},
+		{fullName: "Дмитрий Дмитриевич Шостакович", surname: "Шостакович", want: true},
+		{fullName: "Иван Бабич", surname: "Бабич", want: true},
+		// Фамилия из нескольких слов
+		{fullName: "Gabriel Garcia Marquez", surname: "Garcia Marquez", want: true},
+		{fullName: "Garcia Marquez Gabriel", surname: "garcia  marquez", want: true},
+		{fullName: "Gabriel Garcia Marquez", surname: "Marquez Garcia", want: false},
+		{fullName: "Мамин-Сибиряк Дмитрий Наркисович", surname: "Мамин-Сибиряк", want: true},
+		{fullName: "Мамин-Сибиряк Дмитрий Наркисович", surname: "Мамин", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := surnameMatches(tt.fullName, tt.surname); got != tt.want {
+			t.Errorf("surnameMatches(%q, %q) = %v, want %v", tt.fullName, tt.surname, got, tt.want)
+		}
+	}
+}
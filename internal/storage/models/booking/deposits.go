@@ -0,0 +1,542 @@
+package db_booking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_folio "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/folio"
+	db_notifications "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/notifications"
+	db_property "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/property"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// Deposit due date anchors
+	AnchorBooking = "booking" // Через DueDays дней после бронирования
+	AnchorArrival = "arrival" // За DueDays дней до заезда
+
+	// Deposit statuses
+	DepositPaid    = "paid"
+	DepositDue     = "due"
+	DepositOverdue = "overdue"
+)
+
+// DepositPolicies - правило тарифа о предоплате. К брони применяется правило
+// с наибольшим MinNights, подходящее по длине проживания; правила для групп
+// имеют приоритет для групповых броней. AutoCancel отменяет предварительную
+// (tentative) бронь, если этап не оплачен через GraceDays дней после срока
+type DepositPolicies struct {
+	Id         int             `json:"id"`
+	Name       string          `json:"name"`
+	MinNights  int             `json:"min_nights"`
+	GroupsOnly bool            `json:"groups_only"`
+	Stages     []DepositStages `json:"stages"`
+	GraceDays  int             `json:"grace_days"`
+	AutoCancel bool            `json:"auto_cancel"`
+	Active     bool            `json:"active"`
+}
+
+// DepositStages - этап предоплаты: процент от стоимости брони и срок
+type DepositStages struct {
+	Percent money.Decimal `json:"percent"`
+	DueDays int           `json:"due_days"`
+	Anchor  string        `json:"anchor"`
+}
+
+// Deposits - этап графика предоплаты брони. Paid - сколько из оплат по счетам
+// брони приходится на этап (оплаты гасят этапы по порядку сроков)
+type Deposits struct {
+	Id        int           `json:"id"`
+	BookingId int           `json:"booking_id"`
+	DueDate   pgtype.Date   `json:"due_date"`
+	Amount    money.Decimal `json:"amount"`
+	Paid      money.Decimal `json:"paid"`
+	Status    string        `json:"status"`
+}
+
+// OverdueDeposits - просроченный этап предоплаты для списка на ресепшене
+type OverdueDeposits struct {
+	Deposits
+	ClientName    string        `json:"client_name"`
+	BookingStatus string        `json:"booking_status"`
+	Checkin       pgtype.Date   `json:"check_in_date"`
+	Outstanding   money.Decimal `json:"outstanding"`
+	DaysOverdue   int           `json:"days_overdue"`
+	// Дата автоматической отмены (для предварительных броней по правилу с AutoCancel)
+	AutoCancelOn pgtype.Date `json:"auto_cancel_on"`
+}
+
+const selectDepositPoliciesQ = `SELECT id, name, min_nights, groups_only, stages, grace_days, auto_cancel, active
+	FROM DepositPolicies`
+
+func scanDepositPolicy(row pgx.Row, p *DepositPolicies) error {
+	return row.Scan(&p.Id, &p.Name, &p.MinNights, &p.GroupsOnly, &p.Stages, &p.GraceDays, &p.AutoCancel, &p.Active)
+}
+
+func (p *DepositPolicies) validate() error {
+	if p.Name == "" || p.MinNights < 0 || p.GraceDays < 0 || len(p.Stages) == 0 {
+		return errors.New(data.WrongData)
+	}
+
+	var total money.Decimal
+	for _, stage := range p.Stages {
+		if stage.Percent <= 0 || stage.DueDays < 0 {
+			return errors.New(data.WrongData)
+		}
+		if stage.Anchor != AnchorBooking && stage.Anchor != AnchorArrival {
+			return errors.New(data.WrongData)
+		}
+		total += stage.Percent
+	}
+	if total > money.Units(100) {
+		return errors.New(data.WrongData)
+	}
+
+	return nil
+}
+
+func (p *DepositPolicies) Create(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := p.validate(); err != nil {
+		return err
+	}
+
+	return db.QueryRow(ctx, `INSERT INTO DepositPolicies(name, min_nights, groups_only, stages, grace_days, auto_cancel, active)
+		VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		p.Name, p.MinNights, p.GroupsOnly, p.Stages, p.GraceDays, p.AutoCancel, p.Active).Scan(&p.Id)
+}
+
+// Edit меняет правило. Графики уже созданных броней пересчитываются при их изменении
+func (p *DepositPolicies) Edit(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := p.validate(); err != nil {
+		return err
+	}
+
+	tag, err := db.Exec(ctx, `UPDATE DepositPolicies SET name = $1, min_nights = $2, groups_only = $3, stages = $4,
+			grace_days = $5, auto_cancel = $6, active = $7
+		WHERE id = $8`,
+		p.Name, p.MinNights, p.GroupsOnly, p.Stages, p.GraceDays, p.AutoCancel, p.Active, p.Id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New(data.PolicyNotFound)
+	}
+
+	return nil
+}
+
+func GetDepositPolicies(db *pgxpool.Pool) ([]DepositPolicies, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.Query(ctx, selectDepositPoliciesQ+" ORDER BY min_nights, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var policies []DepositPolicies
+	for rows.Next() {
+		var policy DepositPolicies
+		if err := scanDepositPolicy(rows, &policy); err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+
+	return policies, rows.Err()
+}
+
+// Срок этапа не раньше даты бронирования и не позже заезда
+func (s DepositStages) dueDate(bookedOn, checkin time.Time) time.Time {
+	due := bookedOn.AddDate(0, 0, s.DueDays)
+	if s.Anchor == AnchorArrival {
+		due = checkin.AddDate(0, 0, -s.DueDays)
+	}
+	if due.Before(bookedOn) {
+		return bookedOn
+	}
+	if due.After(checkin) {
+		return checkin
+	}
+	return due
+}
+
+// scheduleDepositsTx строит график предоплаты брони по подходящему правилу.
+// График, заданный вручную, не перестраивается
+func (b *Bookings) scheduleDepositsTx(ctx context.Context, q storage.Querier, createdAt time.Time) error {
+	year, month, day := createdAt.Date()
+	bookedOn := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+
+	var manual bool
+	if err := q.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM BookingDeposits WHERE booking_id = $1 AND policy_id IS NULL)",
+		b.Id).Scan(&manual); err != nil {
+		return err
+	}
+	if manual {
+		return nil
+	}
+	if _, err := q.Exec(ctx, "DELETE FROM BookingDeposits WHERE booking_id = $1", b.Id); err != nil {
+		return err
+	}
+
+	var policy DepositPolicies
+	err := scanDepositPolicy(q.QueryRow(ctx, selectDepositPoliciesQ+`
+		WHERE active AND min_nights <= $1 AND (NOT groups_only OR $2)
+		ORDER BY groups_only DESC, min_nights DESC, id LIMIT 1`, b.Nights(), b.GroupId != nil), &policy)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, deposit := range policy.schedule(b.TotalPrice, bookedOn, b.Checkin.Time) {
+		if _, err := q.Exec(ctx, "INSERT INTO BookingDeposits(booking_id, policy_id, due_date, amount) VALUES($1, $2, $3, $4)",
+			b.Id, policy.Id, deposit.DueDate, deposit.Amount); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// schedule раскладывает стоимость брони по этапам правила. Этапы с нулевой
+// суммой пропускаются
+func (p *DepositPolicies) schedule(total money.Decimal, bookedOn, checkin time.Time) []Deposits {
+	var deposits []Deposits
+	var percents, scheduled money.Decimal
+	for i, stage := range p.Stages {
+		percents += stage.Percent
+		amount := total.Percent(stage.Percent)
+		// Последний этап правила на 100% добирает остаток после округлений
+		if i == len(p.Stages)-1 && percents == money.Units(100) {
+			amount = total - scheduled
+		}
+		scheduled += amount
+		if amount <= 0 {
+			continue
+		}
+
+		deposits = append(deposits, Deposits{
+			DueDate: pgtype.Date{Time: stage.dueDate(bookedOn, checkin), Status: pgtype.Present},
+			Amount:  amount,
+		})
+	}
+
+	return deposits
+}
+
+// SetDeposits заменяет график предоплаты брони графиком, заданным вручную
+func SetDeposits(db *pgxpool.Pool, bookingId int, deposits []Deposits) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, deposit := range deposits {
+		if deposit.Amount <= 0 || deposit.DueDate.Status != pgtype.Present {
+			return errors.New(data.WrongData)
+		}
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := GetByIDTx(ctx, tx, bookingId); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM BookingDeposits WHERE booking_id = $1", bookingId); err != nil {
+		return err
+	}
+	for _, deposit := range deposits {
+		if _, err := tx.Exec(ctx, "INSERT INTO BookingDeposits(booking_id, due_date, amount) VALUES($1, $2, $3)",
+			bookingId, deposit.DueDate, deposit.Amount); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// loadDepositsTx возвращает графики броней с распределёнными оплатами.
+// Оплаты за вычетом возвратов по всем счетам брони гасят этапы по порядку сроков
+func loadDepositsTx(ctx context.Context, q storage.Querier, today time.Time, bookingIds []int) (map[int][]Deposits, error) {
+	rows, err := q.Query(ctx, `SELECT d.id, d.booking_id, d.due_date, d.amount,
+			(SELECT COALESCE(-sum(fc.amount), 0) FROM FolioCharges fc JOIN Folios f ON f.id = fc.folio_id
+				WHERE f.booking_id = d.booking_id AND fc.entry_type IN ($2, $3))
+		FROM BookingDeposits d WHERE d.booking_id = ANY($1)
+		ORDER BY d.booking_id, d.due_date, d.id`, bookingIds, db_folio.EntryPayment, db_folio.EntryRefund)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := make(map[int][]Deposits)
+	paid := make(map[int]money.Decimal)
+	for rows.Next() {
+		var deposit Deposits
+		var bookingPaid money.Decimal
+		if err := rows.Scan(&deposit.Id, &deposit.BookingId, &deposit.DueDate, &deposit.Amount, &bookingPaid); err != nil {
+			return nil, err
+		}
+		paid[deposit.BookingId] = bookingPaid
+		schedules[deposit.BookingId] = append(schedules[deposit.BookingId], deposit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for bookingId, deposits := range schedules {
+		allocatePayments(deposits, paid[bookingId], today)
+	}
+
+	return schedules, nil
+}
+
+// allocatePayments гасит этапы графика (по порядку сроков) оплатами брони
+// и выставляет статусы этапов на дату today
+func allocatePayments(deposits []Deposits, paid money.Decimal, today time.Time) {
+	for i := range deposits {
+		deposit := &deposits[i]
+
+		deposit.Paid = paid
+		if deposit.Paid > deposit.Amount {
+			deposit.Paid = deposit.Amount
+		}
+		if deposit.Paid < 0 {
+			deposit.Paid = 0
+		}
+		paid -= deposit.Paid
+
+		switch {
+		case deposit.Paid >= deposit.Amount:
+			deposit.Status = DepositPaid
+		case deposit.DueDate.Time.Before(today):
+			deposit.Status = DepositOverdue
+		default:
+			deposit.Status = DepositDue
+		}
+	}
+}
+
+// ConfirmTx подтверждает предварительную бронь
+func (b *Bookings) ConfirmTx(ctx context.Context, q storage.Querier) error {
+	tag, err := q.Exec(ctx, "UPDATE Bookings SET status = $1 WHERE id = $2 AND status = $3", Confirmed, b.Id, Tentative)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New(data.BookingNotFound)
+	}
+	b.Status = Confirmed
+
+	return nil
+}
+
+// Confirm подтверждает предварительную бронь вручную, например при гарантии без предоплаты
+func (b *Bookings) Confirm(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return b.ConfirmTx(ctx, db)
+}
+
+// GetDeposits - график предоплаты брони с оплаченными суммами
+func GetDeposits(db *pgxpool.Pool, bookingId int) ([]Deposits, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	settings, err := db_property.GetTx(ctx, db, false)
+	if err != nil {
+		return nil, err
+	}
+	schedules, err := loadDepositsTx(ctx, db, settings.BusinessDate.Time, []int{bookingId})
+	if err != nil {
+		return nil, err
+	}
+	if schedules[bookingId] == nil {
+		return []Deposits{}, nil
+	}
+
+	return schedules[bookingId], nil
+}
+
+// overdueDepositsTx - просроченные этапы действующих броней на операционный день
+func overdueDepositsTx(ctx context.Context, q storage.Querier, today time.Time) ([]OverdueDeposits, error) {
+	rows, err := q.Query(ctx, `SELECT b.id, c.full_name, b.status, b.check_in_date,
+			COALESCE(max(p.grace_days) FILTER (WHERE p.auto_cancel), -1)
+		FROM Bookings b
+		JOIN Clients c ON c.id = b.client_id
+		JOIN BookingDeposits d ON d.booking_id = b.id
+		LEFT JOIN DepositPolicies p ON p.id = d.policy_id
+		WHERE b.status IN ($1, $2, $3) AND d.due_date < $4
+		GROUP BY b.id, c.full_name
+		ORDER BY b.id`, Tentative, Confirmed, CheckedIn, today)
+	if err != nil {
+		return nil, err
+	}
+
+	type candidate struct {
+		clientName string
+		status     string
+		checkin    pgtype.Date
+		graceDays  int
+	}
+	candidates := make(map[int]candidate)
+	var ids []int
+	for rows.Next() {
+		var id int
+		var c candidate
+		if err := rows.Scan(&id, &c.clientName, &c.status, &c.checkin, &c.graceDays); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates[id] = c
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []OverdueDeposits{}, nil
+	}
+
+	schedules, err := loadDepositsTx(ctx, q, today, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	overdue := []OverdueDeposits{}
+	for _, id := range ids {
+		c := candidates[id]
+		for _, deposit := range schedules[id] {
+			if deposit.Status != DepositOverdue {
+				continue
+			}
+			item := OverdueDeposits{
+				Deposits:      deposit,
+				ClientName:    c.clientName,
+				BookingStatus: c.status,
+				Checkin:       c.checkin,
+				Outstanding:   deposit.Amount - deposit.Paid,
+				DaysOverdue:   int(today.Sub(deposit.DueDate.Time).Hours() / 24),
+			}
+			if c.status == Tentative && c.graceDays >= 0 {
+				item.AutoCancelOn = pgtype.Date{Time: deposit.DueDate.Time.AddDate(0, 0, c.graceDays+1), Status: pgtype.Present}
+			}
+			overdue = append(overdue, item)
+		}
+	}
+
+	return overdue, nil
+}
+
+// GetOverdueDeposits - список просроченных предоплат на текущий операционный день
+func GetOverdueDeposits(db *pgxpool.Pool) ([]OverdueDeposits, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	settings, err := db_property.GetTx(ctx, db, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return overdueDepositsTx(ctx, db, settings.BusinessDate.Time)
+}
+
+// ProcessDeposits подтверждает предварительные брони с оплаченным первым
+// этапом предоплаты и отменяет те, у которых истёк льготный срок по правилу с AutoCancel
+func ProcessDeposits(ctx context.Context, db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	settings, err := db_property.GetTx(ctx, tx, false)
+	if err != nil {
+		return err
+	}
+	today := settings.BusinessDate.Time
+
+	var tentative []int
+	rows, err := tx.Query(ctx, "SELECT id FROM Bookings WHERE status = $1 ORDER BY id FOR UPDATE", Tentative)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		tentative = append(tentative, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(tentative) == 0 {
+		return nil
+	}
+
+	schedules, err := loadDepositsTx(ctx, tx, today, tentative)
+	if err != nil {
+		return err
+	}
+	for _, id := range tentative {
+		if schedule := schedules[id]; len(schedule) > 0 && schedule[0].Status == DepositPaid {
+			booking := Bookings{Id: id}
+			if err := booking.ConfirmTx(ctx, tx); err != nil {
+				return err
+			}
+		}
+	}
+
+	overdue, err := overdueDepositsTx(ctx, tx, today)
+	if err != nil {
+		return err
+	}
+	cancelled := make(map[int]bool)
+	for _, item := range overdue {
+		if item.BookingStatus != Tentative || item.AutoCancelOn.Status != pgtype.Present || cancelled[item.BookingId] {
+			continue
+		}
+		if today.Before(item.AutoCancelOn.Time) {
+			continue
+		}
+
+		booking := Bookings{Id: item.BookingId}
+		if err := booking.CancelTx(ctx, tx); err != nil {
+			return err
+		}
+		cancelled[item.BookingId] = true
+
+		message := fmt.Sprintf("Бронь #%d (%s) отменена: предоплата %s со сроком %s не внесена",
+			item.BookingId, item.ClientName, item.Outstanding, item.DueDate.Time.Format("02.01.2006"))
+		if err := db_notifications.Notify(ctx, tx, "Отмена без предоплаты", message); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
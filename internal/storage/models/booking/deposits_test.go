@@ -0,0 +1,136 @@
+package db_booking
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/jackc/pgtype"
+)
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestDepositDueDate(t *testing.T) {
+	bookedOn := day(2026, 10, 1)
+	checkin := day(2026, 10, 20)
+
+	tests := []struct {
+		stage DepositStages
+		want  time.Time
+	}{
+		{stage: DepositStages{Anchor: AnchorBooking, DueDays: 0}, want: bookedOn},
+		{stage: DepositStages{Anchor: AnchorBooking, DueDays: 3}, want: day(2026, 10, 4)},
+		{stage: DepositStages{Anchor: AnchorBooking, DueDays: 30}, want: checkin},
+		{stage: DepositStages{Anchor: AnchorArrival, DueDays: 0}, want: checkin},
+		{stage: DepositStages{Anchor: AnchorArrival, DueDays: 7}, want: day(2026, 10, 13)},
+		{stage: DepositStages{Anchor: AnchorArrival, DueDays: 30}, want: bookedOn},
+	}
+
+	for _, tt := range tests {
+		if got := tt.stage.dueDate(bookedOn, checkin); !got.Equal(tt.want) {
+			t.Errorf("dueDate(%s, %d) = %s, want %s", tt.stage.Anchor, tt.stage.DueDays, got.Format(time.DateOnly), tt.want.Format(time.DateOnly))
+		}
+	}
+}
+
+func TestDepositSchedule(t *testing.T) {
+	bookedOn := day(2026, 10, 1)
+	checkin := day(2026, 10, 20)
+	due := func(t time.Time) pgtype.Date { return pgtype.Date{Time: t, Status: pgtype.Present} }
+
+	tests := []struct {
+		name   string
+		stages []DepositStages
+		total  money.Decimal
+		want   []Deposits
+	}{
+		{
+			name: "last stage takes the rounding remainder",
+			stages: []DepositStages{
+				{Percent: money.Units(33), Anchor: AnchorBooking, DueDays: 0},
+				{Percent: money.Units(67), Anchor: AnchorArrival, DueDays: 7},
+			},
+			total: money.Decimal(10001),
+			want: []Deposits{
+				{DueDate: due(bookedOn), Amount: money.Decimal(3300)},
+				{DueDate: due(day(2026, 10, 13)), Amount: money.Decimal(6701)},
+			},
+		},
+		{
+			name:   "partial policy is not topped up",
+			stages: []DepositStages{{Percent: money.Units(30), Anchor: AnchorBooking, DueDays: 2}},
+			total:  money.Units(1000),
+			want:   []Deposits{{DueDate: due(day(2026, 10, 3)), Amount: money.Units(300)}},
+		},
+		{
+			name:   "zero total schedules nothing",
+			stages: []DepositStages{{Percent: money.Units(100), Anchor: AnchorBooking}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := DepositPolicies{Stages: tt.stages}
+			if got := policy.schedule(tt.total, bookedOn, checkin); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("schedule() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllocatePayments(t *testing.T) {
+	today := day(2026, 10, 10)
+	stages := func() []Deposits {
+		return []Deposits{
+			{DueDate: pgtype.Date{Time: day(2026, 10, 1), Status: pgtype.Present}, Amount: money.Units(300)},
+			{DueDate: pgtype.Date{Time: today, Status: pgtype.Present}, Amount: money.Units(200)},
+			{DueDate: pgtype.Date{Time: day(2026, 10, 15), Status: pgtype.Present}, Amount: money.Units(500)},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		paid       money.Decimal
+		wantPaid   []money.Decimal
+		wantStatus []string
+	}{
+		{
+			name:       "nothing paid",
+			wantPaid:   []money.Decimal{0, 0, 0},
+			wantStatus: []string{DepositOverdue, DepositDue, DepositDue},
+		},
+		{
+			name:       "payments settle the earliest stage first",
+			paid:       money.Units(400),
+			wantPaid:   []money.Decimal{money.Units(300), money.Units(100), 0},
+			wantStatus: []string{DepositPaid, DepositDue, DepositDue},
+		},
+		{
+			name:       "overpayment",
+			paid:       money.Units(1500),
+			wantPaid:   []money.Decimal{money.Units(300), money.Units(200), money.Units(500)},
+			wantStatus: []string{DepositPaid, DepositPaid, DepositPaid},
+		},
+		{
+			name:       "net refunds count as nothing paid",
+			paid:       money.Units(-100),
+			wantPaid:   []money.Decimal{0, 0, 0},
+			wantStatus: []string{DepositOverdue, DepositDue, DepositDue},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deposits := stages()
+			allocatePayments(deposits, tt.paid, today)
+			for i, deposit := range deposits {
+				if deposit.Paid != tt.wantPaid[i] || deposit.Status != tt.wantStatus[i] {
+					t.Errorf("stage %d = %s %s, want %s %s", i, deposit.Paid, deposit.Status, tt.wantPaid[i], tt.wantStatus[i])
+				}
+			}
+		})
+	}
+}
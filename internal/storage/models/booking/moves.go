@@ -0,0 +1,292 @@
+package db_booking
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_property "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/property"
+	db_rooms "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/rooms"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Segments - часть проживания в одном номере по своему тарифу. date_to не включается
+type Segments struct {
+	RoomId      int           `json:"room_id"`
+	DateFrom    pgtype.Date   `json:"date_from"`
+	DateTo      pgtype.Date   `json:"date_to"`
+	NightlyRate money.Decimal `json:"nightly_rate"`
+}
+
+// RoomMoves - переезд гостя в другой номер с указанной даты
+type RoomMoves struct {
+	Id          int                `json:"id"`
+	BookingId   int                `json:"booking_id"`
+	FromRoomId  int                `json:"from_room_id"`
+	ToRoomId    int                `json:"to_room_id"`
+	MoveDate    pgtype.Date        `json:"move_date"`
+	NightlyRate money.Decimal      `json:"nightly_rate"`
+	Reason      string             `json:"reason"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+}
+
+func segmentsTotal(segments []Segments) money.Decimal {
+	var total money.Decimal
+	for _, segment := range segments {
+		nights := int(segment.DateTo.Time.Sub(segment.DateFrom.Time).Hours() / 24)
+		total += segment.NightlyRate.Mul(nights)
+	}
+	return total
+}
+
+// wholeStaySegments делит проживание без переездов на сегменты по средней цене ночи.
+// Копейки округления уходят в отдельный сегмент последней ночи, чтобы сумма
+// сегментов совпадала с ценой брони
+func wholeStaySegments(b *Bookings) []Segments {
+	nights := b.Nights()
+	rate := b.TotalPrice.Div(nights)
+	remainder := b.TotalPrice - rate.Mul(nights)
+	if remainder == 0 || nights <= 1 {
+		return []Segments{{RoomId: b.RoomId, DateFrom: b.Checkin, DateTo: b.Checkout, NightlyRate: rate}}
+	}
+
+	lastNight := pgtype.Date{Time: b.Checkout.Time.AddDate(0, 0, -1), Status: pgtype.Present}
+	return []Segments{
+		{RoomId: b.RoomId, DateFrom: b.Checkin, DateTo: lastNight, NightlyRate: rate},
+		{RoomId: b.RoomId, DateFrom: lastNight, DateTo: b.Checkout, NightlyRate: rate + remainder},
+	}
+}
+
+// Подгрузка сегментов одним запросом для всех броней выборки
+func loadSegments(ctx context.Context, q storage.Querier, bookings []Bookings) error {
+	if len(bookings) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(bookings))
+	index := make(map[int]int, len(bookings))
+	for i := range bookings {
+		ids[i] = bookings[i].Id
+		index[bookings[i].Id] = i
+		bookings[i].Segments = []Segments{}
+	}
+
+	rows, err := q.Query(ctx, `SELECT booking_id, room_id, date_from, date_to, nightly_rate
+		FROM BookingSegments WHERE booking_id = ANY($1) ORDER BY booking_id, date_from`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bookingId int
+		var segment Segments
+		if err := rows.Scan(&bookingId, &segment.RoomId, &segment.DateFrom, &segment.DateTo, &segment.NightlyRate); err != nil {
+			return err
+		}
+		i := index[bookingId]
+		bookings[i].Segments = append(bookings[i].Segments, segment)
+	}
+
+	return rows.Err()
+}
+
+// MoveTx переселяет гостя в другой номер с даты MoveDate до выезда.
+// Бронь остаётся одной, проживание делится на сегменты со своим номером
+// и тарифом (нулевой тариф берётся из номера). Если переезд уже наступил
+// для проживающего гостя - меняются статусы номеров, иначе ставятся
+// задания горничным на дату переезда
+func (m *RoomMoves) MoveTx(ctx context.Context, q storage.Querier) error {
+	if m.MoveDate.Status != pgtype.Present || m.Reason == "" || m.NightlyRate < 0 {
+		return errors.New(data.WrongData)
+	}
+
+	if _, err := q.Exec(ctx, "SELECT id FROM Bookings WHERE id = $1 FOR UPDATE", m.BookingId); err != nil {
+		return err
+	}
+	booking, err := GetByIDTx(ctx, q, m.BookingId)
+	if err != nil {
+		return err
+	}
+	if booking.Status != Confirmed && booking.Status != CheckedIn {
+		return errors.New(data.BookingNotFound)
+	}
+	if m.MoveDate.Time.Before(booking.Checkin.Time) || !m.MoveDate.Time.Before(booking.Checkout.Time) {
+		return errors.New(data.WrongMoveDate)
+	}
+
+	segments := booking.Segments
+	if len(segments) == 0 {
+		segments = wholeStaySegments(booking)
+	}
+
+	// Сегменты до даты переезда сохраняются, сегмент с датой переезда обрезается
+	var kept []Segments
+	for _, segment := range segments {
+		if !segment.DateFrom.Time.Before(m.MoveDate.Time) {
+			if segment.DateFrom.Time.Equal(m.MoveDate.Time) {
+				m.FromRoomId = segment.RoomId
+			}
+			continue
+		}
+		if segment.DateTo.Time.After(m.MoveDate.Time) {
+			m.FromRoomId = segment.RoomId
+			segment.DateTo = m.MoveDate
+		}
+		kept = append(kept, segment)
+	}
+	if m.FromRoomId == m.ToRoomId {
+		return errors.New(data.WrongData)
+	}
+
+	room, err := db_rooms.GetRoomByIDTx(ctx, q, m.ToRoomId)
+	if err != nil {
+		return err
+	}
+	if room.MaxOccupancy > 0 && booking.Adults+booking.Children > room.MaxOccupancy {
+		return errors.New(data.OccupancyExceeded)
+	}
+	if err := CheckRoomAvailable(ctx, q, m.ToRoomId, booking.Id, m.MoveDate, booking.Checkout); err != nil {
+		return err
+	}
+
+	if m.NightlyRate == 0 {
+		m.NightlyRate = room.NightlyPrice(booking.Adults, booking.ChildAges)
+	}
+	segments = append(kept, Segments{
+		RoomId:      m.ToRoomId,
+		DateFrom:    m.MoveDate,
+		DateTo:      booking.Checkout,
+		NightlyRate: m.NightlyRate,
+	})
+
+	if _, err := q.Exec(ctx, "DELETE FROM BookingSegments WHERE booking_id = $1", booking.Id); err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		if _, err := q.Exec(ctx,
+			"INSERT INTO BookingSegments(booking_id, room_id, date_from, date_to, nightly_rate) VALUES($1, $2, $3, $4, $5)",
+			booking.Id, segment.RoomId, segment.DateFrom, segment.DateTo, segment.NightlyRate,
+		); err != nil {
+			return err
+		}
+	}
+
+	// room_id брони - номер, в котором гость живёт в конце проживания
+	if _, err := q.Exec(ctx, "UPDATE Bookings SET room_id = $1, total_price = $2 WHERE id = $3",
+		m.ToRoomId, segmentsTotal(segments), booking.Id); err != nil {
+		return err
+	}
+
+	moveQ := `INSERT INTO RoomMoves(booking_id, from_room_id, to_room_id, move_date, nightly_rate, reason)
+		VALUES($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
+	if err := q.QueryRow(ctx, moveQ,
+		m.BookingId, m.FromRoomId, m.ToRoomId, m.MoveDate, m.NightlyRate, m.Reason,
+	).Scan(&m.Id, &m.CreatedAt); err != nil {
+		return err
+	}
+
+	return m.updateRooms(ctx, q, booking)
+}
+
+func (m *RoomMoves) updateRooms(ctx context.Context, q storage.Querier, booking *Bookings) error {
+	settings, err := db_property.GetTx(ctx, q, false)
+	if err != nil {
+		return err
+	}
+	movedNow := booking.Status == CheckedIn && !m.MoveDate.Time.After(settings.BusinessDate.Time)
+
+	if movedNow {
+		if err := db_rooms.SetStatusTx(ctx, q, m.FromRoomId, db_rooms.Cleaning); err != nil {
+			return err
+		}
+		if err := db_rooms.SetStatusTx(ctx, q, m.ToRoomId, db_rooms.Occupied); err != nil {
+			return err
+		}
+	} else {
+		prepare := db_rooms.HousekeepingTasks{
+			RoomId:    m.ToRoomId,
+			BookingId: &booking.Id,
+			TaskType:  db_rooms.TaskPrepareRoom,
+			DueDate:   m.MoveDate,
+			Notes:     m.Reason,
+		}
+		if err := prepare.CreateTx(ctx, q); err != nil {
+			return err
+		}
+	}
+
+	// Старый номер нужно убрать, только если гость в нём успел пожить
+	if booking.Status == CheckedIn || m.MoveDate.Time.After(booking.Checkin.Time) {
+		clean := db_rooms.HousekeepingTasks{
+			RoomId:    m.FromRoomId,
+			BookingId: &booking.Id,
+			TaskType:  db_rooms.TaskDepartureClean,
+			DueDate:   m.MoveDate,
+			Notes:     m.Reason,
+		}
+		if err := clean.CreateTx(ctx, q); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *RoomMoves) Move(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := m.MoveTx(ctx, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetMoves возвращает историю переездов по брони
+func GetMoves(db *pgxpool.Pool, bookingId int) ([]RoomMoves, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.Query(ctx, `SELECT id, booking_id, from_room_id, to_room_id, move_date, nightly_rate, reason, created_at
+		FROM RoomMoves WHERE booking_id = $1 ORDER BY move_date, id`, bookingId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var moves []RoomMoves
+	for rows.Next() {
+		var move RoomMoves
+		if err := rows.Scan(
+			&move.Id,
+			&move.BookingId,
+			&move.FromRoomId,
+			&move.ToRoomId,
+			&move.MoveDate,
+			&move.NightlyRate,
+			&move.Reason,
+			&move.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		moves = append(moves, move)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return moves, nil
+}
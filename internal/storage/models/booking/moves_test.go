@@ -0,0 +1,60 @@
+package db_booking
+
+import (
+	"testing"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/jackc/pgtype"
+)
+
+func TestWholeStaySegments(t *testing.T) {
+	date := func(d int) pgtype.Date { return pgtype.Date{Time: day(2026, 10, d), Status: pgtype.Present} }
+
+	tests := []struct {
+		name     string
+		checkout int
+		total    money.Decimal
+		want     []Segments
+	}{
+		{
+			name: "even split", checkout: 4, total: money.Units(300),
+			want: []Segments{{RoomId: 7, DateFrom: date(1), DateTo: date(4), NightlyRate: money.Units(100)}},
+		},
+		{
+			name: "remainder on the last night", checkout: 4, total: money.Units(100),
+			want: []Segments{
+				{RoomId: 7, DateFrom: date(1), DateTo: date(3), NightlyRate: money.Decimal(3333)},
+				{RoomId: 7, DateFrom: date(3), DateTo: date(4), NightlyRate: money.Decimal(3334)},
+			},
+		},
+		{
+			name: "rounded up rate", checkout: 4, total: money.Units(200),
+			want: []Segments{
+				{RoomId: 7, DateFrom: date(1), DateTo: date(3), NightlyRate: money.Decimal(6667)},
+				{RoomId: 7, DateFrom: date(3), DateTo: date(4), NightlyRate: money.Decimal(6666)},
+			},
+		},
+		{
+			name: "single night", checkout: 2, total: money.Decimal(9999),
+			want: []Segments{{RoomId: 7, DateFrom: date(1), DateTo: date(2), NightlyRate: money.Decimal(9999)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			booking := Bookings{RoomId: 7, Checkin: date(1), Checkout: date(tt.checkout), TotalPrice: tt.total}
+			got := wholeStaySegments(&booking)
+			if len(got) != len(tt.want) {
+				t.Fatalf("wholeStaySegments() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("segment %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+			if total := segmentsTotal(got); total != tt.total {
+				t.Errorf("segmentsTotal() = %s, want %s", total, tt.total)
+			}
+		})
+	}
+}
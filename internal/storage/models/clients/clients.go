@@ -3,20 +3,43 @@ package db_clients
 import (
 	"context"
 	"errors"
-	"fmt"
+	"strings"
 	"time"
 
 	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 type Clients struct {
-	Id        int    `json:"id"`
-	FullName  string `json:"full_name"`
-	Email     string `json:"email"`
-	Phone     string `json:"phone"`
-	Notes     string `json:"notes"`
-	CreatedAt string `json:"created_at"`
+	Id        int      `json:"id"`
+	FullName  string   `json:"full_name"`
+	Email     string   `json:"email"`
+	Phone     string   `json:"phone"`
+	Notes     string   `json:"notes"`
+	Tags      []string `json:"tags"`
+	CreatedAt string   `json:"created_at"`
+}
+
+const selectClientsQ = "SELECT id, full_name, email, phone, notes, tags, created_at::text FROM Clients"
+
+func scanClient(row pgx.Row, c *Clients) error {
+	return row.Scan(&c.Id, &c.FullName, &c.Email, &c.Phone, &c.Notes, &c.Tags, &c.CreatedAt)
+}
+
+// NormalizeTags приводит метки к нижнему регистру и убирает пустые и повторы
+func NormalizeTags(tags []string) []string {
+	normalized := []string{}
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
 }
 
 func (c *Clients) checkClientExist(db *pgxpool.Pool) bool {
@@ -33,29 +56,38 @@ func (c *Clients) checkClientExist(db *pgxpool.Pool) bool {
 	return count > 0
 }
 
-func (c *Clients) AddClient(db *pgxpool.Pool) error {
-	isExist := c.checkClientExist(db)
-	if isExist {
-		return fmt.Errorf(data.UserExists)
-	}
-
+// AddClient добавляет клиента, если среди существующих нет возможных дублей
+// (по email, телефону или похожему имени). Найденные дубли возвращаются вместе
+// с ошибкой ClientDuplicate; force добавляет клиента несмотря на них
+func (c *Clients) AddClient(db *pgxpool.Pool, force bool) ([]Duplicates, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	addClientQ := "INSERT INTO Clients (full_name, email, phone, notes) VALUES ($1, $2, $3, $4)"
+	c.Id = 0
+	if !force {
+		duplicates, err := c.FindDuplicatesTx(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+		if len(duplicates) > 0 {
+			return duplicates, errors.New(data.ClientDuplicate)
+		}
+	}
 
-	_, err := db.Exec(ctx, addClientQ, c.FullName, c.Email, c.Phone, c.Notes)
-	if err != nil {
-		return err
+	c.Tags = NormalizeTags(c.Tags)
+	addClientQ := "INSERT INTO Clients (full_name, email, phone, notes, tags) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at::text"
+
+	if err := db.QueryRow(ctx, addClientQ, c.FullName, c.Email, c.Phone, c.Notes, c.Tags).Scan(&c.Id, &c.CreatedAt); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return nil, nil
 }
 
 func (c *Clients) EditClient(db *pgxpool.Pool) error {
 	isExist := c.checkClientExist(db)
 	if !isExist {
-		return errors.New("client not found")
+		return errors.New(data.ClientNotFound)
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -63,11 +95,12 @@ func (c *Clients) EditClient(db *pgxpool.Pool) error {
 
 	EditUserQ := `
 					UPDATE Clients
-					SET full_name = $1, email = $2, phone = $3, notes = $4
-					WHERE id = $5
+					SET full_name = $1, email = $2, phone = $3, notes = $4, tags = $5
+					WHERE id = $6
 	`
 
-	_, err := db.Exec(ctx, EditUserQ, c.FullName, c.Email, c.Phone, c.Notes, c.Id)
+	c.Tags = NormalizeTags(c.Tags)
+	_, err := db.Exec(ctx, EditUserQ, c.FullName, c.Email, c.Phone, c.Notes, c.Tags, c.Id)
 	if err != nil {
 		return err
 	}
@@ -79,9 +112,7 @@ func (c *Clients) GetClients(db *pgxpool.Pool) ([]Clients, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	GetClientsQ := "SELECT id, full_name, email, phone, notes FROM Clients"
-
-	rows, err := db.Query(ctx, GetClientsQ)
+	rows, err := db.Query(ctx, selectClientsQ+" ORDER BY id")
 	if err != nil {
 		return nil, err
 	}
@@ -90,7 +121,7 @@ func (c *Clients) GetClients(db *pgxpool.Pool) ([]Clients, error) {
 	var clients []Clients
 	for rows.Next() {
 		var client Clients
-		if err := rows.Scan(&client.Id, &client.FullName, &client.Email, &client.Phone, &client.Notes); err != nil {
+		if err := scanClient(rows, &client); err != nil {
 			return nil, err
 		}
 		clients = append(clients, client)
@@ -0,0 +1,347 @@
+package db_clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// Duplicate match reasons
+	MatchEmail = "email"
+	MatchPhone = "phone"
+	MatchName  = "name"
+
+	// Минимальное сходство триграмм имён, при котором клиенты считаются возможными дублями
+	nameSimilarity = 0.6
+	// Телефоны сравниваются по последним цифрам, чтобы +7 и 8 в начале не мешали
+	phoneDigits = 10
+)
+
+// Duplicates - возможный дубль клиента и причины совпадения
+type Duplicates struct {
+	Client     Clients  `json:"client"`
+	Reasons    []string `json:"reasons"`
+	Similarity float32  `json:"similarity"`
+}
+
+// DuplicatePairs - пара возможных дублей для отчёта
+type DuplicatePairs struct {
+	First      Clients  `json:"first"`
+	Second     Clients  `json:"second"`
+	Reasons    []string `json:"reasons"`
+	Similarity float32  `json:"similarity"`
+}
+
+// ClientMerges - запись журнала объединения: удалённая карточка и число
+// перенесённых на оставшегося клиента строк по таблицам
+type ClientMerges struct {
+	Id         int                `json:"id"`
+	SurvivorId int                `json:"survivor_id"`
+	MergedId   int                `json:"merged_id"`
+	Merged     Clients            `json:"merged"`
+	Moved      map[string]int64   `json:"moved"`
+	MergedBy   string             `json:"merged_by"`
+	MergedAt   pgtype.Timestamptz `json:"merged_at"`
+}
+
+// MergeRequest - объединение карточек MergedIds в карточку SurvivorId
+type MergeRequest struct {
+	SurvivorId int    `json:"survivor_id"`
+	MergedIds  []int  `json:"merged_ids"`
+	MergedBy   string `json:"-"`
+}
+
+// Ссылки на клиентов, которые переносятся при объединении.
+// Счета (фолио) привязаны к броням и переходят вместе с ними
+var clientReferences = []struct{ table, column string }{
+	{"Bookings", "client_id"},
+	{"BookingOccupants", "client_id"},
+	{"GroupRoomingList", "client_id"},
+	{"BookingGroups", "contact_client_id"},
+	{"RoomHolds", "client_id"},
+	{"Waitlist", "client_id"},
+	{"PromoRedemptions", "client_id"},
+}
+
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizePhone оставляет последние цифры номера; слишком короткий номер не сравнивается
+func NormalizePhone(phone string) string {
+	digits := digitsOnly(phone)
+	if len(digits) < 7 {
+		return ""
+	}
+	if len(digits) > phoneDigits {
+		digits = digits[len(digits)-phoneDigits:]
+	}
+	return digits
+}
+
+// Выражения SQL, нормализующие email и телефон так же, как NormalizeEmail и NormalizePhone
+func emailSQL(alias string) string {
+	return fmt.Sprintf("lower(trim(%s.email))", alias)
+}
+
+func phoneSQL(alias string) string {
+	digits := fmt.Sprintf("regexp_replace(%s.phone, '\\D', '', 'g')", alias)
+	return fmt.Sprintf("CASE WHEN length(%[1]s) >= 7 THEN right(%[1]s, %[2]d) ELSE '' END", digits, phoneDigits)
+}
+
+func reasons(email, phone bool, similarity float32) []string {
+	matched := []string{}
+	if email {
+		matched = append(matched, MatchEmail)
+	}
+	if phone {
+		matched = append(matched, MatchPhone)
+	}
+	if similarity >= nameSimilarity {
+		matched = append(matched, MatchName)
+	}
+	return matched
+}
+
+// FindDuplicatesTx ищет клиентов с тем же email или телефоном после нормализации
+// либо с похожим именем (нужно расширение pg_trgm). Сам клиент (c.Id) не учитывается
+func (c *Clients) FindDuplicatesTx(ctx context.Context, q storage.Querier) ([]Duplicates, error) {
+	findQ := fmt.Sprintf(`SELECT id, full_name, email, phone, notes, tags, created_at::text, email_match, phone_match, name_similarity
+		FROM (
+			SELECT c.*,
+				($1 <> '' AND %s = $1) AS email_match,
+				($2 <> '' AND %s = $2) AS phone_match,
+				similarity(lower(c.full_name), lower($3)) AS name_similarity
+			FROM Clients c WHERE c.id <> $4
+		) candidates
+		WHERE email_match OR phone_match OR name_similarity >= $5
+		ORDER BY email_match DESC, phone_match DESC, name_similarity DESC, id
+		LIMIT 20`, emailSQL("c"), phoneSQL("c"))
+
+	rows, err := q.Query(ctx, findQ, NormalizeEmail(c.Email), NormalizePhone(c.Phone), strings.TrimSpace(c.FullName), c.Id, nameSimilarity)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	duplicates := []Duplicates{}
+	for rows.Next() {
+		var duplicate Duplicates
+		var emailMatch, phoneMatch bool
+		client := &duplicate.Client
+		if err := rows.Scan(&client.Id, &client.FullName, &client.Email, &client.Phone, &client.Notes, &client.Tags,
+			&client.CreatedAt, &emailMatch, &phoneMatch, &duplicate.Similarity); err != nil {
+			return nil, err
+		}
+		duplicate.Reasons = reasons(emailMatch, phoneMatch, duplicate.Similarity)
+		duplicates = append(duplicates, duplicate)
+	}
+
+	return duplicates, rows.Err()
+}
+
+func (c *Clients) FindDuplicates(db *pgxpool.Pool) ([]Duplicates, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return c.FindDuplicatesTx(ctx, db)
+}
+
+// DuplicatesReport - пары возможных дублей среди всех клиентов, сначала
+// совпадения по email и телефону. Похожие имена ищутся оператором % pg_trgm
+func DuplicatesReport(db *pgxpool.Pool, limit int) ([]DuplicatePairs, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf("SET LOCAL pg_trgm.similarity_threshold = %v", nameSimilarity)); err != nil {
+		return nil, err
+	}
+
+	reportQ := fmt.Sprintf(`SELECT a.id, a.full_name, a.email, a.phone, a.notes, a.tags, a.created_at::text,
+			b.id, b.full_name, b.email, b.phone, b.notes, b.tags, b.created_at::text,
+			pairs.email_match, pairs.phone_match, pairs.name_similarity
+		FROM (
+			SELECT a.id AS first_id, b.id AS second_id,
+				(%[1]s <> '' AND %[1]s = %[2]s) AS email_match,
+				(%[3]s <> '' AND %[3]s = %[4]s) AS phone_match,
+				similarity(lower(a.full_name), lower(b.full_name)) AS name_similarity
+			FROM Clients a JOIN Clients b ON a.id < b.id
+				AND ((%[1]s <> '' AND %[1]s = %[2]s)
+					OR (%[3]s <> '' AND %[3]s = %[4]s)
+					OR lower(a.full_name) %% lower(b.full_name))
+		) pairs
+		JOIN Clients a ON a.id = pairs.first_id
+		JOIN Clients b ON b.id = pairs.second_id
+		ORDER BY pairs.email_match DESC, pairs.phone_match DESC, pairs.name_similarity DESC, a.id, b.id
+		LIMIT $1`, emailSQL("a"), emailSQL("b"), phoneSQL("a"), phoneSQL("b"))
+
+	rows, err := tx.Query(ctx, reportQ, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pairs := []DuplicatePairs{}
+	for rows.Next() {
+		var pair DuplicatePairs
+		var emailMatch, phoneMatch bool
+		first, second := &pair.First, &pair.Second
+		if err := rows.Scan(
+			&first.Id, &first.FullName, &first.Email, &first.Phone, &first.Notes, &first.Tags, &first.CreatedAt,
+			&second.Id, &second.FullName, &second.Email, &second.Phone, &second.Notes, &second.Tags, &second.CreatedAt,
+			&emailMatch, &phoneMatch, &pair.Similarity,
+		); err != nil {
+			return nil, err
+		}
+		pair.Reasons = reasons(emailMatch, phoneMatch, pair.Similarity)
+		pairs = append(pairs, pair)
+	}
+
+	return pairs, rows.Err()
+}
+
+// absorb дополняет карточку данными объединяемой: пустые email и телефон,
+// заметки и метки
+func (c *Clients) absorb(merged *Clients) {
+	if c.Email == "" {
+		c.Email = merged.Email
+	}
+	if c.Phone == "" {
+		c.Phone = merged.Phone
+	}
+	if notes := strings.TrimSpace(merged.Notes); notes != "" && !strings.Contains(c.Notes, notes) {
+		if c.Notes != "" {
+			c.Notes += "\n"
+		}
+		c.Notes += notes
+	}
+	c.Tags = NormalizeTags(append(c.Tags, merged.Tags...))
+}
+
+func lockClientTx(ctx context.Context, q storage.Querier, id int) (*Clients, error) {
+	var client Clients
+	if err := scanClient(q.QueryRow(ctx, selectClientsQ+" WHERE id = $1 FOR UPDATE", id), &client); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New(data.ClientNotFound)
+		}
+		return nil, err
+	}
+	return &client, nil
+}
+
+// Merge переносит брони (вместе с их счетами), проживающих, списки групп,
+// удержания, лист ожидания и применения промокодов на оставшегося клиента,
+// дополняет его карточку, удаляет объединённые карточки и пишет журнал
+func (r *MergeRequest) Merge(db *pgxpool.Pool) ([]ClientMerges, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	if r.SurvivorId <= 0 || len(r.MergedIds) == 0 {
+		return nil, errors.New(data.WrongData)
+	}
+	seen := map[int]bool{r.SurvivorId: true}
+	for _, id := range r.MergedIds {
+		if seen[id] {
+			return nil, errors.New(data.WrongData)
+		}
+		seen[id] = true
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	survivor, err := lockClientTx(ctx, tx, r.SurvivorId)
+	if err != nil {
+		return nil, err
+	}
+
+	merges := []ClientMerges{}
+	for _, id := range r.MergedIds {
+		merged, err := lockClientTx(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		// Если оба клиента - проживающие одной брони, остаётся одна запись
+		if _, err := tx.Exec(ctx, `DELETE FROM BookingOccupants WHERE client_id = $1
+			AND booking_id IN (SELECT booking_id FROM BookingOccupants WHERE client_id = $2)`, merged.Id, survivor.Id); err != nil {
+			return nil, err
+		}
+
+		moved := make(map[string]int64)
+		for _, ref := range clientReferences {
+			tag, err := tx.Exec(ctx, fmt.Sprintf("UPDATE %s SET %s = $1 WHERE %s = $2", ref.table, ref.column, ref.column),
+				survivor.Id, merged.Id)
+			if err != nil {
+				return nil, err
+			}
+			if tag.RowsAffected() > 0 {
+				moved[ref.table] = tag.RowsAffected()
+			}
+		}
+
+		survivor.absorb(merged)
+		if _, err := tx.Exec(ctx, "DELETE FROM Clients WHERE id = $1", merged.Id); err != nil {
+			return nil, err
+		}
+
+		merge := ClientMerges{SurvivorId: survivor.Id, MergedId: merged.Id, Merged: *merged, Moved: moved, MergedBy: r.MergedBy}
+		if err := tx.QueryRow(ctx, `INSERT INTO ClientMerges(survivor_id, merged_id, merged, moved, merged_by)
+			VALUES($1, $2, $3, $4, $5) RETURNING id, merged_at`,
+			merge.SurvivorId, merge.MergedId, merge.Merged, merge.Moved, merge.MergedBy,
+		).Scan(&merge.Id, &merge.MergedAt); err != nil {
+			return nil, err
+		}
+		merges = append(merges, merge)
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE Clients SET email = $1, phone = $2, notes = $3, tags = $4 WHERE id = $5",
+		survivor.Email, survivor.Phone, survivor.Notes, survivor.Tags, survivor.Id); err != nil {
+		return nil, err
+	}
+
+	return merges, tx.Commit(ctx)
+}
+
+// GetMerges - журнал объединений; clientId > 0 - только для оставшейся карточки
+func GetMerges(db *pgxpool.Pool, clientId int) ([]ClientMerges, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.Query(ctx, `SELECT id, survivor_id, merged_id, merged, moved, merged_by, merged_at
+		FROM ClientMerges WHERE $1 = 0 OR survivor_id = $1 ORDER BY merged_at DESC, id DESC`, clientId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	merges := []ClientMerges{}
+	for rows.Next() {
+		var merge ClientMerges
+		if err := rows.Scan(&merge.Id, &merge.SurvivorId, &merge.MergedId, &merge.Merged, &merge.Moved,
+			&merge.MergedBy, &merge.MergedAt); err != nil {
+			return nil, err
+		}
+		merges = append(merges, merge)
+	}
+
+	return merges, rows.Err()
+}
@@ -0,0 +1,36 @@
+package db_clients
+
+import "testing"
+
+func TestNormalizePhone(t *testing.T) {
+	tests := map[string]string{
+		"+7 (912) 345-67-89": "9123456789",
+		"8 912 345 67 89":    "9123456789",
+		"9123456789":         "9123456789",
+		"+44 20 7946 0958":   "2079460958",
+		"345-67-89":          "3456789",
+		"45-67-89":           "",
+		"ext. 12":            "",
+		"":                   "",
+	}
+
+	for phone, want := range tests {
+		if got := NormalizePhone(phone); got != want {
+			t.Errorf("NormalizePhone(%q) = %q, want %q", phone, got, want)
+		}
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := map[string]string{
+		" Ivan.Petrov@Example.COM ": "ivan.petrov@example.com",
+		"guest@hotel.ru":            "guest@hotel.ru",
+		"":                          "",
+	}
+
+	for email, want := range tests {
+		if got := NormalizeEmail(email); got != want {
+			t.Errorf("NormalizeEmail(%q) = %q, want %q", email, got, want)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package db_clients
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// Search sort keys
+	SortRelevance = "relevance" // По умолчанию при непустом запросе
+	SortName      = "name"
+	SortCreatedAt = "created_at" // По умолчанию без запроса
+
+	DefaultSearchLimit = 50
+	MaxSearchLimit     = 200
+
+	// Минимальное сходство триграмм, при котором строка считается совпадением с опечаткой
+	similarityThreshold = 0.4
+)
+
+// SearchParams - параметры поиска клиентов. Query ищется без учёта регистра
+// по подстроке в имени, email, телефоне (по цифрам) и заметках, а также
+// по сходству триграмм в имени и email (нужно расширение pg_trgm).
+// Клиент должен иметь все метки из Tags. Cursor - значение NextCursor
+// предыдущей страницы, сортировка и фильтры при этом должны совпадать
+type SearchParams struct {
+	Query       string
+	CreatedFrom pgtype.Date
+	CreatedTo   pgtype.Date
+	Tags        []string
+	Sort        string
+	Desc        bool
+	Limit       int
+	Cursor      string
+}
+
+// SearchResult - страница результатов. Пустой NextCursor - страница последняя
+type SearchResult struct {
+	Clients    []Clients `json:"clients"`
+	NextCursor string    `json:"next_cursor"`
+}
+
+// Позиция последней строки страницы: значение ключа сортировки и id
+type searchCursor struct {
+	Value string `json:"v"`
+	Id    int    `json:"id"`
+}
+
+func (c searchCursor) encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(value string) (*searchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New(data.WrongCursor)
+	}
+	var cursor searchCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil || cursor.Id <= 0 {
+		return nil, errors.New(data.WrongCursor)
+	}
+	return &cursor, nil
+}
+
+// Экранирует спецсимволы LIKE в пользовательском запросе
+func likePattern(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+	return "%" + value + "%"
+}
+
+func digitsOnly(value string) string {
+	var digits strings.Builder
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	return digits.String()
+}
+
+func (p *SearchParams) normalize() error {
+	p.Query = strings.TrimSpace(p.Query)
+	p.Tags = NormalizeTags(p.Tags)
+
+	if p.Sort == "" {
+		p.Sort = SortCreatedAt
+		if p.Query != "" {
+			p.Sort = SortRelevance
+		}
+	}
+	if p.Sort != SortRelevance && p.Sort != SortName && p.Sort != SortCreatedAt {
+		return errors.New(data.WrongData)
+	}
+	if p.Sort == SortRelevance && p.Query == "" {
+		return errors.New(data.WrongData)
+	}
+
+	if p.Limit <= 0 {
+		p.Limit = DefaultSearchLimit
+	}
+	if p.Limit > MaxSearchLimit {
+		p.Limit = MaxSearchLimit
+	}
+
+	return nil
+}
+
+// Search ищет клиентов с курсорной пагинацией (по ключу сортировки и id)
+func Search(db *pgxpool.Pool, params SearchParams) (*SearchResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := params.normalize(); err != nil {
+		return nil, err
+	}
+
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	var conditions []string
+	relevance := "0::real"
+	if params.Query != "" {
+		query := arg(params.Query)
+		pattern := arg(likePattern(params.Query))
+		matches := []string{
+			"full_name ILIKE " + pattern,
+			"email ILIKE " + pattern,
+			"notes ILIKE " + pattern,
+			fmt.Sprintf("word_similarity(%s, full_name) >= %v", query, similarityThreshold),
+			fmt.Sprintf("word_similarity(%s, email) >= %v", query, similarityThreshold),
+		}
+		if digits := digitsOnly(params.Query); len(digits) >= 3 {
+			matches = append(matches, fmt.Sprintf("regexp_replace(phone, '\\D', '', 'g') LIKE %s", arg("%"+digits+"%")))
+		} else {
+			matches = append(matches, "phone ILIKE "+pattern)
+		}
+		conditions = append(conditions, "("+strings.Join(matches, " OR ")+")")
+
+		// Точное вхождение в имя или email выше любого совпадения с опечаткой
+		relevance = fmt.Sprintf(`(CASE WHEN full_name ILIKE %[2]s OR email ILIKE %[2]s THEN 1 ELSE 0 END
+			+ GREATEST(word_similarity(%[1]s, full_name), word_similarity(%[1]s, email)))::real`, query, pattern)
+	}
+	if params.CreatedFrom.Status == pgtype.Present {
+		conditions = append(conditions, "created_at >= "+arg(params.CreatedFrom)+"::date")
+	}
+	if params.CreatedTo.Status == pgtype.Present {
+		conditions = append(conditions, fmt.Sprintf("created_at < %s::date + 1", arg(params.CreatedTo)))
+	}
+	if len(params.Tags) > 0 {
+		conditions = append(conditions, "tags @> "+arg(params.Tags))
+	}
+
+	var key, keyType string
+	switch params.Sort {
+	case SortRelevance:
+		key, keyType = "relevance", "real"
+	case SortName:
+		key, keyType = "lower(full_name)", "text"
+	case SortCreatedAt:
+		key, keyType = "created_at", "timestamptz"
+	}
+	direction, compare := "ASC", ">"
+	if params.Desc {
+		direction, compare = "DESC", "<"
+	}
+
+	// Условия на relevance применяются во внешнем запросе, где это поле уже посчитано
+	outer := []string{"TRUE"}
+	if params.Cursor != "" {
+		cursor, err := decodeCursor(params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		value := arg(cursor.Value) + "::" + keyType
+		outer = append(outer, fmt.Sprintf("(%[1]s %[2]s %[3]s OR (%[1]s = %[3]s AND id > %[4]s))",
+			key, compare, value, arg(cursor.Id)))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	searchQ := fmt.Sprintf(`SELECT id, full_name, email, phone, notes, tags, created_at::text, %[1]s::text
+		FROM (
+			SELECT *, %[2]s AS relevance FROM Clients %[3]s
+		) found
+		WHERE %[4]s
+		ORDER BY %[1]s %[5]s, id
+		LIMIT %[6]s`,
+		key, relevance, where, strings.Join(outer, " AND "), direction, arg(params.Limit+1))
+
+	rows, err := db.Query(ctx, searchQ, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := SearchResult{Clients: []Clients{}}
+	var last searchCursor
+	for rows.Next() {
+		if len(result.Clients) == params.Limit {
+			result.NextCursor = last.encode()
+			break
+		}
+
+		var client Clients
+		if err := rows.Scan(&client.Id, &client.FullName, &client.Email, &client.Phone, &client.Notes, &client.Tags,
+			&client.CreatedAt, &last.Value); err != nil {
+			return nil, err
+		}
+		last.Id = client.Id
+		result.Clients = append(result.Clients, client)
+	}
+
+	return &result, rows.Err()
+}
@@ -0,0 +1,97 @@
+package db_clients
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+)
+
+func TestSearchCursor(t *testing.T) {
+	cursors := []searchCursor{
+		{Value: "Ivan Petrov", Id: 1},
+		{Value: "2026-10-19T12:00:00.123456Z", Id: 42},
+		{Value: "0.73", Id: 1000000},
+		{Value: "", Id: 7},
+		{Value: "Иванов \"VIP\" / &?=", Id: 3},
+	}
+
+	for _, cursor := range cursors {
+		encoded := cursor.encode()
+		got, err := decodeCursor(encoded)
+		if err != nil {
+			t.Fatalf("decodeCursor(%q) error: %v", encoded, err)
+		}
+		if *got != cursor {
+			t.Errorf("decodeCursor(encode(%+v)) = %+v", cursor, *got)
+		}
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+
+	tests := map[string]string{
+		"empty":            "",
+		"not base64":       "!!!",
+		"padded base64":    base64.URLEncoding.EncodeToString([]byte(`{"v":"a","id":1}`)),
+		"not json":         encode("name:1"),
+		"missing id":       encode(`{"v":"a"}`),
+		"zero id":          encode(`{"v":"a","id":0}`),
+		"negative id":      encode(`{"v":"a","id":-5}`),
+		"wrong id type":    encode(`{"v":"a","id":"1"}`),
+		"wrong value type": encode(`{"v":1,"id":1}`),
+	}
+
+	for name, value := range tests {
+		if _, err := decodeCursor(value); err == nil || err.Error() != data.WrongCursor {
+			t.Errorf("%s: decodeCursor(%q) error = %v, want %q", name, value, err, data.WrongCursor)
+		}
+	}
+}
+
+func TestLikePattern(t *testing.T) {
+	tests := map[string]string{
+		"petrov":  "%petrov%",
+		"100%":    `%100\%%`,
+		"a_b":     `%a\_b%`,
+		`back\sl`: `%back\\sl%`,
+		`%_\`:     `%\%\_\\%`,
+		"":        "%%",
+	}
+
+	for value, want := range tests {
+		if got := likePattern(value); got != want {
+			t.Errorf("likePattern(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestSearchParamsNormalize(t *testing.T) {
+	tests := []struct {
+		name      string
+		params    SearchParams
+		wantSort  string
+		wantLimit int
+		wantErr   bool
+	}{
+		{name: "defaults without query", params: SearchParams{}, wantSort: SortCreatedAt, wantLimit: DefaultSearchLimit},
+		{name: "defaults with query", params: SearchParams{Query: " ivan "}, wantSort: SortRelevance, wantLimit: DefaultSearchLimit},
+		{name: "limit is capped", params: SearchParams{Sort: SortName, Limit: 1000}, wantSort: SortName, wantLimit: MaxSearchLimit},
+		{name: "relevance needs a query", params: SearchParams{Query: "  ", Sort: SortRelevance}, wantErr: true},
+		{name: "unknown sort", params: SearchParams{Sort: "phone"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := tt.params
+			err := params.normalize()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (params.Sort != tt.wantSort || params.Limit != tt.wantLimit) {
+				t.Errorf("normalize() sort = %s, limit = %d, want %s, %d", params.Sort, params.Limit, tt.wantSort, tt.wantLimit)
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+package db_companies
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_property "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/property"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Companies - корпоративный клиент. Начисления на его счета (city ledger)
+// оплачиваются по счетам с отсрочкой PaymentTerms дней.
+// Нулевой CreditLimit - без ограничения долга
+type Companies struct {
+	Id           int                `json:"id"`
+	Name         string             `json:"name"`
+	TaxId        string             `json:"tax_id"`
+	Address      string             `json:"address"`
+	Email        string             `json:"email"`
+	Phone        string             `json:"phone"`
+	CreditLimit  money.Decimal      `json:"credit_limit"`
+	PaymentTerms int                `json:"payment_terms"`
+	Rates        []Rates            `json:"rates"`
+	Active       bool               `json:"active"`
+	Balance      money.Decimal      `json:"balance"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+}
+
+// Rates - договорная цена за сутки для типа номера (вместо цены номера)
+type Rates struct {
+	RoomType      string        `json:"room_type"`
+	PricePerNight money.Decimal `json:"price_per_night"`
+}
+
+// Ledger - долг компании с разбивкой по срокам просрочки.
+// Current - ещё не наступил срок оплаты (или переплата)
+type Ledger struct {
+	CompanyId    int           `json:"company_id"`
+	Name         string        `json:"name"`
+	CreditLimit  money.Decimal `json:"credit_limit"`
+	PaymentTerms int           `json:"payment_terms"`
+	Balance      money.Decimal `json:"balance"`
+	Current      money.Decimal `json:"current"`
+	Overdue30    money.Decimal `json:"overdue_1_30"`
+	Overdue60    money.Decimal `json:"overdue_31_60"`
+	Overdue90    money.Decimal `json:"overdue_61_90"`
+	Overdue90Up  money.Decimal `json:"overdue_90_plus"`
+}
+
+const selectCompaniesQ = `SELECT id, name, tax_id, address, email, phone, credit_limit, payment_terms, active, created_at,
+	(SELECT COALESCE(sum(fc.amount), 0) FROM FolioCharges fc JOIN Folios f ON f.id = fc.folio_id
+		WHERE f.company_id = Companies.id)
+	FROM Companies`
+
+func scanCompany(row pgx.Row, c *Companies) error {
+	return row.Scan(
+		&c.Id,
+		&c.Name,
+		&c.TaxId,
+		&c.Address,
+		&c.Email,
+		&c.Phone,
+		&c.CreditLimit,
+		&c.PaymentTerms,
+		&c.Active,
+		&c.CreatedAt,
+		&c.Balance,
+	)
+}
+
+func (c *Companies) validate() error {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" || c.CreditLimit < 0 || c.PaymentTerms < 0 {
+		return errors.New(data.WrongData)
+	}
+
+	seen := make(map[string]bool, len(c.Rates))
+	for _, rate := range c.Rates {
+		if rate.RoomType == "" || rate.PricePerNight <= 0 || seen[rate.RoomType] {
+			return errors.New(data.WrongData)
+		}
+		seen[rate.RoomType] = true
+	}
+	if c.Rates == nil {
+		c.Rates = []Rates{}
+	}
+
+	return nil
+}
+
+// Договорные цены перезаписываются целиком
+func (c *Companies) saveRates(ctx context.Context, q storage.Querier) error {
+	if _, err := q.Exec(ctx, "DELETE FROM CompanyRates WHERE company_id = $1", c.Id); err != nil {
+		return err
+	}
+
+	for _, rate := range c.Rates {
+		if _, err := q.Exec(ctx, "INSERT INTO CompanyRates(company_id, room_type, price_per_night) VALUES($1, $2, $3)",
+			c.Id, rate.RoomType, rate.PricePerNight); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Companies) Create(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	createQ := `INSERT INTO Companies(name, tax_id, address, email, phone, credit_limit, payment_terms, active)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at`
+	if err := tx.QueryRow(ctx, createQ,
+		c.Name, c.TaxId, c.Address, c.Email, c.Phone, c.CreditLimit, c.PaymentTerms, c.Active,
+	).Scan(&c.Id, &c.CreatedAt); err != nil {
+		return err
+	}
+	if err := c.saveRates(ctx, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Edit меняет профиль компании. Новые условия действуют для новых броней и начислений
+func (c *Companies) Edit(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	editQ := `UPDATE Companies SET name = $1, tax_id = $2, address = $3, email = $4, phone = $5,
+			credit_limit = $6, payment_terms = $7, active = $8
+		WHERE id = $9`
+	tag, err := tx.Exec(ctx, editQ,
+		c.Name, c.TaxId, c.Address, c.Email, c.Phone, c.CreditLimit, c.PaymentTerms, c.Active, c.Id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New(data.CompanyNotFound)
+	}
+	if err := c.saveRates(ctx, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Подгрузка договорных цен одним запросом для всех компаний выборки
+func loadRates(ctx context.Context, q storage.Querier, companies []Companies) error {
+	if len(companies) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(companies))
+	index := make(map[int]int, len(companies))
+	for i := range companies {
+		ids[i] = companies[i].Id
+		index[companies[i].Id] = i
+		companies[i].Rates = []Rates{}
+	}
+
+	rows, err := q.Query(ctx,
+		"SELECT company_id, room_type, price_per_night FROM CompanyRates WHERE company_id = ANY($1) ORDER BY room_type", ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var companyId int
+		var rate Rates
+		if err := rows.Scan(&companyId, &rate.RoomType, &rate.PricePerNight); err != nil {
+			return err
+		}
+		company := &companies[index[companyId]]
+		company.Rates = append(company.Rates, rate)
+	}
+
+	return rows.Err()
+}
+
+// QueryList выполняет выборку компаний с произвольным условием
+func QueryList(ctx context.Context, q storage.Querier, where string, args ...interface{}) ([]Companies, error) {
+	rows, err := q.Query(ctx, selectCompaniesQ+" "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var companies []Companies
+	for rows.Next() {
+		var company Companies
+		if err := scanCompany(rows, &company); err != nil {
+			return nil, err
+		}
+		companies = append(companies, company)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := loadRates(ctx, q, companies); err != nil {
+		return nil, err
+	}
+
+	return companies, nil
+}
+
+func GetByIDTx(ctx context.Context, q storage.Querier, id int) (*Companies, error) {
+	companies, err := QueryList(ctx, q, "WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(companies) == 0 {
+		return nil, errors.New(data.CompanyNotFound)
+	}
+
+	return &companies[0], nil
+}
+
+func GetByID(db *pgxpool.Pool, id int) (*Companies, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return GetByIDTx(ctx, db, id)
+}
+
+func GetList(db *pgxpool.Pool) ([]Companies, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return QueryList(ctx, db, "ORDER BY name")
+}
+
+// Rate возвращает договорную цену для типа номера
+func (c *Companies) Rate(roomType string) (money.Decimal, bool) {
+	for _, rate := range c.Rates {
+		if rate.RoomType == roomType {
+			return rate.PricePerNight, true
+		}
+	}
+	return 0, false
+}
+
+// CheckCreditTx проверяет, что долг компании с учётом amount не превысит
+// кредитный лимит. Компания блокируется до конца транзакции
+func CheckCreditTx(ctx context.Context, q storage.Querier, id int, amount money.Decimal) error {
+	var limit money.Decimal
+	if err := q.QueryRow(ctx, "SELECT credit_limit FROM Companies WHERE id = $1 FOR UPDATE", id).Scan(&limit); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New(data.CompanyNotFound)
+		}
+		return err
+	}
+	if limit == 0 {
+		return nil
+	}
+
+	var balance money.Decimal
+	if err := q.QueryRow(ctx, `SELECT COALESCE(sum(fc.amount), 0) FROM FolioCharges fc
+		JOIN Folios f ON f.id = fc.folio_id WHERE f.company_id = $1`, id).Scan(&balance); err != nil {
+		return err
+	}
+	if balance+amount > limit {
+		return errors.New(data.CreditLimitExceeded)
+	}
+
+	return nil
+}
+
+// add распределяет непогашенную сумму по корзинам просрочки
+func (l *Ledger) add(amount money.Decimal, overdueDays int) {
+	switch {
+	case overdueDays <= 0:
+		l.Current += amount
+	case overdueDays <= 30:
+		l.Overdue30 += amount
+	case overdueDays <= 60:
+		l.Overdue60 += amount
+	case overdueDays <= 90:
+		l.Overdue90 += amount
+	default:
+		l.Overdue90Up += amount
+	}
+}
+
+// debit - начисление на счёт компании
+type debit struct {
+	date   time.Time
+	amount money.Decimal
+}
+
+// age гасит начисления (по возрастанию даты) оплатами paid, начиная с самых
+// старых, и раскладывает остаток по срокам просрочки на дату today.
+// Переплата уменьшает текущий долг
+func (l *Ledger) age(debits []debit, paid money.Decimal, today time.Time) {
+	for _, d := range debits {
+		if paid >= d.amount {
+			paid -= d.amount
+			continue
+		}
+		due := d.date.AddDate(0, 0, l.PaymentTerms)
+		l.add(d.amount-paid, int(today.Sub(due).Hours()/24))
+		paid = 0
+	}
+	l.Current -= paid
+}
+
+// CityLedger - долги компаний на текущий операционный день с разбивкой по
+// просрочке. Срок оплаты начисления - дата услуги плюс отсрочка компании;
+// оплаты и уменьшающие корректировки гасят самые старые начисления
+func CityLedger(db *pgxpool.Pool) ([]Ledger, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	settings, err := db_property.GetTx(ctx, db, false)
+	if err != nil {
+		return nil, err
+	}
+
+	companies, err := QueryList(ctx, db, "WHERE EXISTS (SELECT 1 FROM Folios f WHERE f.company_id = Companies.id) ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(ctx, `SELECT f.company_id, fc.service_date, fc.amount FROM FolioCharges fc
+		JOIN Folios f ON f.id = fc.folio_id
+		WHERE f.company_id IS NOT NULL
+		ORDER BY f.company_id, fc.service_date, fc.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	debits := make(map[int][]debit)
+	credits := make(map[int]money.Decimal)
+	for rows.Next() {
+		var companyId int
+		var date pgtype.Date
+		var amount money.Decimal
+		if err := rows.Scan(&companyId, &date, &amount); err != nil {
+			return nil, err
+		}
+		if amount > 0 {
+			debits[companyId] = append(debits[companyId], debit{date: date.Time, amount: amount})
+		} else {
+			credits[companyId] -= amount
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ledger := make([]Ledger, 0, len(companies))
+	for _, company := range companies {
+		account := Ledger{
+			CompanyId:    company.Id,
+			Name:         company.Name,
+			CreditLimit:  company.CreditLimit,
+			PaymentTerms: company.PaymentTerms,
+			Balance:      company.Balance,
+		}
+
+		account.age(debits[company.Id], credits[company.Id], settings.BusinessDate.Time)
+		ledger = append(ledger, account)
+	}
+
+	return ledger, nil
+}
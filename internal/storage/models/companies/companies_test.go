@@ -0,0 +1,73 @@
+package db_companies
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+)
+
+func TestLedgerAge(t *testing.T) {
+	today := time.Date(2026, 10, 31, 0, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time { return today.AddDate(0, 0, -days) }
+
+	// Отсрочка 30 дней: просрочка = дней с даты услуги - 30
+	debits := []debit{
+		{date: daysAgo(152), amount: money.Units(400)}, // просрочка 122 дня
+		{date: daysAgo(91), amount: money.Units(300)},  // 61 день
+		{date: daysAgo(46), amount: money.Units(200)},  // 16 дней
+		{date: daysAgo(11), amount: money.Units(100)},  // срок не наступил
+	}
+
+	tests := []struct {
+		name   string
+		terms  int
+		debits []debit
+		paid   money.Decimal
+		want   Ledger
+	}{
+		{
+			name: "nothing paid", terms: 30, debits: debits,
+			want: Ledger{Current: money.Units(100), Overdue30: money.Units(200), Overdue90: money.Units(300), Overdue90Up: money.Units(400)},
+		},
+		{
+			name: "payments settle the oldest first", terms: 30, debits: debits, paid: money.Units(500),
+			want: Ledger{Current: money.Units(100), Overdue30: money.Units(200), Overdue90: money.Units(200)},
+		},
+		{
+			name: "overpayment reduces current", terms: 30, debits: debits, paid: money.Units(1200),
+			want: Ledger{Current: money.Units(-200)},
+		},
+		{
+			name: "bucket boundaries", terms: 30,
+			debits: []debit{
+				{date: daysAgo(60), amount: money.Units(1)},
+				{date: daysAgo(61), amount: money.Units(2)},
+				{date: daysAgo(90), amount: money.Units(4)},
+				{date: daysAgo(120), amount: money.Units(8)},
+				{date: daysAgo(121), amount: money.Units(16)},
+			},
+			want: Ledger{Overdue30: money.Units(1), Overdue60: money.Units(2 + 4), Overdue90: money.Units(8), Overdue90Up: money.Units(16)},
+		},
+		{
+			name: "no payment terms", terms: 0,
+			debits: []debit{{date: today, amount: money.Units(50)}, {date: daysAgo(1), amount: money.Units(70)}},
+			want:   Ledger{Current: money.Units(50), Overdue30: money.Units(70)},
+		},
+		{
+			name: "no debits", terms: 30, paid: money.Units(10),
+			want: Ledger{Current: money.Units(-10)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Ledger{PaymentTerms: tt.terms}
+			got.age(tt.debits, tt.paid, today)
+			tt.want.PaymentTerms = tt.terms
+			if got != tt.want {
+				t.Errorf("age() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
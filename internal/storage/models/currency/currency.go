@@ -0,0 +1,147 @@
+package db_currency
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_property "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/property"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// ExchangeRates - курс валюты к базовой валюте отеля:
+// сколько единиц базовой валюты стоит одна единица Currency
+type ExchangeRates struct {
+	Currency  string             `json:"currency"`
+	Rate      money.Rate         `json:"rate"`
+	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
+}
+
+// Set добавляет или обновляет курс валюты
+func (r *ExchangeRates) Set(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	currency, err := money.NormalizeCurrency(r.Currency)
+	if err != nil {
+		return errors.New(data.WrongCurrency)
+	}
+	r.Currency = currency
+	if r.Rate <= 0 {
+		return errors.New(data.WrongData)
+	}
+
+	settings, err := db_property.GetTx(ctx, db, false)
+	if err != nil {
+		return err
+	}
+	// Курс базовой валюты всегда 1
+	if r.Currency == settings.BaseCurrency {
+		return errors.New(data.WrongData)
+	}
+
+	setQ := `INSERT INTO ExchangeRates(currency, rate, updated_at) VALUES($1, $2, now())
+		ON CONFLICT (currency) DO UPDATE SET rate = EXCLUDED.rate, updated_at = now()
+		RETURNING updated_at`
+
+	return db.QueryRow(ctx, setQ, r.Currency, r.Rate).Scan(&r.UpdatedAt)
+}
+
+func (r *ExchangeRates) Delete(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	currency, err := money.NormalizeCurrency(r.Currency)
+	if err != nil {
+		return errors.New(data.WrongCurrency)
+	}
+
+	tag, err := db.Exec(ctx, "DELETE FROM ExchangeRates WHERE currency = $1", currency)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New(data.RateNotFound)
+	}
+
+	return nil
+}
+
+func GetRates(db *pgxpool.Pool) ([]ExchangeRates, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.Query(ctx, "SELECT currency, rate, updated_at FROM ExchangeRates ORDER BY currency")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []ExchangeRates
+	for rows.Next() {
+		var rate ExchangeRates
+		if err := rows.Scan(&rate.Currency, &rate.Rate, &rate.UpdatedAt); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
+
+// RateTx возвращает курс валюты к базовой (для базовой валюты - 1)
+func RateTx(ctx context.Context, q storage.Querier, currency string) (money.Rate, error) {
+	currency, err := money.NormalizeCurrency(currency)
+	if err != nil {
+		return 0, errors.New(data.WrongCurrency)
+	}
+
+	settings, err := db_property.GetTx(ctx, q, false)
+	if err != nil {
+		return 0, err
+	}
+	if currency == settings.BaseCurrency {
+		return money.UnitRate, nil
+	}
+
+	var rate money.Rate
+	if err := q.QueryRow(ctx, "SELECT rate FROM ExchangeRates WHERE currency = $1", currency).Scan(&rate); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, errors.New(data.RateNotFound)
+		}
+		return 0, err
+	}
+
+	return rate, nil
+}
+
+// ConvertTx пересчитывает сумму из одной валюты в другую через базовую валюту
+func ConvertTx(ctx context.Context, q storage.Querier, amount money.Decimal, from, to string) (money.Money, error) {
+	fromRate, err := RateTx(ctx, q, from)
+	if err != nil {
+		return money.Money{}, err
+	}
+	toRate, err := RateTx(ctx, q, to)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	currency, _ := money.NormalizeCurrency(to)
+	if fromRate == toRate {
+		return money.Money{Amount: amount, Currency: currency}, nil
+	}
+
+	return money.Money{Amount: amount.MulRate(fromRate).DivRate(toRate), Currency: currency}, nil
+}
+
+func Convert(db *pgxpool.Pool, amount money.Decimal, from, to string) (money.Money, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return ConvertTx(ctx, db, amount, from, to)
+}
@@ -0,0 +1,573 @@
+package db_folio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_companies "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/companies"
+	db_notifications "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/notifications"
+	db_property "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/property"
+	db_shifts "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/shifts"
+	db_taxes "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/taxes"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// Charge types
+	ChargeRoom         = "room"           // Проживание
+	ChargeTax          = "tax"            // Налог
+	ChargeEarlyCheckIn = "early_check_in" // Ранний заезд
+	ChargeLateCheckOut = "late_check_out" // Поздний выезд
+	ChargeService      = "service"        // Прочие услуги (мини-бар, ресторан и т.п.)
+
+	// Entry types. Сумма начисления и возврата увеличивает долг гостя,
+	// оплаты - уменьшает, корректировка может быть любого знака
+	EntryCharge     = "charge"
+	EntryPayment    = "payment"
+	EntryRefund     = "refund"
+	EntryAdjustment = "adjustment"
+
+	// Folio statuses
+	Open   = "open"   // Открыт для начислений
+	Closed = "closed" // Закрыт при выезде
+)
+
+// Folios - счёт гостя. У брони основной счёт создаётся автоматически,
+// дополнительные (например, для оплаты компанией) - вручную.
+// Счёт компании относится к её city ledger: начисления типов ChargeTypes
+// (пустой список - все) переносятся на него автоматически, при выезде
+// он не закрывается и оплачивается компанией по счёту
+type Folios struct {
+	Id          int                `json:"id"`
+	BookingId   int                `json:"booking_id"`
+	Name        string             `json:"name"`
+	Status      string             `json:"status"`
+	CompanyId   *int               `json:"company_id,omitempty"`
+	ChargeTypes []string           `json:"charge_types"`
+	Charges     []Charges          `json:"charges"`
+	Taxes       []TaxTotals        `json:"taxes"`
+	Balance     money.Decimal      `json:"balance"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+}
+
+// Charges - строка счёта: начисление, оплата, возврат или корректировка.
+// Amount хранится со знаком влияния на баланс
+type Charges struct {
+	Id              int           `json:"id"`
+	FolioId         int           `json:"folio_id"`
+	EntryType       string        `json:"entry_type"`
+	ChargeType      string        `json:"charge_type"`
+	Description     string        `json:"description"`
+	Amount          money.Decimal `json:"amount"`
+	Method          string        `json:"method"`
+	ServiceDate     pgtype.Date   `json:"service_date"`
+	TaxName         string        `json:"tax_name,omitempty"`
+	ParentId        *int          `json:"parent_id,omitempty"`
+	TransferredFrom *int          `json:"transferred_from,omitempty"`
+	// Кассовая смена, в которой проведены оплата или возврат
+	ShiftId        *int               `json:"shift_id,omitempty"`
+	RunningBalance money.Decimal      `json:"running_balance"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+}
+
+// TaxTotals - итог по налогу в счёте
+type TaxTotals struct {
+	Name   string        `json:"name"`
+	Amount money.Decimal `json:"amount"`
+}
+
+// TransferRequest - перенос начисления на другой счёт
+type TransferRequest struct {
+	ChargeId int `json:"charge_id"`
+	FolioId  int `json:"folio_id"`
+}
+
+const selectFoliosQ = "SELECT id, booking_id, name, status, company_id, COALESCE(charge_types, '{}'), created_at FROM Folios"
+
+const selectChargesQ = `SELECT id, folio_id, entry_type, charge_type, description, amount, method,
+	service_date, tax_name, parent_charge_id, transferred_from, shift_id, created_at FROM FolioCharges`
+
+func scanFolio(row pgx.Row, f *Folios) error {
+	return row.Scan(&f.Id, &f.BookingId, &f.Name, &f.Status, &f.CompanyId, &f.ChargeTypes, &f.CreatedAt)
+}
+
+func scanCharge(row pgx.Row, c *Charges) error {
+	return row.Scan(
+		&c.Id,
+		&c.FolioId,
+		&c.EntryType,
+		&c.ChargeType,
+		&c.Description,
+		&c.Amount,
+		&c.Method,
+		&c.ServiceDate,
+		&c.TaxName,
+		&c.ParentId,
+		&c.TransferredFrom,
+		&c.ShiftId,
+		&c.CreatedAt,
+	)
+}
+
+// GetOrCreateTx возвращает id основного счёта брони, создавая его при необходимости
+func GetOrCreateTx(ctx context.Context, q storage.Querier, bookingId int) (int, error) {
+	var id int
+	err := q.QueryRow(ctx, "SELECT id FROM Folios WHERE booking_id = $1 ORDER BY id LIMIT 1", bookingId).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, err
+	}
+
+	err = q.QueryRow(ctx, "INSERT INTO Folios(booking_id, name, status) VALUES($1, $2, $3) RETURNING id",
+		bookingId, "Основной", Open).Scan(&id)
+	return id, err
+}
+
+// Create открывает дополнительный счёт брони. Счёт компании по умолчанию
+// называется её именем
+func (f *Folios) Create(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if f.CompanyId != nil {
+		company, err := db_companies.GetByIDTx(ctx, db, *f.CompanyId)
+		if err != nil {
+			return err
+		}
+		if !company.Active {
+			return errors.New(data.CompanyInactive)
+		}
+		if f.Name == "" {
+			f.Name = company.Name
+		}
+	} else {
+		f.ChargeTypes = nil
+	}
+	if f.Name == "" {
+		return errors.New(data.WrongData)
+	}
+	if f.ChargeTypes == nil {
+		f.ChargeTypes = []string{}
+	}
+	// Основной счёт всегда создаётся первым
+	if _, err := GetOrCreateTx(ctx, db, f.BookingId); err != nil {
+		return err
+	}
+
+	f.Status = Open
+	f.Charges = []Charges{}
+	f.Taxes = []TaxTotals{}
+	return db.QueryRow(ctx, `INSERT INTO Folios(booking_id, name, status, company_id, charge_types)
+		VALUES($1, $2, $3, $4, $5) RETURNING id, created_at`,
+		f.BookingId, f.Name, f.Status, f.CompanyId, f.ChargeTypes).Scan(&f.Id, &f.CreatedAt)
+}
+
+// PostChargeTx добавляет начисление в счёт вместе с налогами по нему.
+// Включённые в цену налоги выделяются из суммы начисления отдельными строками
+func (c *Charges) PostChargeTx(ctx context.Context, q storage.Querier) error {
+	c.EntryType = EntryCharge
+	if c.ChargeType == ChargeTax {
+		return c.PostTx(ctx, q)
+	}
+
+	if err := c.defaultServiceDate(ctx, q); err != nil {
+		return err
+	}
+	net, taxes, err := db_taxes.CalculateTx(ctx, q, c.FolioId, c.ChargeType, c.Amount.Abs(), c.ServiceDate)
+	if err != nil {
+		return err
+	}
+	total := net
+	for _, line := range taxes {
+		total += line.Amount
+	}
+	if err := c.routeTx(ctx, q, total); err != nil {
+		return err
+	}
+	c.Amount = net
+	if err := c.PostTx(ctx, q); err != nil {
+		return err
+	}
+
+	for _, line := range taxes {
+		if line.Amount == 0 {
+			continue
+		}
+		tax := Charges{
+			FolioId:     c.FolioId,
+			EntryType:   EntryCharge,
+			ChargeType:  ChargeTax,
+			Description: line.Name,
+			Amount:      line.Amount,
+			ServiceDate: c.ServiceDate,
+			TaxName:     line.Name,
+			ParentId:    &c.Id,
+		}
+		if err := tax.PostTx(ctx, q); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// routeTx переносит начисление со счёта гостя на счёт компании той же брони,
+// если компания оплачивает этот тип начислений. При превышении кредитного
+// лимита начисление остаётся гостю, персонал получает уведомление.
+// Начисление прямо на счёт компании сверх лимита не проводится
+func (c *Charges) routeTx(ctx context.Context, q storage.Querier, amount money.Decimal) error {
+	var bookingId int
+	var companyId *int
+	if err := q.QueryRow(ctx, "SELECT booking_id, company_id FROM Folios WHERE id = $1", c.FolioId).Scan(&bookingId, &companyId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New(data.FolioNotFound)
+		}
+		return err
+	}
+	if companyId != nil {
+		return db_companies.CheckCreditTx(ctx, q, *companyId, amount)
+	}
+
+	var routeId, routeCompanyId int
+	var name string
+	err := q.QueryRow(ctx, `SELECT id, company_id, name FROM Folios
+		WHERE booking_id = $1 AND company_id IS NOT NULL AND status = $2
+		AND (cardinality(charge_types) = 0 OR $3 = ANY(charge_types))
+		ORDER BY id LIMIT 1`, bookingId, Open, c.ChargeType).Scan(&routeId, &routeCompanyId, &name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = db_companies.CheckCreditTx(ctx, q, routeCompanyId, amount)
+	if err != nil && err.Error() == data.CreditLimitExceeded {
+		message := fmt.Sprintf("Бронь #%d: начисление %s (%s) оставлено на счёте гостя - превышен кредитный лимит компании %s",
+			bookingId, amount, c.Description, name)
+		return db_notifications.Notify(ctx, q, "Кредитный лимит компании", message)
+	}
+	if err != nil {
+		return err
+	}
+	c.FolioId = routeId
+
+	return nil
+}
+
+// По умолчанию строка относится к текущему операционному дню
+func (c *Charges) defaultServiceDate(ctx context.Context, q storage.Querier) error {
+	if c.ServiceDate.Status == pgtype.Present {
+		return nil
+	}
+	settings, err := db_property.GetTx(ctx, q, false)
+	if err != nil {
+		return err
+	}
+	c.ServiceDate = settings.BusinessDate
+	return nil
+}
+
+// LockOpenTx блокирует счёт до конца транзакции и проверяет, что он открыт
+func LockOpenTx(ctx context.Context, q storage.Querier, folioId int) error {
+	var status string
+	if err := q.QueryRow(ctx, "SELECT status FROM Folios WHERE id = $1 FOR UPDATE", folioId).Scan(&status); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New(data.FolioNotFound)
+		}
+		return err
+	}
+	if status != Open {
+		return errors.New(data.FolioClosed)
+	}
+	return nil
+}
+
+// PaidTx возвращает, сколько гость заплатил по счёту и сколько ему уже вернули
+func PaidTx(ctx context.Context, q storage.Querier, folioId int) (paid, refunded money.Decimal, err error) {
+	err = q.QueryRow(ctx, `SELECT COALESCE(-sum(amount) FILTER (WHERE entry_type = $2), 0),
+			COALESCE(sum(amount) FILTER (WHERE entry_type = $3), 0)
+		FROM FolioCharges WHERE folio_id = $1`, folioId, EntryPayment, EntryRefund).Scan(&paid, &refunded)
+	return paid, refunded, err
+}
+
+// PostTx добавляет в счёт строку вида c.EntryType без проверок суммы.
+// Сумма приводится к знаку влияния на баланс. Закрытый счёт не принимает записей
+func (c *Charges) PostTx(ctx context.Context, q storage.Querier) error {
+	if err := LockOpenTx(ctx, q, c.FolioId); err != nil {
+		return err
+	}
+
+	switch c.EntryType {
+	case EntryCharge, EntryRefund:
+		c.Amount = c.Amount.Abs()
+	case EntryPayment:
+		c.Amount = -c.Amount.Abs()
+	}
+
+	// К кассовой смене относятся только оплаты и возвраты
+	if c.EntryType != EntryPayment && c.EntryType != EntryRefund {
+		c.ShiftId = nil
+	}
+	if c.ShiftId != nil {
+		if err := db_shifts.CheckOpenTx(ctx, q, *c.ShiftId); err != nil {
+			return err
+		}
+	}
+
+	if err := c.defaultServiceDate(ctx, q); err != nil {
+		return err
+	}
+
+	postQ := `INSERT INTO FolioCharges(folio_id, entry_type, charge_type, description, amount, method, service_date,
+			tax_name, parent_charge_id, transferred_from, shift_id)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id, created_at`
+
+	return q.QueryRow(ctx, postQ,
+		c.FolioId, c.EntryType, c.ChargeType, c.Description, c.Amount, c.Method, c.ServiceDate,
+		c.TaxName, c.ParentId, c.TransferredFrom, c.ShiftId,
+	).Scan(&c.Id, &c.CreatedAt)
+}
+
+// Post добавляет в счёт строку вида c.EntryType. Сумма передаётся положительной,
+// кроме корректировки: её знак означает увеличение или уменьшение долга.
+// Оплата проводится только в открытой кассовой смене. Возвраты оформляются
+// заявкой на возврат (с причиной и одобрением крупных сумм), а не этим методом
+func (c *Charges) Post(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	switch c.EntryType {
+	case EntryCharge:
+		if c.Amount <= 0 || c.ChargeType == "" {
+			return errors.New(data.WrongData)
+		}
+		if c.ChargeType == ChargeTax && c.TaxName == "" {
+			return errors.New(data.WrongData)
+		}
+	case EntryPayment:
+		if c.Amount <= 0 || c.Method == "" {
+			return errors.New(data.WrongData)
+		}
+		if c.ShiftId == nil {
+			return errors.New(data.ShiftNotOpen)
+		}
+	case EntryAdjustment:
+		if c.Amount == 0 || c.Description == "" {
+			return errors.New(data.WrongData)
+		}
+	default:
+		return errors.New(data.WrongData)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if c.EntryType == EntryCharge {
+		err = c.PostChargeTx(ctx, tx)
+	} else {
+		err = c.PostTx(ctx, tx)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Transfer переносит начисление на другой открытый счёт вместе с его налогами
+func (t *TransferRequest) Transfer(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var charge Charges
+	if err := scanCharge(tx.QueryRow(ctx, selectChargesQ+" WHERE id = $1 AND entry_type = $2 FOR UPDATE", t.ChargeId, EntryCharge), &charge); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New(data.ChargeNotFound)
+		}
+		return err
+	}
+	if charge.FolioId == t.FolioId {
+		return errors.New(data.WrongData)
+	}
+
+	var statuses []string
+	if err := tx.QueryRow(ctx, "SELECT array_agg(status) FROM (SELECT status FROM Folios WHERE id IN ($1, $2) FOR UPDATE) f",
+		charge.FolioId, t.FolioId).Scan(&statuses); err != nil {
+		return err
+	}
+	if len(statuses) != 2 {
+		return errors.New(data.FolioNotFound)
+	}
+	for _, status := range statuses {
+		if status != Open {
+			return errors.New(data.FolioClosed)
+		}
+	}
+
+	// Перенос на счёт компании - в пределах её кредитного лимита
+	var companyId *int
+	if err := tx.QueryRow(ctx, "SELECT company_id FROM Folios WHERE id = $1", t.FolioId).Scan(&companyId); err != nil {
+		return err
+	}
+	if companyId != nil {
+		var amount money.Decimal
+		if err := tx.QueryRow(ctx, "SELECT sum(amount) FROM FolioCharges WHERE (id = $1 OR parent_charge_id = $1) AND folio_id = $2",
+			charge.Id, charge.FolioId).Scan(&amount); err != nil {
+			return err
+		}
+		if err := db_companies.CheckCreditTx(ctx, tx, *companyId, amount); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE FolioCharges SET folio_id = $1, transferred_from = $2
+		WHERE (id = $3 OR parent_charge_id = $3) AND folio_id = $2`,
+		t.FolioId, charge.FolioId, charge.Id); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// BookingBalanceTx - общий баланс счетов гостя по брони (без счетов компаний)
+func BookingBalanceTx(ctx context.Context, q storage.Querier, bookingId int) (money.Decimal, error) {
+	var balance money.Decimal
+	err := q.QueryRow(ctx, `SELECT COALESCE(sum(fc.amount), 0) FROM FolioCharges fc
+		JOIN Folios f ON f.id = fc.folio_id WHERE f.booking_id = $1 AND f.company_id IS NULL`, bookingId).Scan(&balance)
+	return balance, err
+}
+
+// CloseTx закрывает счета гостя по брони (при выезде). Счета компаний
+// остаются открытыми до оплаты по city ledger
+func CloseTx(ctx context.Context, q storage.Querier, bookingId int) error {
+	_, err := q.Exec(ctx, "UPDATE Folios SET status = $1 WHERE booking_id = $2 AND company_id IS NULL", Closed, bookingId)
+	return err
+}
+
+// GetByCompany возвращает счета компании по всем броням
+func GetByCompany(db *pgxpool.Pool, companyId int) ([]Folios, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return QueryList(ctx, db, "WHERE company_id = $1 ORDER BY id", companyId)
+}
+
+// Подгрузка строк и расчёт баланса с нарастающим итогом
+func loadCharges(ctx context.Context, q storage.Querier, folios []Folios) error {
+	if len(folios) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(folios))
+	index := make(map[int]int, len(folios))
+	for i := range folios {
+		ids[i] = folios[i].Id
+		index[folios[i].Id] = i
+		folios[i].Charges = []Charges{}
+		folios[i].Taxes = []TaxTotals{}
+	}
+
+	rows, err := q.Query(ctx, selectChargesQ+" WHERE folio_id = ANY($1) ORDER BY folio_id, service_date, id", ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var charge Charges
+		if err := scanCharge(rows, &charge); err != nil {
+			return err
+		}
+		folio := &folios[index[charge.FolioId]]
+		folio.Balance += charge.Amount
+		charge.RunningBalance = folio.Balance
+		folio.Charges = append(folio.Charges, charge)
+		if charge.TaxName != "" {
+			folio.addTax(charge.TaxName, charge.Amount)
+		}
+	}
+
+	return rows.Err()
+}
+
+func (f *Folios) addTax(name string, amount money.Decimal) {
+	for i := range f.Taxes {
+		if f.Taxes[i].Name == name {
+			f.Taxes[i].Amount += amount
+			return
+		}
+	}
+	f.Taxes = append(f.Taxes, TaxTotals{Name: name, Amount: amount})
+}
+
+// QueryList выполняет выборку счетов с произвольным условием
+func QueryList(ctx context.Context, q storage.Querier, where string, args ...interface{}) ([]Folios, error) {
+	rows, err := q.Query(ctx, selectFoliosQ+" "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var folios []Folios
+	for rows.Next() {
+		var folio Folios
+		if err := scanFolio(rows, &folio); err != nil {
+			return nil, err
+		}
+		folios = append(folios, folio)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := loadCharges(ctx, q, folios); err != nil {
+		return nil, err
+	}
+
+	return folios, nil
+}
+
+// GetByID возвращает счёт со всеми строками
+func GetByID(db *pgxpool.Pool, id int) (*Folios, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	folios, err := QueryList(ctx, db, "WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(folios) == 0 {
+		return nil, errors.New(data.FolioNotFound)
+	}
+
+	return &folios[0], nil
+}
+
+// GetByBooking возвращает все счета брони
+func GetByBooking(db *pgxpool.Pool, bookingId int) ([]Folios, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return QueryList(ctx, db, "WHERE booking_id = $1 ORDER BY id", bookingId)
+}
@@ -0,0 +1,364 @@
+package db_groups
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_booking "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/booking"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// Group statuses
+	Active    = "active"    // Действующая
+	Cancelled = "cancelled" // Отменена
+)
+
+// Groups - групповое бронирование (туристические группы, семьи)
+type Groups struct {
+	Id              int                   `json:"id"`
+	Name            string                `json:"name"`
+	ContactClientId int                   `json:"contact_client_id"`
+	Notes           string                `json:"notes"`
+	Status          string                `json:"status"`
+	CreatedAt       pgtype.Timestamptz    `json:"created_at"`
+	Bookings        []db_booking.Bookings `json:"bookings"`
+	RoomingList     []RoomingEntry        `json:"rooming_list"`
+	Totals          *Totals               `json:"totals,omitempty"`
+}
+
+// RoomingEntry - гость группы, распределённый по брони (номеру)
+type RoomingEntry struct {
+	Id        int    `json:"id"`
+	GroupId   int    `json:"group_id"`
+	BookingId int    `json:"booking_id"`
+	ClientId  *int   `json:"client_id,omitempty"`
+	GuestName string `json:"guest_name"`
+}
+
+// Totals - итоги по группе без учёта отменённых броней
+type Totals struct {
+	Rooms      int           `json:"rooms"`
+	Nights     int           `json:"nights"`
+	Guests     int           `json:"guests"`
+	TotalPrice money.Decimal `json:"total_price"`
+}
+
+// DatesRequest - перенос дат для всех активных броней группы
+type DatesRequest struct {
+	Id       int         `json:"id"`
+	Checkin  pgtype.Date `json:"check_in_data"`
+	Checkout pgtype.Date `json:"check_out_data"`
+}
+
+func (g *Groups) checkGroupActive(ctx context.Context, q storage.Querier) error {
+	var status string
+	if err := q.QueryRow(ctx, "SELECT status FROM BookingGroups WHERE id = $1", g.Id).Scan(&status); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New(data.GroupNotFound)
+		}
+		return err
+	}
+	if status != Active {
+		return errors.New(data.GroupNotFound)
+	}
+
+	return nil
+}
+
+// Create создаёт группу вместе со всеми бронями одной транзакцией
+func (g *Groups) Create(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	g.Status = Active
+	createGroupQ := `INSERT INTO BookingGroups(name, contact_client_id, notes, status)
+		VALUES($1, $2, $3, $4) RETURNING id, created_at`
+
+	if err := tx.QueryRow(ctx, createGroupQ, g.Name, g.ContactClientId, g.Notes, g.Status).Scan(&g.Id, &g.CreatedAt); err != nil {
+		return err
+	}
+
+	for i := range g.Bookings {
+		booking := &g.Bookings[i]
+		booking.GroupId = &g.Id
+		if booking.ClientId == 0 {
+			booking.ClientId = g.ContactClientId
+		}
+		if err := booking.CreateTx(ctx, tx); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (g *Groups) Edit(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	editQ := "UPDATE BookingGroups SET name = $1, contact_client_id = $2, notes = $3 WHERE id = $4 AND status = $5"
+
+	tag, err := db.Exec(ctx, editQ, g.Name, g.ContactClientId, g.Notes, g.Id, Active)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New(data.GroupNotFound)
+	}
+
+	return nil
+}
+
+// AddBooking добавляет в группу ещё одну бронь
+func (g *Groups) AddBooking(db *pgxpool.Pool, booking *db_booking.Bookings) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := g.checkGroupActive(ctx, tx); err != nil {
+		return err
+	}
+
+	booking.GroupId = &g.Id
+	if err := booking.CreateTx(ctx, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ChangeDates переносит все ещё не заехавшие брони группы на новые даты
+func (r *DatesRequest) ChangeDates(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	group := Groups{Id: r.Id}
+	if err := group.checkGroupActive(ctx, tx); err != nil {
+		return err
+	}
+
+	bookings, err := db_booking.QueryList(ctx, tx, "WHERE group_id = $1 AND status IN ($2, $3) ORDER BY id",
+		r.Id, db_booking.Tentative, db_booking.Confirmed)
+	if err != nil {
+		return err
+	}
+
+	for i := range bookings {
+		booking := &bookings[i]
+		booking.Checkin = r.Checkin
+		booking.Checkout = r.Checkout
+		// Нулевая цена пересчитывается по тарифу номера на новые даты
+		booking.TotalPrice = 0
+
+		if err := booking.EditTx(ctx, tx); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Cancel отменяет группу и все её не заехавшие брони
+func (g *Groups) Cancel(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, "UPDATE BookingGroups SET status = $1 WHERE id = $2 AND status = $3", Cancelled, g.Id, Active)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New(data.GroupNotFound)
+	}
+
+	// Брони отменяются по одной, чтобы освободить их промокоды
+	bookings, err := db_booking.QueryList(ctx, tx, "WHERE group_id = $1 AND status IN ($2, $3) ORDER BY id FOR UPDATE",
+		g.Id, db_booking.Tentative, db_booking.Confirmed)
+	if err != nil {
+		return err
+	}
+	for i := range bookings {
+		if err := bookings[i].CancelTx(ctx, tx); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// SetRoomingList полностью заменяет список проживающих группы
+func (g *Groups) SetRoomingList(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := g.checkGroupActive(ctx, tx); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM GroupRoomingList WHERE group_id = $1", g.Id); err != nil {
+		return err
+	}
+
+	insertQ := `INSERT INTO GroupRoomingList(group_id, booking_id, client_id, guest_name)
+		SELECT $1, id, $3, $4 FROM Bookings WHERE id = $2 AND group_id = $1`
+
+	for _, entry := range g.RoomingList {
+		tag, err := tx.Exec(ctx, insertQ, g.Id, entry.BookingId, entry.ClientId, entry.GuestName)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return errors.New(data.BookingNotFound)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (g *Groups) getRoomingList(ctx context.Context, q storage.Querier) ([]RoomingEntry, error) {
+	rows, err := q.Query(ctx,
+		"SELECT id, group_id, booking_id, client_id, guest_name FROM GroupRoomingList WHERE group_id = $1 ORDER BY booking_id, id",
+		g.Id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []RoomingEntry
+	for rows.Next() {
+		var entry RoomingEntry
+		if err := rows.Scan(&entry.Id, &entry.GroupId, &entry.BookingId, &entry.ClientId, &entry.GuestName); err != nil {
+			return nil, err
+		}
+		list = append(list, entry)
+	}
+
+	return list, rows.Err()
+}
+
+func (g *Groups) calculateTotals() {
+	totals := &Totals{}
+	activeBookings := make(map[int]bool)
+	for _, booking := range g.Bookings {
+		if booking.Status == db_booking.Cancelled || booking.Status == db_booking.NoShow {
+			continue
+		}
+		activeBookings[booking.Id] = true
+		totals.Rooms++
+		totals.Nights += booking.Nights()
+		totals.TotalPrice += booking.TotalPrice
+	}
+	for _, entry := range g.RoomingList {
+		if activeBookings[entry.BookingId] {
+			totals.Guests++
+		}
+	}
+	g.Totals = totals
+}
+
+// GetGroup возвращает группу с бронями, списком проживающих и итогами
+func GetGroup(db *pgxpool.Pool, id int) (*Groups, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	group := Groups{}
+	getQ := "SELECT id, name, contact_client_id, notes, status, created_at FROM BookingGroups WHERE id = $1"
+	if err := db.QueryRow(ctx, getQ, id).Scan(
+		&group.Id,
+		&group.Name,
+		&group.ContactClientId,
+		&group.Notes,
+		&group.Status,
+		&group.CreatedAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New(data.GroupNotFound)
+		}
+		return nil, err
+	}
+
+	bookings, err := db_booking.QueryList(ctx, db, "WHERE group_id = $1 ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	group.Bookings = bookings
+
+	roomingList, err := group.getRoomingList(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	group.RoomingList = roomingList
+	group.calculateTotals()
+
+	return &group, nil
+}
+
+func (g *Groups) GetGroups(db *pgxpool.Pool) ([]Groups, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	getQ := "SELECT id, name, contact_client_id, notes, status, created_at FROM BookingGroups ORDER BY id DESC"
+	rows, err := db.Query(ctx, getQ)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []Groups
+	for rows.Next() {
+		var group Groups
+		if err := rows.Scan(
+			&group.Id,
+			&group.Name,
+			&group.ContactClientId,
+			&group.Notes,
+			&group.Status,
+			&group.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,179 @@
+package db_holds
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_booking "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/booking"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// Hold statuses
+	Active    = "active"    // Номер удерживается
+	Converted = "converted" // Превращено в бронь
+	Released  = "released"  // Снято вручную
+	Expired   = "expired"   // Истекло
+)
+
+// Holds - кратковременное удержание номера на время разговора с гостем
+type Holds struct {
+	Id        int                `json:"id"`
+	RoomId    int                `json:"room_id"`
+	ClientId  *int               `json:"client_id,omitempty"`
+	Checkin   pgtype.Date        `json:"check_in_data"`
+	Checkout  pgtype.Date        `json:"check_out_data"`
+	Notes     string             `json:"notes"`
+	Status    string             `json:"status"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+const selectHoldQ = `SELECT id, room_id, client_id, check_in_date, check_out_date,
+	notes, status, expires_at, created_at FROM RoomHolds`
+
+func scanHold(row pgx.Row, h *Holds) error {
+	return row.Scan(
+		&h.Id,
+		&h.RoomId,
+		&h.ClientId,
+		&h.Checkin,
+		&h.Checkout,
+		&h.Notes,
+		&h.Status,
+		&h.ExpiresAt,
+		&h.CreatedAt,
+	)
+}
+
+// Create ставит удержание на номер, если он свободен. ttl - время жизни удержания
+func (h *Holds) Create(db *pgxpool.Pool, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if h.Checkin.Status != pgtype.Present || h.Checkout.Status != pgtype.Present {
+		return errors.New(data.WrongData)
+	}
+	if !h.Checkout.Time.After(h.Checkin.Time) {
+		return errors.New(data.WrongDates)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := db_booking.CheckRoomAvailable(ctx, tx, h.RoomId, 0, h.Checkin, h.Checkout); err != nil {
+		return err
+	}
+
+	h.Status = Active
+	createQ := `INSERT INTO RoomHolds(room_id, client_id, check_in_date, check_out_date, notes, status, expires_at)
+		VALUES($1, $2, $3, $4, $5, $6, now() + $7 * interval '1 second')
+		RETURNING id, expires_at, created_at`
+
+	if err := tx.QueryRow(ctx, createQ,
+		h.RoomId, h.ClientId, h.Checkin, h.Checkout, h.Notes, h.Status, int(ttl.Seconds()),
+	).Scan(&h.Id, &h.ExpiresAt, &h.CreatedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (h *Holds) Release(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tag, err := db.Exec(ctx, "UPDATE RoomHolds SET status = $1 WHERE id = $2 AND status = $3", Released, h.Id, Active)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New(data.HoldNotFound)
+	}
+
+	return nil
+}
+
+// Convert превращает действующее удержание в бронь на тот же номер и даты
+func (h *Holds) Convert(db *pgxpool.Pool, booking *db_booking.Bookings) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := scanHold(tx.QueryRow(ctx,
+		selectHoldQ+" WHERE id = $1 AND status = $2 AND expires_at > now() FOR UPDATE", h.Id, Active,
+	), h); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New(data.HoldNotFound)
+		}
+		return err
+	}
+
+	// Сначала снимаем удержание, иначе оно само помешает созданию брони
+	if _, err := tx.Exec(ctx, "UPDATE RoomHolds SET status = $1 WHERE id = $2", Converted, h.Id); err != nil {
+		return err
+	}
+	h.Status = Converted
+
+	booking.RoomId = h.RoomId
+	booking.Checkin = h.Checkin
+	booking.Checkout = h.Checkout
+	if booking.ClientId == 0 && h.ClientId != nil {
+		booking.ClientId = *h.ClientId
+	}
+	if booking.Notes == "" {
+		booking.Notes = h.Notes
+	}
+	if err := booking.CreateTx(ctx, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (h *Holds) GetActive(db *pgxpool.Pool) ([]Holds, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.Query(ctx, selectHoldQ+" WHERE status = $1 AND expires_at > now() ORDER BY expires_at", Active)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var holds []Holds
+	for rows.Next() {
+		var hold Holds
+		if err := scanHold(rows, &hold); err != nil {
+			return nil, err
+		}
+		holds = append(holds, hold)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return holds, nil
+}
+
+// ExpireHolds помечает просроченные удержания. Вызывается фоновой задачей
+func ExpireHolds(ctx context.Context, db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := db.Exec(ctx, "UPDATE RoomHolds SET status = $1 WHERE status = $2 AND expires_at <= now()", Expired, Active)
+	return err
+}
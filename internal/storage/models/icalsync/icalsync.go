@@ -0,0 +1,257 @@
+package db_icalsync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/ical"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_booking "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/booking"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Клиент-заглушка, на которого записываются брони из внешних календарей
+const externalClientName = "Внешнее бронирование (iCal)"
+
+// ImportRequest - куда импортировать календарь. Если ClientId не указан,
+// брони записываются на клиента-заглушку
+type ImportRequest struct {
+	RoomId   int    `json:"room_id" form:"room_id"`
+	ClientId int    `json:"client_id" form:"client_id"`
+	Url      string `json:"url"`
+}
+
+type ImportResult struct {
+	Created   int      `json:"created"`
+	Updated   int      `json:"updated"`
+	Cancelled int      `json:"cancelled"`
+	Unchanged int      `json:"unchanged"`
+	Errors    []string `json:"errors"`
+}
+
+func date(t time.Time) pgtype.Date {
+	return pgtype.Date{Time: t, Status: pgtype.Present}
+}
+
+// Export возвращает занятые даты номера (roomId) или всех номеров типа (roomType)
+// начиная с сегодняшнего дня. Имена гостей в ленту не попадают
+func Export(db *pgxpool.Pool, roomId int, roomType string) ([]ical.Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	bookings, err := db_booking.QueryList(ctx, db,
+		`WHERE status <> ALL($1) AND check_out_date >= current_date
+		AND (room_id = $2 OR room_id IN (SELECT id FROM rooms WHERE $3 <> '' AND room_type = $3))
+		ORDER BY check_in_date`,
+		db_booking.InactiveStatuses, roomId, roomType)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]ical.Event, 0, len(bookings))
+	for _, booking := range bookings {
+		uid := fmt.Sprintf("booking-%d@hotelcrm", booking.Id)
+		if booking.ExternalUid != nil {
+			uid = *booking.ExternalUid
+		}
+		events = append(events, ical.Event{
+			UID:     uid,
+			Summary: "Booked",
+			Start:   booking.Checkin.Time,
+			End:     booking.Checkout.Time,
+		})
+	}
+
+	return events, nil
+}
+
+// Предельный размер загружаемого календаря
+const maxCalendarSize = 5 << 20
+
+// Адрес назначения проверяется при каждом соединении (и после редиректов),
+// поэтому подмена DNS не приведёт к запросу во внутреннюю сеть
+func checkPublicAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return errors.New(data.ForbiddenURL)
+	}
+	return nil
+}
+
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return errors.New(data.ForbiddenURL)
+	}
+	return nil
+}
+
+// FetchURL загружает календарь по ссылке. Разрешены только http и https
+// и только публичные адреса (без локальной и внутренней сети и метаданных облака)
+func FetchURL(rawURL string) ([]ical.Event, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.New(data.WrongData)
+	}
+	if err := checkScheme(u); err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: checkPublicAddress}
+	client := http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: 5 * time.Second},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New(data.ForbiddenURL)
+			}
+			return checkScheme(req.URL)
+		},
+	}
+
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch calendar: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCalendarSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxCalendarSize {
+		return nil, errors.New(data.CalendarTooLarge)
+	}
+
+	return ical.Parse(bytes.NewReader(body))
+}
+
+func (r *ImportRequest) externalClient(ctx context.Context, db *pgxpool.Pool) (int, error) {
+	if r.ClientId != 0 {
+		return r.ClientId, nil
+	}
+
+	var id int
+	err := db.QueryRow(ctx, "SELECT id FROM Clients WHERE full_name = $1 ORDER BY id LIMIT 1", externalClientName).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, err
+	}
+
+	err = db.QueryRow(ctx, "INSERT INTO Clients (full_name, email, phone, notes) VALUES ($1, '', '', $2) RETURNING id",
+		externalClientName, "Создан автоматически для импорта iCal").Scan(&id)
+	return id, err
+}
+
+// Import создаёт блокирующие брони по событиям календаря. Повторный импорт
+// того же календаря находит брони по UID и обновляет или отменяет их
+func (r *ImportRequest) Import(db *pgxpool.Pool, events []ical.Event) (*ImportResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if r.RoomId == 0 {
+		return nil, errors.New(data.WrongData)
+	}
+
+	clientId, err := r.externalClient(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{Errors: []string{}}
+	for _, event := range events {
+		if err := r.importEvent(ctx, db, clientId, event, result); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %s", event.UID, err.Error()))
+		}
+	}
+
+	return result, nil
+}
+
+func (r *ImportRequest) importEvent(ctx context.Context, db *pgxpool.Pool, clientId int, event ical.Event, result *ImportResult) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	existing, err := findByUid(ctx, tx, r.RoomId, event.UID)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case event.Cancelled && (existing == nil || existing.Status == db_booking.Cancelled):
+		result.Unchanged++
+		return nil
+	case event.Cancelled:
+		if err := existing.CancelTx(ctx, tx); err != nil {
+			return err
+		}
+		result.Cancelled++
+	case existing == nil:
+		uid := event.UID
+		booking := db_booking.Bookings{
+			ClientId:    clientId,
+			RoomId:      r.RoomId,
+			Checkin:     date(event.Start),
+			Checkout:    date(event.End),
+			Notes:       "iCal: " + event.Summary,
+			ExternalUid: &uid,
+		}
+		if err := booking.CreateTx(ctx, tx); err != nil {
+			return err
+		}
+		result.Created++
+	case existing.Status == db_booking.Cancelled:
+		// Отменённую бронь не воскрешаем - это решение персонала
+		result.Unchanged++
+		return nil
+	case existing.Checkin.Time.Equal(event.Start) && existing.Checkout.Time.Equal(event.End):
+		result.Unchanged++
+		return nil
+	default:
+		existing.Checkin = date(event.Start)
+		existing.Checkout = date(event.End)
+		if err := existing.EditTx(ctx, tx); err != nil {
+			return err
+		}
+		result.Updated++
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UID уникален только в пределах ленты одного канала, поэтому бронь ищется в номере импорта
+func findByUid(ctx context.Context, q storage.Querier, roomId int, uid string) (*db_booking.Bookings, error) {
+	bookings, err := db_booking.QueryList(ctx, q, "WHERE room_id = $1 AND external_uid = $2 FOR UPDATE", roomId, uid)
+	if err != nil {
+		return nil, err
+	}
+	if len(bookings) == 0 {
+		return nil, nil
+	}
+
+	return &bookings[0], nil
+}
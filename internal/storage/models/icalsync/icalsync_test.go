@@ -0,0 +1,81 @@
+package db_icalsync
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+)
+
+func TestCheckScheme(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{url: "https://example.com/calendar.ics", want: true},
+		{url: "http://example.com:8080/feed", want: true},
+		{url: "file:///etc/passwd", want: false},
+		{url: "ftp://example.com/calendar.ics", want: false},
+		{url: "gopher://example.com", want: false},
+		{url: "https:///calendar.ics", want: false},
+		{url: "/calendar.ics", want: false},
+	}
+
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatalf("url.Parse(%q): %v", tt.url, err)
+		}
+		if got := checkScheme(u) == nil; got != tt.want {
+			t.Errorf("checkScheme(%q) allowed = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPublicAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{address: "93.184.216.34:443", want: true},
+		{address: "[2606:2800:220:1:248:1893:25c8:1946]:443", want: true},
+		{address: "127.0.0.1:80", want: false},
+		{address: "[::1]:80", want: false},
+		{address: "10.0.0.5:80", want: false},
+		{address: "172.16.1.1:80", want: false},
+		{address: "192.168.1.10:80", want: false},
+		{address: "169.254.169.254:80", want: false},
+		{address: "0.0.0.0:80", want: false},
+		{address: "[fd00::1]:80", want: false},
+		{address: "[fe80::1]:80", want: false},
+		{address: "224.0.0.1:80", want: false},
+		{address: "no-port", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := checkPublicAddress("tcp", tt.address, nil) == nil; got != tt.want {
+			t.Errorf("checkPublicAddress(%q) allowed = %v, want %v", tt.address, got, tt.want)
+		}
+	}
+}
+
+func TestFetchURLRejectsLocalServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"))
+	}))
+	defer server.Close()
+
+	_, err := FetchURL(server.URL)
+	if err == nil {
+		t.Fatal("FetchURL() to a loopback address succeeded, want error")
+	}
+}
+
+func TestFetchURLRejectsScheme(t *testing.T) {
+	_, err := FetchURL("file:///etc/passwd")
+	if err == nil || err.Error() != data.ForbiddenURL {
+		t.Errorf("FetchURL() error = %v, want %q", err, data.ForbiddenURL)
+	}
+}
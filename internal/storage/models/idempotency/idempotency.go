@@ -0,0 +1,89 @@
+package db_idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Keys - сохранённый ответ на запрос с заголовком Idempotency-Key.
+// Пока запрос выполняется, StatusCode равен нулю
+type Keys struct {
+	Key          string
+	RequestHash  string
+	StatusCode   int
+	ResponseBody []byte
+	ContentType  string
+}
+
+// Reserve занимает ключ под новый запрос. Если ключ уже есть и не истёк,
+// возвращает сохранённую запись и false
+func Reserve(ctx context.Context, db *pgxpool.Pool, key, requestHash string, ttl time.Duration) (*Keys, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	// Истёкший ключ можно использовать повторно
+	if _, err := db.Exec(ctx,
+		"DELETE FROM IdempotencyKeys WHERE key = $1 AND created_at <= now() - $2 * interval '1 second'",
+		key, int(ttl.Seconds())); err != nil {
+		return nil, false, err
+	}
+
+	tag, err := db.Exec(ctx,
+		"INSERT INTO IdempotencyKeys(key, request_hash, status_code) VALUES($1, $2, 0) ON CONFLICT (key) DO NOTHING",
+		key, requestHash)
+	if err != nil {
+		return nil, false, err
+	}
+	if tag.RowsAffected() == 1 {
+		return nil, true, nil
+	}
+
+	stored := Keys{Key: key}
+	err = db.QueryRow(ctx,
+		"SELECT request_hash, status_code, COALESCE(response_body, ''), COALESCE(content_type, '') FROM IdempotencyKeys WHERE key = $1",
+		key).Scan(&stored.RequestHash, &stored.StatusCode, &stored.ResponseBody, &stored.ContentType)
+	if err != nil {
+		// Ключ успели освободить между запросами - отвечаем как на незавершённый,
+		// клиент повторит запрос
+		if errors.Is(err, pgx.ErrNoRows) {
+			stored.RequestHash = requestHash
+			return &stored, false, nil
+		}
+		return nil, false, err
+	}
+
+	return &stored, false, nil
+}
+
+// Save сохраняет ответ для повторов
+func (k *Keys) Save(ctx context.Context, db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := db.Exec(ctx,
+		"UPDATE IdempotencyKeys SET status_code = $1, response_body = $2, content_type = $3 WHERE key = $4",
+		k.StatusCode, k.ResponseBody, k.ContentType, k.Key)
+	return err
+}
+
+// Release освобождает ключ, если запрос не удался и его можно повторить
+func Release(ctx context.Context, db *pgxpool.Pool, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := db.Exec(ctx, "DELETE FROM IdempotencyKeys WHERE key = $1", key)
+	return err
+}
+
+// DeleteExpired удаляет ключи старше ttl. Вызывается фоновой задачей
+func DeleteExpired(ctx context.Context, db *pgxpool.Pool, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := db.Exec(ctx, "DELETE FROM IdempotencyKeys WHERE created_at <= now() - $1 * interval '1 second'", int(ttl.Seconds()))
+	return err
+}
@@ -0,0 +1,573 @@
+package db_invoices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/invoice"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_companies "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/companies"
+	db_folio "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/folio"
+	db_property "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/property"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// Invoice kinds
+	KindInvoice    = "invoice"     // Счёт
+	KindCreditNote = "credit_note" // Корректировочный счёт (сторно)
+
+	DefaultSeries           = "INV"
+	DefaultCreditNoteSeries = "CN"
+)
+
+// Invoices - выставленный счёт. После выставления не меняется,
+// исправления делаются корректировочным счётом
+type Invoices struct {
+	Id            int    `json:"id"`
+	Series        string `json:"series"`
+	Number        int    `json:"number"`
+	InvoiceNumber string `json:"invoice_number"`
+	Kind          string `json:"kind"`
+	CreditNoteFor *int   `json:"credit_note_for,omitempty"`
+	// Номер исправляемого счёта (для корректировочного счёта)
+	CorrectsNumber string `json:"corrects_number,omitempty"`
+	// Фолио счёта; у сводного счёта компании - 0
+	FolioId int `json:"folio_id"`
+	// Код подтверждения брони фолио (в сводном счёте - в строках)
+	ConfirmationCode string `json:"confirmation_code,omitempty"`
+	// Компания и период сводного счёта по всем её фолио
+	CompanyId  *int        `json:"company_id,omitempty"`
+	PeriodFrom pgtype.Date `json:"period_from"`
+	PeriodTo   pgtype.Date `json:"period_to"`
+	IssueDate  pgtype.Date `json:"issue_date"`
+	// Срок оплаты: дата выставления плюс отсрочка компании, если фолио - её счёт
+	DueDate       pgtype.Date        `json:"due_date"`
+	SellerName    string             `json:"seller_name"`
+	SellerTaxId   string             `json:"seller_tax_id"`
+	SellerAddress string             `json:"seller_address"`
+	BuyerName     string             `json:"buyer_name"`
+	BuyerTaxId    string             `json:"buyer_tax_id"`
+	BuyerAddress  string             `json:"buyer_address"`
+	Reason        string             `json:"reason"`
+	Lines         []Lines            `json:"lines"`
+	Taxes         []TaxTotals        `json:"taxes"`
+	Currency      string             `json:"currency"`
+	NetTotal      money.Decimal      `json:"net_total"`
+	TaxTotal      money.Decimal      `json:"tax_total"`
+	Total         money.Decimal      `json:"total"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+}
+
+// Lines - строка счёта (копия строки фолио на момент выставления)
+type Lines struct {
+	ChargeId    *int          `json:"charge_id,omitempty"`
+	Description string        `json:"description"`
+	ServiceDate pgtype.Date   `json:"service_date"`
+	Amount      money.Decimal `json:"amount"`
+	TaxName     string        `json:"tax_name,omitempty"`
+}
+
+// TaxTotals - разбивка налогов счёта
+type TaxTotals struct {
+	Name   string        `json:"name"`
+	Amount money.Decimal `json:"amount"`
+}
+
+const selectInvoicesQ = `SELECT id, series, number, invoice_number, kind, credit_note_for, COALESCE(folio_id, 0),
+	COALESCE(confirmation_code, ''), company_id, period_from, period_to, issue_date,
+	due_date, seller_name, seller_tax_id, seller_address, buyer_name, buyer_tax_id, buyer_address, reason,
+	currency, net_total, tax_total, total, created_at,
+	COALESCE((SELECT o.invoice_number FROM Invoices o WHERE o.id = Invoices.credit_note_for), '') FROM Invoices`
+
+func scanInvoice(row pgx.Row, i *Invoices) error {
+	return row.Scan(
+		&i.Id,
+		&i.Series,
+		&i.Number,
+		&i.InvoiceNumber,
+		&i.Kind,
+		&i.CreditNoteFor,
+		&i.FolioId,
+		&i.ConfirmationCode,
+		&i.CompanyId,
+		&i.PeriodFrom,
+		&i.PeriodTo,
+		&i.IssueDate,
+		&i.DueDate,
+		&i.SellerName,
+		&i.SellerTaxId,
+		&i.SellerAddress,
+		&i.BuyerName,
+		&i.BuyerTaxId,
+		&i.BuyerAddress,
+		&i.Reason,
+		&i.Currency,
+		&i.NetTotal,
+		&i.TaxTotal,
+		&i.Total,
+		&i.CreatedAt,
+		&i.CorrectsNumber,
+	)
+}
+
+// nextNumber выдаёт следующий номер серии. Строка серии блокируется до
+// конца транзакции, а при откате номер возвращается - нумерация без пропусков
+func nextNumber(ctx context.Context, q storage.Querier, series string) (int, error) {
+	var number int
+	err := q.QueryRow(ctx, `INSERT INTO InvoiceSeries(series, last_number) VALUES($1, 1)
+		ON CONFLICT (series) DO UPDATE SET last_number = InvoiceSeries.last_number + 1
+		RETURNING last_number`, series).Scan(&number)
+	return number, err
+}
+
+// Итоги и разбивка налогов по строкам
+func (i *Invoices) calculateTotals() {
+	i.NetTotal, i.TaxTotal = 0, 0
+	taxes := make(map[string]money.Decimal)
+	for _, line := range i.Lines {
+		if line.TaxName == "" {
+			i.NetTotal += line.Amount
+			continue
+		}
+		i.TaxTotal += line.Amount
+		taxes[line.TaxName] += line.Amount
+	}
+
+	i.Taxes = make([]TaxTotals, 0, len(taxes))
+	for name, amount := range taxes {
+		i.Taxes = append(i.Taxes, TaxTotals{Name: name, Amount: amount})
+	}
+	sort.Slice(i.Taxes, func(a, b int) bool { return i.Taxes[a].Name < i.Taxes[b].Name })
+
+	i.Total = i.NetTotal + i.TaxTotal
+}
+
+func (i *Invoices) insertTx(ctx context.Context, q storage.Querier) error {
+	number, err := nextNumber(ctx, q, i.Series)
+	if err != nil {
+		return err
+	}
+	i.Number = number
+	i.InvoiceNumber = fmt.Sprintf("%s-%06d", i.Series, number)
+
+	settings, err := db_property.GetTx(ctx, q, false)
+	if err != nil {
+		return err
+	}
+	i.IssueDate = settings.BusinessDate
+
+	var terms int
+	if i.CompanyId != nil && i.FolioId == 0 {
+		if err := q.QueryRow(ctx, "SELECT payment_terms FROM Companies WHERE id = $1", *i.CompanyId).Scan(&terms); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return errors.New(data.CompanyNotFound)
+			}
+			return err
+		}
+	} else if err := q.QueryRow(ctx, `SELECT COALESCE(co.payment_terms, 0) FROM Folios f
+		LEFT JOIN Companies co ON co.id = f.company_id WHERE f.id = $1`, i.FolioId).Scan(&terms); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New(data.FolioNotFound)
+		}
+		return err
+	}
+	if i.PeriodFrom.Status != pgtype.Present || i.PeriodTo.Status != pgtype.Present {
+		i.PeriodFrom = pgtype.Date{Status: pgtype.Null}
+		i.PeriodTo = pgtype.Date{Status: pgtype.Null}
+	}
+	i.DueDate = pgtype.Date{Time: i.IssueDate.Time.AddDate(0, 0, terms), Status: pgtype.Present}
+	i.SellerName = settings.SellerName
+	i.SellerTaxId = settings.SellerTaxId
+	i.SellerAddress = settings.SellerAddress
+	i.Currency = settings.BaseCurrency
+	i.calculateTotals()
+
+	insertQ := `INSERT INTO Invoices(series, number, invoice_number, kind, credit_note_for, folio_id, issue_date, due_date,
+			seller_name, seller_tax_id, seller_address, buyer_name, buyer_tax_id, buyer_address, reason,
+			currency, net_total, tax_total, total, company_id, period_from, period_to, confirmation_code)
+		VALUES($1, $2, $3, $4, $5, NULLIF($6, 0), $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22,
+			NULLIF($23, ''))
+		RETURNING id, created_at`
+	if err := q.QueryRow(ctx, insertQ,
+		i.Series, i.Number, i.InvoiceNumber, i.Kind, i.CreditNoteFor, i.FolioId, i.IssueDate, i.DueDate,
+		i.SellerName, i.SellerTaxId, i.SellerAddress, i.BuyerName, i.BuyerTaxId, i.BuyerAddress, i.Reason,
+		i.Currency, i.NetTotal, i.TaxTotal, i.Total, i.CompanyId, i.PeriodFrom, i.PeriodTo, i.ConfirmationCode,
+	).Scan(&i.Id, &i.CreatedAt); err != nil {
+		return err
+	}
+
+	for _, line := range i.Lines {
+		if _, err := q.Exec(ctx,
+			"INSERT INTO InvoiceLines(invoice_id, charge_id, description, service_date, amount, tax_name) VALUES($1, $2, $3, $4, $5, $6)",
+			i.Id, line.ChargeId, line.Description, line.ServiceDate, line.Amount, line.TaxName,
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Issue выставляет счёт по начислениям фолио, ещё не вошедшим в действующие
+// счета (счёт, к которому выписан корректировочный, не считается).
+// Покупатель по умолчанию - компания, если фолио - её счёт, иначе клиент брони.
+// Фолио блокируется, чтобы параллельные счета не включили одни начисления дважды
+func (i *Invoices) Issue(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if i.Series == "" {
+		i.Series = DefaultSeries
+	}
+	i.Kind = KindInvoice
+	i.CreditNoteFor = nil
+	i.CompanyId = nil
+	i.PeriodFrom, i.PeriodTo = pgtype.Date{}, pgtype.Date{}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := tx.QueryRow(ctx, `SELECT COALESCE(b.confirmation_code, '') FROM Folios f
+		JOIN Bookings b ON b.id = f.booking_id WHERE f.id = $1 FOR UPDATE OF f`, i.FolioId).Scan(&i.ConfirmationCode); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New(data.FolioNotFound)
+		}
+		return err
+	}
+
+	if i.BuyerName == "" {
+		if err := tx.QueryRow(ctx, `SELECT COALESCE(co.name, c.full_name), COALESCE(co.tax_id, ''), COALESCE(co.address, '')
+			FROM Folios f
+			JOIN Bookings b ON b.id = f.booking_id JOIN Clients c ON c.id = b.client_id
+			LEFT JOIN Companies co ON co.id = f.company_id
+			WHERE f.id = $1`, i.FolioId).Scan(&i.BuyerName, &i.BuyerTaxId, &i.BuyerAddress); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return errors.New(data.FolioNotFound)
+			}
+			return err
+		}
+	}
+
+	rows, err := tx.Query(ctx, `SELECT fc.id, fc.description, fc.service_date, fc.amount, fc.tax_name
+		FROM FolioCharges fc
+		WHERE fc.folio_id = $1 AND fc.entry_type IN ($2, $3)
+		AND NOT EXISTS (
+			SELECT 1 FROM InvoiceLines l JOIN Invoices inv ON inv.id = l.invoice_id
+			WHERE l.charge_id = fc.id AND inv.kind = $4
+			AND NOT EXISTS (SELECT 1 FROM Invoices cn WHERE cn.credit_note_for = inv.id)
+		)
+		ORDER BY fc.service_date, fc.id`, i.FolioId, db_folio.EntryCharge, db_folio.EntryAdjustment, KindInvoice)
+	if err != nil {
+		return err
+	}
+	i.Lines = []Lines{}
+	for rows.Next() {
+		var line Lines
+		if err := rows.Scan(&line.ChargeId, &line.Description, &line.ServiceDate, &line.Amount, &line.TaxName); err != nil {
+			rows.Close()
+			return err
+		}
+		i.Lines = append(i.Lines, line)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(i.Lines) == 0 {
+		return errors.New(data.NothingToInvoice)
+	}
+
+	if err := i.insertTx(ctx, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// IssueCompany выставляет компании сводный счёт за период по всем её фолио:
+// в него входят начисления с датой услуги в периоде, ещё не вошедшие в
+// действующие счета. Фолио компании блокируются до конца транзакции
+func (i *Invoices) IssueCompany(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if i.CompanyId == nil || i.PeriodFrom.Status != pgtype.Present || i.PeriodTo.Status != pgtype.Present ||
+		i.PeriodTo.Time.Before(i.PeriodFrom.Time) {
+		return errors.New(data.WrongData)
+	}
+	if i.Series == "" {
+		i.Series = DefaultSeries
+	}
+	i.Kind = KindInvoice
+	i.CreditNoteFor = nil
+	i.FolioId = 0
+	i.ConfirmationCode = ""
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	company, err := db_companies.GetByIDTx(ctx, tx, *i.CompanyId)
+	if err != nil {
+		return err
+	}
+	if i.BuyerName == "" {
+		i.BuyerName = company.Name
+		i.BuyerTaxId = company.TaxId
+		i.BuyerAddress = company.Address
+	}
+
+	if _, err := tx.Exec(ctx, "SELECT id FROM Folios WHERE company_id = $1 ORDER BY id FOR UPDATE", company.Id); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(ctx, `SELECT fc.id, COALESCE(NULLIF(b.confirmation_code, '') || ': ', '') || fc.description,
+			fc.service_date, fc.amount, fc.tax_name
+		FROM FolioCharges fc
+		JOIN Folios f ON f.id = fc.folio_id JOIN Bookings b ON b.id = f.booking_id
+		WHERE f.company_id = $1 AND fc.service_date BETWEEN $2 AND $3 AND fc.entry_type IN ($4, $5)
+		AND NOT EXISTS (
+			SELECT 1 FROM InvoiceLines l JOIN Invoices inv ON inv.id = l.invoice_id
+			WHERE l.charge_id = fc.id AND inv.kind = $6
+			AND NOT EXISTS (SELECT 1 FROM Invoices cn WHERE cn.credit_note_for = inv.id)
+		)
+		ORDER BY fc.service_date, f.id, fc.id`,
+		company.Id, i.PeriodFrom, i.PeriodTo, db_folio.EntryCharge, db_folio.EntryAdjustment, KindInvoice)
+	if err != nil {
+		return err
+	}
+	i.Lines = []Lines{}
+	for rows.Next() {
+		var line Lines
+		if err := rows.Scan(&line.ChargeId, &line.Description, &line.ServiceDate, &line.Amount, &line.TaxName); err != nil {
+			rows.Close()
+			return err
+		}
+		i.Lines = append(i.Lines, line)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(i.Lines) == 0 {
+		return errors.New(data.NothingToInvoice)
+	}
+
+	if err := i.insertTx(ctx, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// CreditNote сторнирует выставленный счёт целиком: строки копируются с
+// обратным знаком, а начисления снова можно включить в новый счёт
+func (i *Invoices) CreditNote(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if i.CreditNoteFor == nil || i.Reason == "" {
+		return errors.New(data.WrongData)
+	}
+	if i.Series == "" {
+		i.Series = DefaultCreditNoteSeries
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	original, err := getTx(ctx, tx, *i.CreditNoteFor, true)
+	if err != nil {
+		return err
+	}
+	if original.Kind != KindInvoice {
+		return errors.New(data.WrongData)
+	}
+	var credited int
+	if err := tx.QueryRow(ctx, "SELECT count(*) FROM Invoices WHERE credit_note_for = $1", original.Id).Scan(&credited); err != nil {
+		return err
+	}
+	if credited > 0 {
+		return errors.New(data.InvoiceCredited)
+	}
+
+	i.Kind = KindCreditNote
+	i.CorrectsNumber = original.InvoiceNumber
+	i.FolioId = original.FolioId
+	i.ConfirmationCode = original.ConfirmationCode
+	i.CompanyId = original.CompanyId
+	i.PeriodFrom = original.PeriodFrom
+	i.PeriodTo = original.PeriodTo
+	i.BuyerName = original.BuyerName
+	i.BuyerTaxId = original.BuyerTaxId
+	i.BuyerAddress = original.BuyerAddress
+	i.Lines = make([]Lines, len(original.Lines))
+	for n, line := range original.Lines {
+		line.Amount = -line.Amount
+		i.Lines[n] = line
+	}
+
+	if err := i.insertTx(ctx, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func getTx(ctx context.Context, q storage.Querier, id int, forUpdate bool) (*Invoices, error) {
+	getQ := selectInvoicesQ + " WHERE id = $1"
+	if forUpdate {
+		getQ += " FOR UPDATE"
+	}
+
+	var inv Invoices
+	if err := scanInvoice(q.QueryRow(ctx, getQ, id), &inv); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New(data.InvoiceNotFound)
+		}
+		return nil, err
+	}
+
+	rows, err := q.Query(ctx, `SELECT charge_id, description, service_date, amount, tax_name
+		FROM InvoiceLines WHERE invoice_id = $1 ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	inv.Lines = []Lines{}
+	for rows.Next() {
+		var line Lines
+		if err := rows.Scan(&line.ChargeId, &line.Description, &line.ServiceDate, &line.Amount, &line.TaxName); err != nil {
+			return nil, err
+		}
+		inv.Lines = append(inv.Lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Суммы хранятся при выставлении, из строк пересчитывается только разбивка налогов
+	net, tax, total := inv.NetTotal, inv.TaxTotal, inv.Total
+	inv.calculateTotals()
+	inv.NetTotal, inv.TaxTotal, inv.Total = net, tax, total
+
+	return &inv, nil
+}
+
+func GetByID(db *pgxpool.Pool, id int) (*Invoices, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return getTx(ctx, db, id, false)
+}
+
+// GetByFolio возвращает счета и корректировочные счета фолио без строк
+func GetByFolio(db *pgxpool.Pool, folioId int) ([]Invoices, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.Query(ctx, selectInvoicesQ+" WHERE folio_id = $1 ORDER BY id", folioId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invoices []Invoices
+	for rows.Next() {
+		var inv Invoices
+		if err := scanInvoice(rows, &inv); err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, inv)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invoices, nil
+}
+
+// GetByCompany возвращает сводные счета компании и корректировки к ним без строк
+func GetByCompany(db *pgxpool.Pool, companyId int) ([]Invoices, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.Query(ctx, selectInvoicesQ+" WHERE company_id = $1 ORDER BY id", companyId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invoices []Invoices
+	for rows.Next() {
+		var inv Invoices
+		if err := scanInvoice(rows, &inv); err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, inv)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invoices, nil
+}
+
+// Document готовит счёт к печати
+func (i *Invoices) Document() invoice.Document {
+	doc := invoice.Document{
+		Title:     "Счёт",
+		Number:    i.InvoiceNumber,
+		Booking:   i.ConfirmationCode,
+		IssueDate: i.IssueDate.Time,
+		Seller:    invoice.Party{Name: i.SellerName, TaxId: i.SellerTaxId, Address: i.SellerAddress},
+		Buyer:     invoice.Party{Name: i.BuyerName, TaxId: i.BuyerTaxId, Address: i.BuyerAddress},
+		Currency:  i.Currency,
+		NetTotal:  i.NetTotal,
+		TaxTotal:  i.TaxTotal,
+		Total:     i.Total,
+	}
+
+	if i.PeriodFrom.Status == pgtype.Present {
+		doc.PeriodFrom = i.PeriodFrom.Time
+		doc.PeriodTo = i.PeriodTo.Time
+	}
+
+	if i.Kind == KindCreditNote {
+		doc.Title = "Корректировочный счёт"
+		doc.Corrects = i.CorrectsNumber
+	} else if i.DueDate.Time.After(i.IssueDate.Time) {
+		doc.DueDate = i.DueDate.Time
+	}
+
+	for _, line := range i.Lines {
+		if line.TaxName != "" {
+			continue
+		}
+		doc.Lines = append(doc.Lines, invoice.Line{Date: line.ServiceDate.Time, Description: line.Description, Amount: line.Amount})
+	}
+	for _, tax := range i.Taxes {
+		doc.Taxes = append(doc.Taxes, invoice.Tax{Name: tax.Name, Amount: tax.Amount})
+	}
+
+	return doc
+}
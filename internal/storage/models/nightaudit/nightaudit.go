@@ -0,0 +1,355 @@
+package db_nightaudit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_booking "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/booking"
+	db_folio "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/folio"
+	db_promo "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/promo"
+	db_property "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/property"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// RunByScheduler - автор аудита, запущенного по расписанию
+const RunByScheduler = "scheduler"
+
+// Statistics - снимок загрузки и выручки за операционный день
+type Statistics struct {
+	BusinessDate  pgtype.Date   `json:"business_date"`
+	RoomsTotal    int           `json:"rooms_total"`
+	RoomsOccupied int           `json:"rooms_occupied"`
+	Occupancy     float64       `json:"occupancy"`
+	RoomRevenue   money.Decimal `json:"room_revenue"`
+	TaxRevenue    money.Decimal `json:"tax_revenue"`
+	ADR           money.Decimal `json:"adr"`
+	RevPAR        money.Decimal `json:"revpar"`
+	Arrivals      int           `json:"arrivals"`
+	Departures    int           `json:"departures"`
+	NoShows       int           `json:"no_shows"`
+}
+
+// Audits - итог ночного аудита
+type Audits struct {
+	Id             int                `json:"id"`
+	BusinessDate   pgtype.Date        `json:"business_date"`
+	RunBy          string             `json:"run_by"`
+	NoShowBookings []int              `json:"no_show_bookings"`
+	ChargesPosted  int                `json:"charges_posted"`
+	Statistics     Statistics         `json:"statistics"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+}
+
+const selectAuditsQ = "SELECT id, business_date, run_by, no_show_bookings, charges_posted, summary, created_at FROM NightAudits"
+
+func scanAudit(row pgx.Row, a *Audits) error {
+	var summary []byte
+	if err := row.Scan(
+		&a.Id,
+		&a.BusinessDate,
+		&a.RunBy,
+		&a.NoShowBookings,
+		&a.ChargesPosted,
+		&summary,
+		&a.CreatedAt,
+	); err != nil {
+		return err
+	}
+	return json.Unmarshal(summary, &a.Statistics)
+}
+
+// Run закрывает текущий операционный день: отмечает незаезды, начисляет
+// проживание и налог проживающим гостям, сохраняет статистику дня и
+// переводит операционную дату на следующий день. Всё выполняется одной
+// транзакцией под блокировкой настроек отеля, поэтому повторный или
+// параллельный запуск не закроет один день дважды.
+// Закрыть можно только день, который уже закончился по календарю: иначе сегодняшние
+// заезды стали бы незаездами, а проживание начислилось бы раньше срока
+func Run(ctx context.Context, db *pgxpool.Pool, runBy string) (*Audits, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	settings, err := db_property.GetTx(ctx, tx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	businessDate := settings.BusinessDate
+	today := truncateDay(time.Now())
+	if !businessDate.Time.Before(today) {
+		return nil, errors.New(data.AuditTooEarly)
+	}
+
+	audit := Audits{BusinessDate: businessDate, RunBy: runBy}
+
+	audit.NoShowBookings, err = markNoShows(ctx, tx, businessDate)
+	if err != nil {
+		return nil, err
+	}
+
+	audit.ChargesPosted, err = postNightCharges(ctx, tx, businessDate)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := collectStatistics(ctx, tx, businessDate, &audit.Statistics); err != nil {
+		return nil, err
+	}
+	audit.Statistics.NoShows = len(audit.NoShowBookings)
+
+	summary, err := json.Marshal(audit.Statistics)
+	if err != nil {
+		return nil, err
+	}
+
+	saveQ := `INSERT INTO NightAudits(business_date, run_by, no_show_bookings, charges_posted, summary)
+		VALUES($1, $2, $3, $4, $5) RETURNING id, created_at`
+	if err := tx.QueryRow(ctx, saveQ,
+		businessDate, runBy, audit.NoShowBookings, audit.ChargesPosted, summary,
+	).Scan(&audit.Id, &audit.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	next := pgtype.Date{Time: businessDate.Time.AddDate(0, 0, 1), Status: pgtype.Present}
+	if err := db_property.SetBusinessDateTx(ctx, tx, next); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &audit, nil
+}
+
+// CatchUp закрывает все прошедшие операционные дни (для запуска по расписанию,
+// в том числе после простоя сервера)
+func CatchUp(ctx context.Context, db *pgxpool.Pool) error {
+	for {
+		settings, err := db_property.Get(db)
+		if err != nil {
+			return err
+		}
+		if !settings.BusinessDate.Time.Before(truncateDay(time.Now())) {
+			return nil
+		}
+
+		if _, err := Run(ctx, db, RunByScheduler); err != nil {
+			return err
+		}
+	}
+}
+
+// Подтверждённые и предварительные брони, не заехавшие в день заезда.
+// Их промокоды, как и при отмене, снова доступны в пределах лимитов
+func markNoShows(ctx context.Context, q storage.Querier, businessDate pgtype.Date) ([]int, error) {
+	rows, err := q.Query(ctx, "UPDATE Bookings SET status = $1 WHERE status IN ($2, $3) AND check_in_date <= $4 RETURNING id",
+		db_booking.NoShow, db_booking.Tentative, db_booking.Confirmed, businessDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := db_promo.ReleaseTx(ctx, q, id); err != nil {
+			return nil, err
+		}
+	}
+
+	return ids, nil
+}
+
+// Начисляет ночь проживания с налогами каждой брони, где гость проживает в эту ночь.
+// Для брони с переездами берётся тариф сегмента, в который попадает ночь.
+// Уже начисленная за дату ночь повторно не начисляется
+func postNightCharges(ctx context.Context, tx pgx.Tx, businessDate pgtype.Date) (int, error) {
+	type stay struct {
+		booking     db_booking.Bookings
+		segmentRate *money.Decimal
+	}
+
+	var stays []stay
+	err := func() error {
+		rows, err := tx.Query(ctx, `SELECT b.id, b.check_in_date, b.check_out_date, b.total_price, s.nightly_rate
+			FROM Bookings b
+			LEFT JOIN BookingSegments s ON s.booking_id = b.id AND s.date_from <= $2 AND s.date_to > $2
+			WHERE b.status = $1 AND b.check_in_date <= $2 AND b.check_out_date > $2
+			AND NOT EXISTS (
+				SELECT 1 FROM Folios f JOIN FolioCharges fc ON fc.folio_id = f.id
+				WHERE f.booking_id = b.id AND fc.charge_type = $3 AND fc.service_date = $2
+			) ORDER BY b.id`, db_booking.CheckedIn, businessDate, db_folio.ChargeRoom)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var s stay
+			if err := rows.Scan(&s.booking.Id, &s.booking.Checkin, &s.booking.Checkout, &s.booking.TotalPrice, &s.segmentRate); err != nil {
+				return err
+			}
+			stays = append(stays, s)
+		}
+		return rows.Err()
+	}()
+	if err != nil {
+		return 0, err
+	}
+
+	posted := 0
+	for _, stay := range stays {
+		booking := stay.booking
+		folioId, err := db_folio.GetOrCreateTx(ctx, tx, booking.Id)
+		if err != nil {
+			return 0, err
+		}
+
+		// Копейки округления начисляются в последнюю ночь, чтобы ночи в сумме давали цену брони
+		nights := booking.Nights()
+		nightPrice := booking.TotalPrice.Div(nights)
+		if businessDate.Time.Equal(booking.Checkout.Time.AddDate(0, 0, -1)) {
+			nightPrice = booking.TotalPrice - nightPrice.Mul(nights-1)
+		}
+		if stay.segmentRate != nil {
+			nightPrice = *stay.segmentRate
+		}
+		room := db_folio.Charges{
+			FolioId:     folioId,
+			ChargeType:  db_folio.ChargeRoom,
+			Description: fmt.Sprintf("Проживание %s", businessDate.Time.Format("2006-01-02")),
+			Amount:      nightPrice,
+			ServiceDate: businessDate,
+		}
+		if err := room.PostChargeTx(ctx, tx); err != nil {
+			return 0, err
+		}
+		posted++
+	}
+
+	return posted, nil
+}
+
+func collectStatistics(ctx context.Context, q storage.Querier, businessDate pgtype.Date, stats *Statistics) error {
+	stats.BusinessDate = businessDate
+
+	// Номера вне эксплуатации не продаются и не входят в номерной фонд дня
+	if err := q.QueryRow(ctx, `SELECT count(*) FROM rooms r WHERE NOT EXISTS (
+			SELECT 1 FROM RoomBlocks rb WHERE rb.room_id = r.id AND rb.date_from <= $1 AND rb.date_to > $1
+		)`, businessDate).Scan(&stats.RoomsTotal); err != nil {
+		return err
+	}
+
+	if err := q.QueryRow(ctx,
+		"SELECT count(DISTINCT room_id) FROM "+db_booking.RoomStaysQ+" b WHERE status = $1 AND check_in_date <= $2 AND check_out_date > $2",
+		db_booking.CheckedIn, businessDate,
+	).Scan(&stats.RoomsOccupied); err != nil {
+		return err
+	}
+
+	if err := q.QueryRow(ctx, `SELECT
+			COALESCE(sum(fc.amount) FILTER (WHERE fc.charge_type = $2), 0),
+			COALESCE(sum(fc.amount) FILTER (WHERE fc.charge_type = $3), 0)
+		FROM FolioCharges fc WHERE fc.service_date = $1`,
+		businessDate, db_folio.ChargeRoom, db_folio.ChargeTax,
+	).Scan(&stats.RoomRevenue, &stats.TaxRevenue); err != nil {
+		return err
+	}
+
+	if err := q.QueryRow(ctx, `SELECT
+			count(*) FILTER (WHERE check_in_date = $1 AND status IN ($2, $3)),
+			count(*) FILTER (WHERE check_out_date = $1 AND status IN ($2, $3))
+		FROM Bookings`,
+		businessDate, db_booking.CheckedIn, db_booking.CheckedOut,
+	).Scan(&stats.Arrivals, &stats.Departures); err != nil {
+		return err
+	}
+
+	if stats.RoomsTotal > 0 {
+		stats.Occupancy = round(float64(stats.RoomsOccupied) * 100 / float64(stats.RoomsTotal))
+		stats.RevPAR = stats.RoomRevenue.Div(stats.RoomsTotal)
+	}
+	if stats.RoomsOccupied > 0 {
+		stats.ADR = stats.RoomRevenue.Div(stats.RoomsOccupied)
+	}
+
+	return nil
+}
+
+// GetList возвращает проведённые аудиты за период, новые первыми
+func GetList(db *pgxpool.Pool, from, to pgtype.Date) ([]Audits, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.Query(ctx, selectAuditsQ+" WHERE business_date BETWEEN $1 AND $2 ORDER BY business_date DESC", from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var audits []Audits
+	for rows.Next() {
+		var audit Audits
+		if err := scanAudit(rows, &audit); err != nil {
+			return nil, err
+		}
+		audits = append(audits, audit)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return audits, nil
+}
+
+// GetReport возвращает итог аудита за операционный день
+func GetReport(db *pgxpool.Pool, businessDate pgtype.Date) (*Audits, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var audit Audits
+	if err := scanAudit(db.QueryRow(ctx, selectAuditsQ+" WHERE business_date = $1", businessDate), &audit); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New(data.AuditNotFound)
+		}
+		return nil, err
+	}
+
+	return &audit, nil
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
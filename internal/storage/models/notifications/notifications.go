@@ -0,0 +1,69 @@
+package db_notifications
+
+import (
+	"context"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Notifications - уведомления для персонала (лента на ресепшене)
+type Notifications struct {
+	Id        int                `json:"id"`
+	Title     string             `json:"title"`
+	Message   string             `json:"message"`
+	IsRead    bool               `json:"is_read"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+// Notify добавляет уведомление для персонала
+func Notify(ctx context.Context, q storage.Querier, title, message string) error {
+	_, err := q.Exec(ctx, "INSERT INTO StaffNotifications(title, message) VALUES($1, $2)", title, message)
+	return err
+}
+
+func (n *Notifications) MarkRead(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := db.Exec(ctx, "UPDATE StaffNotifications SET is_read = true WHERE id = $1", n.Id)
+	return err
+}
+
+func (n *Notifications) GetNotifications(db *pgxpool.Pool, onlyUnread bool) ([]Notifications, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	getQ := `SELECT id, title, message, is_read, created_at FROM StaffNotifications
+		WHERE NOT $1 OR NOT is_read
+		ORDER BY created_at DESC LIMIT 200`
+
+	rows, err := db.Query(ctx, getQ, onlyUnread)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notifications
+	for rows.Next() {
+		var notification Notifications
+		if err := rows.Scan(
+			&notification.Id,
+			&notification.Title,
+			&notification.Message,
+			&notification.IsRead,
+			&notification.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
@@ -0,0 +1,132 @@
+package db_overbooking
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_booking "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/booking"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Allowances - сколько номеров типа можно продать сверх физического фонда на дату
+type Allowances struct {
+	RoomType  string      `json:"room_type"`
+	StayDate  pgtype.Date `json:"stay_date"`
+	Allowance int         `json:"allowance"`
+}
+
+// AllowanceRequest - установка квоты на диапазон дат (включительно)
+type AllowanceRequest struct {
+	RoomType  string      `json:"room_type"`
+	DateFrom  pgtype.Date `json:"date_from"`
+	DateTo    pgtype.Date `json:"date_to"`
+	Allowance int         `json:"allowance"`
+}
+
+// ReportRow - ночь, на которую продано больше номеров, чем есть физически
+type ReportRow struct {
+	RoomType  string      `json:"room_type"`
+	StayDate  pgtype.Date `json:"stay_date"`
+	Physical  int         `json:"physical"`
+	Allowance int         `json:"allowance"`
+	Sold      int         `json:"sold"`
+	Excess    int         `json:"excess"`
+}
+
+func (r *AllowanceRequest) SetAllowance(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if r.RoomType == "" || r.Allowance < 0 ||
+		r.DateFrom.Status != pgtype.Present || r.DateTo.Status != pgtype.Present {
+		return errors.New(data.WrongData)
+	}
+	if r.DateTo.Time.Before(r.DateFrom.Time) {
+		return errors.New(data.WrongDates)
+	}
+
+	setQ := `INSERT INTO OverbookingAllowances(room_type, stay_date, allowance)
+		SELECT $1, d::date, $4 FROM generate_series($2::date, $3::date, interval '1 day') d
+		ON CONFLICT (room_type, stay_date) DO UPDATE SET allowance = EXCLUDED.allowance`
+
+	_, err := db.Exec(ctx, setQ, r.RoomType, r.DateFrom, r.DateTo, r.Allowance)
+	return err
+}
+
+func (a *Allowances) GetAllowances(db *pgxpool.Pool, from, to pgtype.Date) ([]Allowances, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	getQ := `SELECT room_type, stay_date, allowance FROM OverbookingAllowances
+		WHERE stay_date BETWEEN $1 AND $2 AND allowance > 0
+		ORDER BY stay_date, room_type`
+
+	rows, err := db.Query(ctx, getQ, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var allowances []Allowances
+	for rows.Next() {
+		var allowance Allowances
+		if err := rows.Scan(&allowance.RoomType, &allowance.StayDate, &allowance.Allowance); err != nil {
+			return nil, err
+		}
+		allowances = append(allowances, allowance)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return allowances, nil
+}
+
+// GetReport - ночи периода (включительно), где подтверждённых броней больше,
+// чем физических номеров. По нему дежурный менеджер планирует переселения
+func GetReport(db *pgxpool.Pool, from, to pgtype.Date) ([]ReportRow, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	reportQ := `WITH nights AS (
+			SELECT d::date AS night FROM generate_series($1::date, $2::date, interval '1 day') d
+		), types AS (
+			SELECT room_type, COUNT(*) AS physical FROM rooms GROUP BY room_type
+		), sold AS (
+			SELECT t.room_type, n.night, t.physical,
+				(SELECT COUNT(*) FROM ` + db_booking.RoomStaysQ + ` b JOIN rooms r ON r.id = b.room_id
+					WHERE r.room_type = t.room_type AND b.status <> ALL($3)
+					AND b.check_in_date <= n.night AND b.check_out_date > n.night) AS sold
+			FROM types t CROSS JOIN nights n
+		)
+		SELECT s.room_type, s.night, s.physical, COALESCE(a.allowance, 0), s.sold, s.sold - s.physical
+		FROM sold s
+		LEFT JOIN OverbookingAllowances a ON a.room_type = s.room_type AND a.stay_date = s.night
+		WHERE s.sold > s.physical
+		ORDER BY s.night, s.room_type`
+
+	rows, err := db.Query(ctx, reportQ, from, to, db_booking.InactiveStatuses)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var report []ReportRow
+	for rows.Next() {
+		var row ReportRow
+		if err := rows.Scan(&row.RoomType, &row.StayDate, &row.Physical, &row.Allowance, &row.Sold, &row.Excess); err != nil {
+			return nil, err
+		}
+		report = append(report, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
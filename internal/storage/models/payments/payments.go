@@ -0,0 +1,369 @@
+package db_payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/payments"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_currency "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/currency"
+	db_folio "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/folio"
+	db_property "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/property"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// MethodCard - способ оплаты в фолио для платежей через провайдера
+const MethodCard = "card"
+
+// Payments - платёж через платёжного провайдера, привязанный к фолио.
+// В фолио попадают только списания и возвраты, блокировка суммы баланс не меняет.
+// Суммы платежа - в валюте платежа, в фолио они пересчитываются в базовую валюту
+// по курсу, зафиксированному при блокировке
+type Payments struct {
+	Id             int                `json:"id"`
+	FolioId        int                `json:"folio_id"`
+	Provider       string             `json:"provider"`
+	Reference      string             `json:"reference"`
+	Currency       string             `json:"currency"`
+	ExchangeRate   money.Rate         `json:"exchange_rate"`
+	Amount         money.Decimal      `json:"amount"`
+	CapturedAmount money.Decimal      `json:"captured_amount"`
+	RefundedAmount money.Decimal      `json:"refunded_amount"`
+	Status         string             `json:"status"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt      pgtype.Timestamptz `json:"updated_at"`
+}
+
+const selectPaymentsQ = `SELECT id, folio_id, provider, reference, currency, exchange_rate,
+	amount, captured_amount, refunded_amount, status, created_at, updated_at FROM Payments`
+
+func scanPayment(row pgx.Row, p *Payments) error {
+	return row.Scan(
+		&p.Id,
+		&p.FolioId,
+		&p.Provider,
+		&p.Reference,
+		&p.Currency,
+		&p.ExchangeRate,
+		&p.Amount,
+		&p.CapturedAmount,
+		&p.RefundedAmount,
+		&p.Status,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+}
+
+// Authorise блокирует сумму на карте гостя и сохраняет платёж.
+// Без валюты платёж принимается в базовой валюте отеля. Если платёж
+// не удалось сохранить, блокировка снимается у провайдера
+func (p *Payments) Authorise(db *pgxpool.Pool, provider payments.Provider, token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	if p.Amount <= 0 {
+		return errors.New(data.WrongData)
+	}
+
+	settings, err := db_property.Get(db)
+	if err != nil {
+		return err
+	}
+	if p.Currency == "" {
+		p.Currency = settings.BaseCurrency
+	}
+	if p.Currency, err = money.NormalizeCurrency(p.Currency); err != nil {
+		return errors.New(data.WrongCurrency)
+	}
+	if p.ExchangeRate, err = db_currency.RateTx(ctx, db, p.Currency); err != nil {
+		return err
+	}
+
+	var status string
+	if err := db.QueryRow(ctx, "SELECT status FROM Folios WHERE id = $1", p.FolioId).Scan(&status); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New(data.FolioNotFound)
+		}
+		return err
+	}
+	if status != db_folio.Open {
+		return errors.New(data.FolioClosed)
+	}
+
+	result, err := provider.Authorise(ctx, payments.AuthoriseRequest{
+		Amount:      p.Amount,
+		Currency:    p.Currency,
+		Token:       token,
+		Description: fmt.Sprintf("Фолио #%d", p.FolioId),
+	})
+	if err != nil {
+		return err
+	}
+
+	p.Provider = provider.Name()
+	p.Reference = result.Reference
+	p.Status = result.Status
+	createQ := `INSERT INTO Payments(folio_id, provider, reference, currency, exchange_rate, amount,
+			captured_amount, refunded_amount, status)
+		VALUES($1, $2, $3, $4, $5, $6, 0, 0, $7) RETURNING id, created_at, updated_at`
+
+	if err := db.QueryRow(ctx, createQ,
+		p.FolioId, p.Provider, p.Reference, p.Currency, p.ExchangeRate, p.Amount, p.Status,
+	).
+		Scan(&p.Id, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		// Контекст запроса мог уже истечь - блокировка снимается в своём
+		voidCtx, voidCancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer voidCancel()
+		if _, voidErr := provider.Void(voidCtx, p.Reference); voidErr != nil {
+			return fmt.Errorf("%w; void %s: %v", err, p.Reference, voidErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Строка платежа блокируется на время обращения к провайдеру,
+// чтобы одну операцию не выполнили дважды
+func lockTx(ctx context.Context, q storage.Querier, where string, arg interface{}) (*Payments, error) {
+	var p Payments
+	if err := scanPayment(q.QueryRow(ctx, selectPaymentsQ+" WHERE "+where+" FOR UPDATE", arg), &p); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New(data.PaymentNotFound)
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *Payments) saveTx(ctx context.Context, q storage.Querier) error {
+	return q.QueryRow(ctx, `UPDATE Payments SET captured_amount = $1, refunded_amount = $2, status = $3, updated_at = now()
+		WHERE id = $4 RETURNING updated_at`, p.CapturedAmount, p.RefundedAmount, p.Status, p.Id).Scan(&p.UpdatedAt)
+}
+
+// Строка фолио в базовой валюте; для платежа в другой валюте в описании остаётся исходная сумма.
+// Операции по уведомлениям провайдера проводятся без кассовой смены (shiftId - nil)
+func (p *Payments) folioEntry(entryType, description string, amount money.Decimal, shiftId *int) db_folio.Charges {
+	entry := db_folio.Charges{
+		FolioId:     p.FolioId,
+		EntryType:   entryType,
+		Description: fmt.Sprintf("%s (%s)", description, p.Reference),
+		Amount:      amount.MulRate(p.ExchangeRate),
+		Method:      MethodCard,
+		ShiftId:     shiftId,
+	}
+	if p.ExchangeRate != money.UnitRate {
+		entry.Description = fmt.Sprintf("%s (%s, %s по курсу %s)", description, p.Reference,
+			money.Money{Amount: amount, Currency: p.Currency}, p.ExchangeRate)
+	}
+	return entry
+}
+
+// Списание отражается оплатой в фолио
+func (p *Payments) capturedTx(ctx context.Context, q storage.Querier, amount money.Decimal, shiftId *int) error {
+	p.Status = payments.Captured
+	p.CapturedAmount = amount
+
+	entry := p.folioEntry(db_folio.EntryPayment, "Оплата картой", amount, shiftId)
+	if err := entry.PostTx(ctx, q); err != nil {
+		return err
+	}
+
+	return p.saveTx(ctx, q)
+}
+
+// Возврат отражается в фолио, полностью возвращённый платёж меняет статус
+func (p *Payments) refundedTx(ctx context.Context, q storage.Querier, amount money.Decimal, shiftId *int) error {
+	p.RefundedAmount += amount
+	if p.RefundedAmount >= p.CapturedAmount {
+		p.Status = payments.Refunded
+	}
+
+	entry := p.folioEntry(db_folio.EntryRefund, "Возврат на карту", amount, shiftId)
+	if err := entry.PostTx(ctx, q); err != nil {
+		return err
+	}
+
+	return p.saveTx(ctx, q)
+}
+
+// Capture списывает заблокированную сумму (0 - всю) в кассовой смене shiftId
+func Capture(db *pgxpool.Pool, provider payments.Provider, id int, amount money.Decimal, shiftId *int) (*Payments, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	p, err := lockTx(ctx, tx, "id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if p.Status != payments.Authorised {
+		return nil, payments.ErrWrongState
+	}
+	if amount == 0 {
+		amount = p.Amount
+	}
+	if amount < 0 || amount > p.Amount {
+		return nil, errors.New(data.WrongData)
+	}
+
+	if _, err := provider.Capture(ctx, p.Reference, amount); err != nil {
+		return nil, err
+	}
+	if err := p.capturedTx(ctx, tx, amount, shiftId); err != nil {
+		return nil, err
+	}
+
+	return p, tx.Commit(ctx)
+}
+
+// recordRefundTx записывает возврат, уже проведённый провайдером, в кассовой смене shiftId
+func recordRefundTx(ctx context.Context, q storage.Querier, id int, amount money.Decimal, shiftId *int) (*Payments, error) {
+	p, err := lockTx(ctx, q, "id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if p.Status != payments.Captured {
+		return nil, payments.ErrWrongState
+	}
+	if amount <= 0 || amount > p.CapturedAmount-p.RefundedAmount {
+		return nil, errors.New(data.RefundExceedsPaid)
+	}
+
+	if err := p.refundedTx(ctx, q, amount, shiftId); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Void снимает блокировку без списания
+func Void(db *pgxpool.Pool, provider payments.Provider, id int) (*Payments, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	p, err := lockTx(ctx, tx, "id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if p.Status != payments.Authorised {
+		return nil, payments.ErrWrongState
+	}
+
+	if _, err := provider.Void(ctx, p.Reference); err != nil {
+		return nil, err
+	}
+	p.Status = payments.Voided
+	if err := p.saveTx(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	return p, tx.Commit(ctx)
+}
+
+// HandleWebhook применяет уведомление провайдера. Повтор уведомления
+// с тем же event_id игнорируется, статус меняется только вперёд
+// (уведомление об уже применённой операции ничего не делает)
+func HandleWebhook(ctx context.Context, db *pgxpool.Pool, provider string, event *payments.WebhookEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, "INSERT INTO PaymentWebhookEvents(provider, event_id) VALUES($1, $2) ON CONFLICT DO NOTHING",
+		provider, event.EventId)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	p, err := lockTx(ctx, tx, "reference = $1", event.Reference)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case event.Status == payments.Captured && p.Status == payments.Authorised:
+		amount := event.Amount
+		if amount <= 0 {
+			amount = p.Amount
+		}
+		if amount > p.Amount {
+			return errors.New(data.CaptureTooLarge)
+		}
+		err = p.capturedTx(ctx, tx, amount, nil)
+	case event.Status == payments.Refunded && p.Status == payments.Captured:
+		// Сверка с общей суммой возвратов у провайдера: возвраты, уже проведённые
+		// через наш API или ещё записываемые по заявкам, повторно в фолио не попадают
+		total := p.CapturedAmount
+		if event.RefundedTotal > 0 && event.RefundedTotal < total {
+			total = event.RefundedTotal
+		}
+		var processing money.Decimal
+		if err := tx.QueryRow(ctx, "SELECT COALESCE(sum(amount), 0) FROM RefundRequests WHERE payment_id = $1 AND status = $2",
+			p.Id, RefundProcessing).Scan(&processing); err != nil {
+			return err
+		}
+		if amount := total - p.RefundedAmount - processing; amount > 0 {
+			err = p.refundedTx(ctx, tx, amount, nil)
+		}
+	case (event.Status == payments.Voided || event.Status == payments.Failed) && p.Status == payments.Authorised:
+		p.Status = event.Status
+		err = p.saveTx(ctx, tx)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetByFolio возвращает платежи фолио
+func GetByFolio(db *pgxpool.Pool, folioId int) ([]Payments, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.Query(ctx, selectPaymentsQ+" WHERE folio_id = $1 ORDER BY id", folioId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Payments
+	for rows.Next() {
+		var p Payments
+		if err := scanPayment(rows, &p); err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
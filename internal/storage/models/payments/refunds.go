@@ -0,0 +1,422 @@
+package db_payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/payments"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_folio "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/folio"
+	db_notifications "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/notifications"
+	db_property "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/property"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// Refund request statuses
+	RefundPending    = "pending"    // Ждёт решения менеджера
+	RefundProcessing = "processing" // Отправлен провайдеру, результат ещё не записан
+	RefundApproved   = "approved"   // Возврат проведён через провайдера
+	RefundRejected   = "rejected"   // Отклонён менеджером
+)
+
+// RefundRequests - заявка на возврат: по платежу через провайдера (PaymentId)
+// или ручной возврат по счёту (наличными и т.п., PaymentId пуст, способ - Method).
+// Возврат проводится сразу, пока вместе с уже возвращённым и ожидающими заявками
+// он не превышает порог, иначе - только после одобрения менеджером.
+// Сумма - в валюте платежа, BaseAmount - в базовой валюте отеля.
+// Провайдер вызывается вне транзакций: заявка сначала сохраняется в статусе
+// RefundProcessing, результат записывается отдельной транзакцией. Заявка,
+// оставшаяся в RefundProcessing, требует ручной сверки с провайдером
+type RefundRequests struct {
+	Id          int                `json:"id"`
+	PaymentId   *int               `json:"payment_id"`
+	FolioId     int                `json:"folio_id"`
+	Method      string             `json:"method"`
+	Amount      money.Decimal      `json:"amount"`
+	BaseAmount  money.Decimal      `json:"base_amount"`
+	Currency    string             `json:"currency"`
+	Reason      string             `json:"reason"`
+	Status      string             `json:"status"`
+	RequestedBy string             `json:"requested_by"`
+	RequestedAt pgtype.Timestamptz `json:"requested_at"`
+	DecidedBy   *string            `json:"decided_by"`
+	DecidedAt   pgtype.Timestamptz `json:"decided_at"`
+	Notes       string             `json:"notes"`
+
+	reference string // Идентификатор платежа у провайдера
+}
+
+const selectRefundRequestsQ = `SELECT r.id, r.payment_id, r.folio_id, r.method, r.amount, r.base_amount,
+	COALESCE(p.currency, s.base_currency), r.reason, r.status, r.requested_by, r.requested_at, r.decided_by, r.decided_at, r.notes,
+	COALESCE(p.reference, '')
+	FROM RefundRequests r
+	LEFT JOIN Payments p ON p.id = r.payment_id
+	CROSS JOIN PropertySettings s`
+
+func scanRefundRequest(row pgx.Row, r *RefundRequests) error {
+	return row.Scan(
+		&r.Id,
+		&r.PaymentId,
+		&r.FolioId,
+		&r.Method,
+		&r.Amount,
+		&r.BaseAmount,
+		&r.Currency,
+		&r.Reason,
+		&r.Status,
+		&r.RequestedBy,
+		&r.RequestedAt,
+		&r.DecidedBy,
+		&r.DecidedAt,
+		&r.Notes,
+		&r.reference,
+	)
+}
+
+// Суммы ожидающих и проводимых заявок по платежу или по счёту: в валюте заявок и в базовой валюте
+func pendingTx(ctx context.Context, q storage.Querier, column string, id int) (amount, base money.Decimal, err error) {
+	err = q.QueryRow(ctx, "SELECT COALESCE(sum(amount), 0), COALESCE(sum(base_amount), 0) FROM RefundRequests WHERE "+column+" = $1 AND status IN ($2, $3)",
+		id, RefundPending, RefundProcessing).Scan(&amount, &base)
+	return amount, base, err
+}
+
+// prepareCardTx проверяет возврат по платежу: не больше списанного
+// за вычетом возвращённого и ожидающих заявок
+func (r *RefundRequests) prepareCardTx(ctx context.Context, q storage.Querier) error {
+	p, err := lockTx(ctx, q, "id = $1", *r.PaymentId)
+	if err != nil {
+		return err
+	}
+	if p.Status != payments.Captured {
+		return payments.ErrWrongState
+	}
+
+	pending, _, err := pendingTx(ctx, q, "payment_id", p.Id)
+	if err != nil {
+		return err
+	}
+	left := p.CapturedAmount - p.RefundedAmount - pending
+	if r.Amount == 0 {
+		r.Amount = left
+	}
+	if r.Amount <= 0 || r.Amount > left {
+		return errors.New(data.RefundExceedsPaid)
+	}
+
+	r.FolioId = p.FolioId
+	r.reference = p.Reference
+	r.Method = MethodCard
+	r.Currency = p.Currency
+	r.BaseAmount = r.Amount.MulRate(p.ExchangeRate)
+	return db_folio.LockOpenTx(ctx, q, r.FolioId)
+}
+
+// prepareFolioTx проверяет ручной возврат по счёту: вернуть можно не больше,
+// чем гость заплатил, за вычетом возвращённого и ожидающих заявок по этому счёту
+func (r *RefundRequests) prepareFolioTx(ctx context.Context, q storage.Querier) error {
+	if r.Method == "" || r.Method == MethodCard || r.Amount <= 0 {
+		return errors.New(data.WrongData)
+	}
+	if err := db_folio.LockOpenTx(ctx, q, r.FolioId); err != nil {
+		return err
+	}
+
+	paid, refunded, err := db_folio.PaidTx(ctx, q, r.FolioId)
+	if err != nil {
+		return err
+	}
+	_, pending, err := pendingTx(ctx, q, "folio_id", r.FolioId)
+	if err != nil {
+		return err
+	}
+	if r.Amount > paid-refunded-pending {
+		return errors.New(data.RefundExceedsPaid)
+	}
+
+	settings, err := db_property.GetTx(ctx, q, false)
+	if err != nil {
+		return err
+	}
+	r.Currency = settings.BaseCurrency
+	r.BaseAmount = r.Amount
+	return nil
+}
+
+// Сумма в базовой валюте, с которой сравнивается порог: всё уже возвращённое
+// по счёту любым способом, ожидающие заявки по нему и эта заявка
+func (r *RefundRequests) cumulativeTx(ctx context.Context, q storage.Querier) (money.Decimal, error) {
+	_, refunded, err := db_folio.PaidTx(ctx, q, r.FolioId)
+	if err != nil {
+		return 0, err
+	}
+	_, pending, err := pendingTx(ctx, q, "folio_id", r.FolioId)
+	if err != nil {
+		return 0, err
+	}
+	return refunded + pending + r.BaseAmount, nil
+}
+
+// recordTx записывает проведённый возврат: по платежу - в платёж и фолио, ручной - строкой счёта
+func (r *RefundRequests) recordTx(ctx context.Context, q storage.Querier, shiftId *int) error {
+	if r.PaymentId != nil {
+		_, err := recordRefundTx(ctx, q, *r.PaymentId, r.Amount, shiftId)
+		return err
+	}
+
+	entry := db_folio.Charges{
+		FolioId:     r.FolioId,
+		EntryType:   db_folio.EntryRefund,
+		Description: r.Reason,
+		Amount:      r.Amount,
+		Method:      r.Method,
+		ShiftId:     shiftId,
+	}
+	return entry.PostTx(ctx, q)
+}
+
+// refundCard проводит у провайдера возврат заявки в статусе RefundProcessing
+// и записывает результат. При ошибке провайдера заявка снова ждёт одобрения
+func (r *RefundRequests) refundCard(ctx context.Context, db *pgxpool.Pool, provider payments.Provider,
+	manager *string, notes string, shiftId *int) error {
+	if _, err := provider.Refund(ctx, r.reference, r.Amount); err != nil {
+		if err := r.returnPending(ctx, db, err); err != nil {
+			return err
+		}
+		return err
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := r.recordTx(ctx, tx, shiftId); err != nil {
+		return err
+	}
+	if err := r.decideTx(ctx, tx, RefundApproved, manager, notes); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// returnPending возвращает заявку, которую не провёл провайдер, в очередь на одобрение
+func (r *RefundRequests) returnPending(ctx context.Context, db *pgxpool.Pool, cause error) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	r.Status = RefundPending
+	r.Notes = cause.Error()
+	if _, err := tx.Exec(ctx, "UPDATE RefundRequests SET status = $1, notes = $2 WHERE id = $3 AND status = $4",
+		r.Status, r.Notes, r.Id, RefundProcessing); err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("Заявка #%d: провайдер не провёл возврат %s по счёту #%d (%s)",
+		r.Id, money.Money{Amount: r.Amount, Currency: r.Currency}, r.FolioId, cause)
+	if err := db_notifications.Notify(ctx, tx, "Возврат не проведён", message); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RequestRefund оформляет возврат (для платежа 0 - весь доступный остаток).
+// Если возвращённое по счёту вместе с ожидающими заявками и этой суммой
+// в базовой валюте не больше threshold, возврат сразу проводится
+// в кассовой смене shiftId, иначе заявка ждёт одобрения. Так крупный возврат
+// нельзя провести частями. Суммы ожидающих и проводимых заявок резервируются
+func (r *RefundRequests) RequestRefund(db *pgxpool.Pool, provider payments.Provider, threshold money.Decimal, shiftId *int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	r.Reason = strings.TrimSpace(r.Reason)
+	if r.Reason == "" || r.RequestedBy == "" {
+		return errors.New(data.RefundReasonRequired)
+	}
+	if shiftId == nil {
+		return errors.New(data.ShiftNotOpen)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if r.PaymentId != nil {
+		err = r.prepareCardTx(ctx, tx)
+	} else {
+		err = r.prepareFolioTx(ctx, tx)
+	}
+	if err != nil {
+		return err
+	}
+	total, err := r.cumulativeTx(ctx, tx)
+	if err != nil {
+		return err
+	}
+	r.Notes = ""
+	r.DecidedBy = nil
+
+	r.Status = RefundPending
+	switch {
+	case total > threshold:
+	case r.PaymentId != nil:
+		r.Status = RefundProcessing
+	default:
+		if err := r.recordTx(ctx, tx, shiftId); err != nil {
+			return err
+		}
+		r.Status = RefundApproved
+	}
+
+	if err := tx.QueryRow(ctx, `INSERT INTO RefundRequests(payment_id, folio_id, method, amount, base_amount, reason, status,
+			requested_by, decided_at, notes)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, CASE WHEN $7 = $9 THEN now() END, '')
+		RETURNING id, requested_at, decided_at`,
+		r.PaymentId, r.FolioId, r.Method, r.Amount, r.BaseAmount, r.Reason, r.Status, r.RequestedBy, RefundApproved,
+	).Scan(&r.Id, &r.RequestedAt, &r.DecidedAt); err != nil {
+		return err
+	}
+
+	if r.Status == RefundPending {
+		message := fmt.Sprintf("Заявка #%d: возврат %s по счёту #%d (%s) от %s. Причина: %s",
+			r.Id, money.Money{Amount: r.Amount, Currency: r.Currency}, r.FolioId, r.Method, r.RequestedBy, r.Reason)
+		if err := db_notifications.Notify(ctx, tx, "Возврат ждёт одобрения", message); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	if r.Status == RefundProcessing {
+		return r.refundCard(ctx, db, provider, nil, "", shiftId)
+	}
+	return nil
+}
+
+func lockRefundRequestTx(ctx context.Context, q storage.Querier, id int) (*RefundRequests, error) {
+	var r RefundRequests
+	if err := scanRefundRequest(q.QueryRow(ctx, selectRefundRequestsQ+" WHERE r.id = $1 FOR UPDATE OF r", id), &r); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New(data.RefundRequestNotFound)
+		}
+		return nil, err
+	}
+	if r.Status != RefundPending {
+		return nil, errors.New(data.RefundNotPending)
+	}
+	return &r, nil
+}
+
+func (r *RefundRequests) decideTx(ctx context.Context, q storage.Querier, status string, manager *string, notes string) error {
+	r.Status = status
+	r.DecidedBy = manager
+	r.Notes = notes
+	return q.QueryRow(ctx, "UPDATE RefundRequests SET status = $1, decided_by = $2, decided_at = now(), notes = $3 WHERE id = $4 RETURNING decided_at",
+		r.Status, r.DecidedBy, r.Notes, r.Id).Scan(&r.DecidedAt)
+}
+
+// ApproveRefund - менеджер одобряет чужую заявку, возврат проводится в кассовой смене
+// shiftId. При ошибке провайдера заявка остаётся в ожидании
+func ApproveRefund(db *pgxpool.Pool, provider payments.Provider, id int, manager, notes string, shiftId *int) (*RefundRequests, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	r, err := lockRefundRequestTx(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if r.RequestedBy == manager {
+		return nil, errors.New(data.RefundOwnApproval)
+	}
+
+	if r.PaymentId == nil {
+		if err := r.recordTx(ctx, tx, shiftId); err != nil {
+			return nil, err
+		}
+		if err := r.decideTx(ctx, tx, RefundApproved, &manager, notes); err != nil {
+			return nil, err
+		}
+		return r, tx.Commit(ctx)
+	}
+
+	r.Status = RefundProcessing
+	if _, err := tx.Exec(ctx, "UPDATE RefundRequests SET status = $1 WHERE id = $2", r.Status, r.Id); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := r.refundCard(ctx, db, provider, &manager, notes, shiftId); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// RejectRefund - менеджер отклоняет заявку, зарезервированная сумма освобождается
+func RejectRefund(db *pgxpool.Pool, id int, manager, notes string) (*RefundRequests, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	r, err := lockRefundRequestTx(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.decideTx(ctx, tx, RefundRejected, &manager, notes); err != nil {
+		return nil, err
+	}
+
+	return r, tx.Commit(ctx)
+}
+
+// GetRefundRequests - заявки на возврат; без статуса - все, очередь на одобрение - RefundPending
+func GetRefundRequests(db *pgxpool.Pool, status string) ([]RefundRequests, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.Query(ctx, selectRefundRequestsQ+" WHERE $1 = '' OR r.status = $1 ORDER BY r.requested_at, r.id", status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []RefundRequests{}
+	for rows.Next() {
+		var r RefundRequests
+		if err := scanRefundRequest(rows, &r); err != nil {
+			return nil, err
+		}
+		requests = append(requests, r)
+	}
+
+	return requests, rows.Err()
+}
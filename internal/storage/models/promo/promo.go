@@ -0,0 +1,401 @@
+package db_promo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// Discount kinds
+	Percentage = "percentage" // Процент от стоимости проживания
+	Fixed      = "fixed"      // Фиксированная скидка на бронь
+)
+
+// PromoCodes - промокод на скидку. Пустые даты и типы номеров - без ограничений,
+// нулевые лимиты - без ограничения числа применений
+type PromoCodes struct {
+	Id               int                `json:"id"`
+	Code             string             `json:"code"`
+	Description      string             `json:"description"`
+	Kind             string             `json:"kind"`
+	Value            money.Decimal      `json:"value"`
+	ValidFrom        pgtype.Date        `json:"valid_from"`
+	ValidTo          pgtype.Date        `json:"valid_to"`
+	StayFrom         pgtype.Date        `json:"stay_from"`
+	StayTo           pgtype.Date        `json:"stay_to"`
+	RoomTypes        []string           `json:"room_types"`
+	MinNights        int                `json:"min_nights"`
+	MaxUses          int                `json:"max_uses"`
+	MaxUsesPerClient int                `json:"max_uses_per_client"`
+	Active           bool               `json:"active"`
+	Uses             int                `json:"uses"`
+	CreatedAt        pgtype.Timestamptz `json:"created_at"`
+}
+
+// Redemptions - применение промокода к брони. При отмене брони
+// применение освобождается и не учитывается в лимитах
+type Redemptions struct {
+	Id           int                `json:"id"`
+	PromoId      int                `json:"promo_id"`
+	Code         string             `json:"code"`
+	BookingId    int                `json:"booking_id"`
+	ClientId     int                `json:"client_id"`
+	Discount     money.Decimal      `json:"discount"`
+	Released     bool               `json:"released"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+	BookingTotal money.Decimal      `json:"booking_total"`
+}
+
+// Stay - бронь, к которой применяется промокод
+type Stay struct {
+	ClientId int
+	RoomType string
+	Checkin  pgtype.Date
+	Checkout pgtype.Date
+	// Дата бронирования для проверки срока действия кода (нулевая - сегодня)
+	BookedAt time.Time
+}
+
+const selectPromoQ = `SELECT id, code, description, kind, value, valid_from, valid_to, stay_from, stay_to,
+	COALESCE(room_types, '{}'), min_nights, max_uses, max_uses_per_client, active,
+	(SELECT count(*) FROM PromoRedemptions r WHERE r.promo_id = PromoCodes.id AND NOT r.released),
+	created_at FROM PromoCodes`
+
+func scanPromo(row pgx.Row, p *PromoCodes) error {
+	return row.Scan(
+		&p.Id,
+		&p.Code,
+		&p.Description,
+		&p.Kind,
+		&p.Value,
+		&p.ValidFrom,
+		&p.ValidTo,
+		&p.StayFrom,
+		&p.StayTo,
+		&p.RoomTypes,
+		&p.MinNights,
+		&p.MaxUses,
+		&p.MaxUsesPerClient,
+		&p.Active,
+		&p.Uses,
+		&p.CreatedAt,
+	)
+}
+
+// NormalizeCode - коды не зависят от регистра и пробелов по краям
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func nullDate(date *pgtype.Date) {
+	if date.Status != pgtype.Present {
+		date.Status = pgtype.Null
+	}
+}
+
+func (p *PromoCodes) validate() error {
+	p.Code = NormalizeCode(p.Code)
+	if p.Code == "" || p.Value <= 0 || p.MinNights < 0 || p.MaxUses < 0 || p.MaxUsesPerClient < 0 {
+		return errors.New(data.WrongData)
+	}
+	switch p.Kind {
+	case Percentage:
+		if p.Value > money.Units(100) {
+			return errors.New(data.WrongData)
+		}
+	case Fixed:
+	default:
+		return errors.New(data.WrongData)
+	}
+
+	for _, period := range [][2]*pgtype.Date{{&p.ValidFrom, &p.ValidTo}, {&p.StayFrom, &p.StayTo}} {
+		nullDate(period[0])
+		nullDate(period[1])
+		if period[0].Status == pgtype.Present && period[1].Status == pgtype.Present && period[1].Time.Before(period[0].Time) {
+			return errors.New(data.WrongDates)
+		}
+	}
+	if p.RoomTypes == nil {
+		p.RoomTypes = []string{}
+	}
+
+	return nil
+}
+
+func (p *PromoCodes) Create(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := p.validate(); err != nil {
+		return err
+	}
+
+	createQ := `INSERT INTO PromoCodes(code, description, kind, value, valid_from, valid_to, stay_from, stay_to,
+			room_types, min_nights, max_uses, max_uses_per_client, active)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id, created_at`
+
+	return db.QueryRow(ctx, createQ,
+		p.Code, p.Description, p.Kind, p.Value, p.ValidFrom, p.ValidTo, p.StayFrom, p.StayTo,
+		p.RoomTypes, p.MinNights, p.MaxUses, p.MaxUsesPerClient, p.Active,
+	).Scan(&p.Id, &p.CreatedAt)
+}
+
+// Edit меняет условия промокода. Уже выданные скидки не пересчитываются
+func (p *PromoCodes) Edit(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := p.validate(); err != nil {
+		return err
+	}
+
+	editQ := `UPDATE PromoCodes SET code = $1, description = $2, kind = $3, value = $4, valid_from = $5, valid_to = $6,
+			stay_from = $7, stay_to = $8, room_types = $9, min_nights = $10, max_uses = $11,
+			max_uses_per_client = $12, active = $13
+		WHERE id = $14`
+
+	tag, err := db.Exec(ctx, editQ,
+		p.Code, p.Description, p.Kind, p.Value, p.ValidFrom, p.ValidTo, p.StayFrom, p.StayTo,
+		p.RoomTypes, p.MinNights, p.MaxUses, p.MaxUsesPerClient, p.Active, p.Id,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New(data.PromoNotFound)
+	}
+
+	return nil
+}
+
+func GetList(db *pgxpool.Pool) ([]PromoCodes, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.Query(ctx, selectPromoQ+" ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes []PromoCodes
+	for rows.Next() {
+		var code PromoCodes
+		if err := scanPromo(rows, &code); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, rows.Err()
+}
+
+func inPeriod(date time.Time, from, to pgtype.Date) bool {
+	if from.Status == pgtype.Present && date.Before(from.Time) {
+		return false
+	}
+	if to.Status == pgtype.Present && date.After(to.Time) {
+		return false
+	}
+	return true
+}
+
+// Проверка условий промокода без учёта лимитов. today - дата бронирования
+func (p *PromoCodes) applies(stay Stay, today time.Time) bool {
+	if !p.Active || !inPeriod(today, p.ValidFrom, p.ValidTo) {
+		return false
+	}
+
+	// Всё проживание (последняя ночь - накануне выезда) должно попадать в даты акции
+	lastNight := stay.Checkout.Time.AddDate(0, 0, -1)
+	if !inPeriod(stay.Checkin.Time, p.StayFrom, p.StayTo) || !inPeriod(lastNight, p.StayFrom, p.StayTo) {
+		return false
+	}
+
+	nights := int(stay.Checkout.Time.Sub(stay.Checkin.Time).Hours() / 24)
+	if nights < p.MinNights {
+		return false
+	}
+
+	if len(p.RoomTypes) == 0 {
+		return true
+	}
+	for _, roomType := range p.RoomTypes {
+		if roomType == stay.RoomType {
+			return true
+		}
+	}
+	return false
+}
+
+// Discount - скидка с суммы; фиксированная скидка не больше самой суммы
+func (p *PromoCodes) Discount(price money.Decimal) money.Decimal {
+	discount := p.Value
+	if p.Kind == Percentage {
+		discount = price.Percent(p.Value)
+	}
+	if discount > price {
+		return price
+	}
+	return discount
+}
+
+// FindTx находит действующий промокод, подходящий к брони. Лимиты применений
+// проверяются, если известен клиент (при расчёте цены без клиента - только общий).
+// forUpdate блокирует промокод, чтобы параллельные брони не превысили лимит
+func FindTx(ctx context.Context, q storage.Querier, code string, stay Stay, forUpdate bool) (*PromoCodes, error) {
+	findQ := selectPromoQ + " WHERE code = $1"
+	if forUpdate {
+		findQ += " FOR UPDATE"
+	}
+
+	var promo PromoCodes
+	if err := scanPromo(q.QueryRow(ctx, findQ, NormalizeCode(code)), &promo); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New(data.PromoNotFound)
+		}
+		return nil, err
+	}
+
+	today := stay.BookedAt
+	if today.IsZero() {
+		today = time.Now()
+	}
+	if !promo.applies(stay, today) {
+		return nil, errors.New(data.PromoNotApplicable)
+	}
+	if promo.MaxUses > 0 && promo.Uses >= promo.MaxUses {
+		return nil, errors.New(data.PromoExhausted)
+	}
+
+	if promo.MaxUsesPerClient > 0 && stay.ClientId != 0 {
+		var clientUses int
+		if err := q.QueryRow(ctx, "SELECT count(*) FROM PromoRedemptions WHERE promo_id = $1 AND client_id = $2 AND NOT released",
+			promo.Id, stay.ClientId).Scan(&clientUses); err != nil {
+			return nil, err
+		}
+		if clientUses >= promo.MaxUsesPerClient {
+			return nil, errors.New(data.PromoExhausted)
+		}
+	}
+
+	return &promo, nil
+}
+
+// RedeemTx фиксирует применение найденного через FindTx промокода к брони
+func (p *PromoCodes) RedeemTx(ctx context.Context, q storage.Querier, bookingId, clientId int, discount money.Decimal) error {
+	_, err := q.Exec(ctx,
+		"INSERT INTO PromoRedemptions(promo_id, booking_id, client_id, discount) VALUES($1, $2, $3, $4)",
+		p.Id, bookingId, clientId, discount,
+	)
+	return err
+}
+
+// RepriceTx пересчитывает скидку брони при изменении её стоимости
+func RepriceTx(ctx context.Context, q storage.Querier, bookingId int, price money.Decimal) (money.Decimal, error) {
+	var promo PromoCodes
+	err := scanPromo(q.QueryRow(ctx, selectPromoQ+` WHERE id = (
+			SELECT promo_id FROM PromoRedemptions WHERE booking_id = $1 AND NOT released)`, bookingId), &promo)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	discount := promo.Discount(price)
+	_, err = q.Exec(ctx, "UPDATE PromoRedemptions SET discount = $1 WHERE booking_id = $2 AND NOT released", discount, bookingId)
+	return discount, err
+}
+
+// RecheckTx заново проверяет промокод брони после изменения дат или номера.
+// На время проверки применение освобождается, чтобы бронь не упиралась в
+// собственный лимит, и восстанавливается, если код по-прежнему подходит.
+// Для неподходящего кода возвращается nil, а применение остаётся освобождённым
+func RecheckTx(ctx context.Context, q storage.Querier, bookingId int, stay Stay) (*PromoCodes, error) {
+	var redemptionId int
+	var code string
+	err := q.QueryRow(ctx, `SELECT r.id, p.code FROM PromoRedemptions r JOIN PromoCodes p ON p.id = r.promo_id
+		WHERE r.booking_id = $1 AND NOT r.released`, bookingId).Scan(&redemptionId, &code)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := q.Exec(ctx, "UPDATE PromoRedemptions SET released = true WHERE id = $1", redemptionId); err != nil {
+		return nil, err
+	}
+
+	promo, err := FindTx(ctx, q, code, stay, true)
+	if err != nil {
+		if err.Error() == data.PromoNotApplicable || err.Error() == data.PromoExhausted {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	_, err = q.Exec(ctx, "UPDATE PromoRedemptions SET released = false WHERE id = $1", redemptionId)
+	return promo, err
+}
+
+// ReleaseTx освобождает применение промокода отменённой брони
+func ReleaseTx(ctx context.Context, q storage.Querier, bookingId int) error {
+	_, err := q.Exec(ctx, "UPDATE PromoRedemptions SET released = true WHERE booking_id = $1", bookingId)
+	return err
+}
+
+// GetRedemptions - отчёт о применениях промокодов за период (по дате применения).
+// code и пустые даты не ограничивают выборку
+func GetRedemptions(db *pgxpool.Pool, code string, from, to pgtype.Date) ([]Redemptions, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	nullDate(&from)
+	nullDate(&to)
+
+	rows, err := db.Query(ctx, `SELECT r.id, r.promo_id, p.code, r.booking_id, r.client_id, r.discount, r.released,
+			r.created_at, b.total_price
+		FROM PromoRedemptions r
+		JOIN PromoCodes p ON p.id = r.promo_id
+		JOIN Bookings b ON b.id = r.booking_id
+		WHERE ($1 = '' OR p.code = $1)
+		AND ($2::date IS NULL OR r.created_at >= $2::date)
+		AND ($3::date IS NULL OR r.created_at < $3::date + 1)
+		ORDER BY r.created_at, r.id`, NormalizeCode(code), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	redemptions := []Redemptions{}
+	for rows.Next() {
+		var r Redemptions
+		if err := rows.Scan(
+			&r.Id,
+			&r.PromoId,
+			&r.Code,
+			&r.BookingId,
+			&r.ClientId,
+			&r.Discount,
+			&r.Released,
+			&r.CreatedAt,
+			&r.BookingTotal,
+		); err != nil {
+			return nil, err
+		}
+		redemptions = append(redemptions, r)
+	}
+
+	return redemptions, rows.Err()
+}
@@ -0,0 +1,96 @@
+package db_promo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/jackc/pgtype"
+)
+
+func date(year int, month time.Month, day int) pgtype.Date {
+	return pgtype.Date{Time: time.Date(year, month, day, 0, 0, 0, 0, time.UTC), Status: pgtype.Present}
+}
+
+func TestDiscount(t *testing.T) {
+	tests := []struct {
+		name  string
+		promo PromoCodes
+		price money.Decimal
+		want  money.Decimal
+	}{
+		{name: "percentage", promo: PromoCodes{Kind: Percentage, Value: money.Units(10)}, price: money.Units(250), want: money.Units(25)},
+		{name: "percentage rounding", promo: PromoCodes{Kind: Percentage, Value: money.Units(15)}, price: money.Cents(3333), want: money.Cents(500)},
+		{name: "full percentage", promo: PromoCodes{Kind: Percentage, Value: money.Units(100)}, price: money.Units(80), want: money.Units(80)},
+		{name: "fixed", promo: PromoCodes{Kind: Fixed, Value: money.Units(500)}, price: money.Units(2000), want: money.Units(500)},
+		{name: "fixed above price", promo: PromoCodes{Kind: Fixed, Value: money.Units(500)}, price: money.Units(300), want: money.Units(300)},
+		{name: "zero price", promo: PromoCodes{Kind: Fixed, Value: money.Units(500)}, price: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.promo.Discount(tt.price); got != tt.want {
+			t.Errorf("%s: Discount(%s) = %s, want %s", tt.name, tt.price, got, tt.want)
+		}
+	}
+}
+
+func TestApplies(t *testing.T) {
+	today := date(2026, 6, 1).Time
+	promo := PromoCodes{
+		Active:    true,
+		ValidFrom: date(2026, 5, 1),
+		ValidTo:   date(2026, 6, 30),
+		StayFrom:  date(2026, 7, 1),
+		StayTo:    date(2026, 7, 31),
+		RoomTypes: []string{"standard", "deluxe"},
+		MinNights: 2,
+	}
+	stay := Stay{RoomType: "standard", Checkin: date(2026, 7, 10), Checkout: date(2026, 7, 12)}
+
+	inactive := promo
+	inactive.Active = false
+	anyRoom := promo
+	anyRoom.RoomTypes = nil
+	open := PromoCodes{Active: true}
+
+	tests := []struct {
+		name  string
+		promo PromoCodes
+		stay  Stay
+		today time.Time
+		want  bool
+	}{
+		{name: "fits", promo: promo, stay: stay, today: today, want: true},
+		{name: "inactive", promo: inactive, stay: stay, today: today, want: false},
+		{name: "booked before validity", promo: promo, stay: stay, today: date(2026, 4, 30).Time, want: false},
+		{name: "booked after validity", promo: promo, stay: stay, today: date(2026, 7, 1).Time, want: false},
+		{name: "booked on last valid day", promo: promo, stay: stay, today: date(2026, 6, 30).Time, want: true},
+		{name: "check-in before stay window", promo: promo, stay: Stay{RoomType: "standard", Checkin: date(2026, 6, 30), Checkout: date(2026, 7, 2)}, today: today, want: false},
+		{name: "last night on window end", promo: promo, stay: Stay{RoomType: "standard", Checkin: date(2026, 7, 30), Checkout: date(2026, 8, 1)}, today: today, want: true},
+		{name: "last night after window", promo: promo, stay: Stay{RoomType: "standard", Checkin: date(2026, 7, 30), Checkout: date(2026, 8, 2)}, today: today, want: false},
+		{name: "too few nights", promo: promo, stay: Stay{RoomType: "standard", Checkin: date(2026, 7, 10), Checkout: date(2026, 7, 11)}, today: today, want: false},
+		{name: "other room type", promo: promo, stay: Stay{RoomType: "suite", Checkin: stay.Checkin, Checkout: stay.Checkout}, today: today, want: false},
+		{name: "any room type", promo: anyRoom, stay: Stay{RoomType: "suite", Checkin: stay.Checkin, Checkout: stay.Checkout}, today: today, want: true},
+		{name: "no restrictions", promo: open, stay: Stay{RoomType: "suite", Checkin: date(2027, 1, 1), Checkout: date(2027, 1, 2)}, today: today, want: true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.promo.applies(tt.stay, tt.today); got != tt.want {
+			t.Errorf("%s: applies() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeCode(t *testing.T) {
+	tests := map[string]string{
+		"summer10":  "SUMMER10",
+		"  Winter ": "WINTER",
+		"":          "",
+	}
+
+	for code, want := range tests {
+		if got := NormalizeCode(code); got != want {
+			t.Errorf("NormalizeCode(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package db_property
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Settings - настройки отеля (одна строка в таблице)
+type Settings struct {
+	// Операционная дата отеля. Сдвигается ночным аудитом, а не календарём
+	BusinessDate pgtype.Date `json:"business_date"`
+	// Базовая валюта отеля (ISO 4217): в ней хранятся все цены и суммы счетов
+	BaseCurrency string `json:"base_currency"`
+	// Стандартное время заезда и выезда ("15:04")
+	CheckInTime  string `json:"check_in_time"`
+	CheckOutTime string `json:"check_out_time"`
+	// Реквизиты продавца для счетов
+	SellerName    string `json:"seller_name"`
+	SellerTaxId   string `json:"seller_tax_id"`
+	SellerAddress string `json:"seller_address"`
+}
+
+// NormalizeClock проверяет время в формате "15:04" и приводит его к виду с ведущим нулём,
+// чтобы значения можно было сравнивать как строки
+func NormalizeClock(value string) (string, error) {
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return "", errors.New(data.WrongTime)
+	}
+	return clock.Format("15:04"), nil
+}
+
+// GetTx читает настройки, при первом обращении создаёт их с текущей датой.
+// forUpdate блокирует строку до конца транзакции
+func GetTx(ctx context.Context, q storage.Querier, forUpdate bool) (*Settings, error) {
+	if _, err := q.Exec(ctx,
+		`INSERT INTO PropertySettings(id, business_date, base_currency, check_in_time, check_out_time,
+			seller_name, seller_tax_id, seller_address)
+		VALUES(1, current_date, 'RUB', '14:00', '12:00', '', '', '') ON CONFLICT (id) DO NOTHING`,
+	); err != nil {
+		return nil, err
+	}
+
+	getQ := `SELECT business_date, base_currency, check_in_time, check_out_time, seller_name, seller_tax_id, seller_address
+		FROM PropertySettings WHERE id = 1`
+	if forUpdate {
+		getQ += " FOR UPDATE"
+	}
+
+	var settings Settings
+	if err := q.QueryRow(ctx, getQ).Scan(
+		&settings.BusinessDate,
+		&settings.BaseCurrency,
+		&settings.CheckInTime,
+		&settings.CheckOutTime,
+		&settings.SellerName,
+		&settings.SellerTaxId,
+		&settings.SellerAddress,
+	); err != nil {
+		return nil, err
+	}
+
+	return &settings, nil
+}
+
+func Get(db *pgxpool.Pool) (*Settings, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return GetTx(ctx, db, false)
+}
+
+// Edit меняет настройки. Операционную дату двигает только ночной аудит.
+// Базовую валюту нельзя сменить, когда в ней уже есть брони, начисления или платежи
+func (s *Settings) Edit(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var err error
+	if s.BaseCurrency, err = money.NormalizeCurrency(s.BaseCurrency); err != nil {
+		return errors.New(data.WrongCurrency)
+	}
+	if s.CheckInTime, err = NormalizeClock(s.CheckInTime); err != nil {
+		return err
+	}
+	if s.CheckOutTime, err = NormalizeClock(s.CheckOutTime); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	current, err := GetTx(ctx, tx, true)
+	if err != nil {
+		return err
+	}
+	if s.BaseCurrency != current.BaseCurrency {
+		var used bool
+		if err := tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM Bookings) OR EXISTS(SELECT 1 FROM FolioCharges)
+			OR EXISTS(SELECT 1 FROM Payments)`).Scan(&used); err != nil {
+			return err
+		}
+		if used {
+			return errors.New(data.CurrencyInUse)
+		}
+	}
+
+	editQ := `UPDATE PropertySettings SET base_currency = $1, check_in_time = $2, check_out_time = $3,
+		seller_name = $4, seller_tax_id = $5, seller_address = $6 WHERE id = 1`
+
+	if _, err := tx.Exec(ctx, editQ, s.BaseCurrency, s.CheckInTime, s.CheckOutTime, s.SellerName, s.SellerTaxId, s.SellerAddress); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// SetBusinessDateTx сдвигает операционную дату (вызывается ночным аудитом)
+func SetBusinessDateTx(ctx context.Context, q storage.Querier, date pgtype.Date) error {
+	_, err := q.Exec(ctx, "UPDATE PropertySettings SET business_date = $1 WHERE id = 1", date)
+	return err
+}
@@ -0,0 +1,82 @@
+package db_rooms
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// RoomBlocks - период, когда номер выведен из эксплуатации (ремонт, авария).
+// date_to не включается, как и дата выезда у брони
+type RoomBlocks struct {
+	Id        int                `json:"id"`
+	RoomId    int                `json:"room_id"`
+	DateFrom  pgtype.Date        `json:"date_from"`
+	DateTo    pgtype.Date        `json:"date_to"`
+	Reason    string             `json:"reason"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+func (b *RoomBlocks) Create(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if b.DateFrom.Status != pgtype.Present || b.DateTo.Status != pgtype.Present {
+		return errors.New(data.WrongData)
+	}
+	if !b.DateTo.Time.After(b.DateFrom.Time) {
+		return errors.New(data.WrongDates)
+	}
+
+	createQ := `INSERT INTO RoomBlocks(room_id, date_from, date_to, reason)
+		VALUES($1, $2, $3, $4) RETURNING id, created_at`
+
+	return db.QueryRow(ctx, createQ, b.RoomId, b.DateFrom, b.DateTo, b.Reason).Scan(&b.Id, &b.CreatedAt)
+}
+
+func (b *RoomBlocks) Delete(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tag, err := db.Exec(ctx, "DELETE FROM RoomBlocks WHERE id = $1", b.Id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New(data.BlockNotFound)
+	}
+
+	return nil
+}
+
+// GetBlocks возвращает блокировки, пересекающиеся с периодом [from, to)
+func GetBlocks(ctx context.Context, db *pgxpool.Pool, from, to pgtype.Date) ([]RoomBlocks, error) {
+	getQ := `SELECT id, room_id, date_from, date_to, reason, created_at FROM RoomBlocks
+		WHERE date_from < $2 AND date_to > $1
+		ORDER BY room_id, date_from`
+
+	rows, err := db.Query(ctx, getQ, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []RoomBlocks
+	for rows.Next() {
+		var block RoomBlocks
+		if err := rows.Scan(&block.Id, &block.RoomId, &block.DateFrom, &block.DateTo, &block.Reason, &block.CreatedAt); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return blocks, nil
+}
@@ -0,0 +1,106 @@
+package db_rooms
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// Housekeeping task types
+	TaskDepartureClean = "departure_clean" // Уборка после выезда или переезда гостя
+	TaskPrepareRoom    = "prepare_room"    // Подготовка номера к заселению
+
+	// Housekeeping task statuses
+	TaskOpen = "open" // Не выполнена
+	TaskDone = "done" // Выполнена
+)
+
+// HousekeepingTasks - задание горничным по номеру
+type HousekeepingTasks struct {
+	Id        int                `json:"id"`
+	RoomId    int                `json:"room_id"`
+	BookingId *int               `json:"booking_id,omitempty"`
+	TaskType  string             `json:"task_type"`
+	DueDate   pgtype.Date        `json:"due_date"`
+	Status    string             `json:"status"`
+	Notes     string             `json:"notes"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+func (t *HousekeepingTasks) CreateTx(ctx context.Context, q storage.Querier) error {
+	t.Status = TaskOpen
+	createQ := `INSERT INTO HousekeepingTasks(room_id, booking_id, task_type, due_date, status, notes)
+		VALUES($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
+
+	return q.QueryRow(ctx, createQ, t.RoomId, t.BookingId, t.TaskType, t.DueDate, t.Status, t.Notes).Scan(&t.Id, &t.CreatedAt)
+}
+
+// Complete закрывает задание. После уборки номер снова доступен, если
+// он не занят гостем и не на обслуживании
+func (t *HousekeepingTasks) Complete(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	completeQ := "UPDATE HousekeepingTasks SET status = $1 WHERE id = $2 AND status = $3 RETURNING room_id, task_type"
+	if err := tx.QueryRow(ctx, completeQ, TaskDone, t.Id, TaskOpen).Scan(&t.RoomId, &t.TaskType); err != nil {
+		return errors.New(data.TaskNotFound)
+	}
+	t.Status = TaskDone
+
+	if t.TaskType == TaskDepartureClean {
+		if _, err := tx.Exec(ctx, "UPDATE rooms SET status = $1 WHERE id = $2 AND status = $3", Available, t.RoomId, Cleaning); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetTasks возвращает задания (все или с заданным статусом) по сроку
+func GetTasks(db *pgxpool.Pool, status string) ([]HousekeepingTasks, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.Query(ctx, `SELECT id, room_id, booking_id, task_type, due_date, status, notes, created_at
+		FROM HousekeepingTasks WHERE $1 = '' OR status = $1 ORDER BY due_date, id`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []HousekeepingTasks
+	for rows.Next() {
+		var task HousekeepingTasks
+		if err := rows.Scan(
+			&task.Id,
+			&task.RoomId,
+			&task.BookingId,
+			&task.TaskType,
+			&task.DueDate,
+			&task.Status,
+			&task.Notes,
+			&task.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
+}
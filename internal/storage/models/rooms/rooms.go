@@ -6,25 +6,84 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 const (
 	// Rooms statuses
-	available   = "available"   // Доступный
-	occupied    = "occupied"    // Занятый
-	cleaning    = "cleaning"    // Уборка
-	maintenance = "maintenance" // Обслуживание
+	Available   = "available"   // Доступный
+	Occupied    = "occupied"    // Занятый
+	Cleaning    = "cleaning"    // Уборка
+	Maintenance = "maintenance" // Обслуживание
 )
 
+// Дети младше этого возраста проживают бесплатно
+const FreeChildAge = 3
+
 type Rooms struct {
-	Id            int     `json:"id"`
-	RoomNumber    int     `json:"room_number"`
-	RoomType      string  `json:"room_type"`
-	PricePerNight float64 `json:"price_per_night"`
-	BedroomsCount int     `json:"bedrooms_count"`
-	Comment       string  `json:"comment"`
-	Status        string  `json:"status"`
+	Id            int           `json:"id"`
+	RoomNumber    int           `json:"room_number"`
+	RoomType      string        `json:"room_type"`
+	PricePerNight money.Decimal `json:"price_per_night"`
+	BedroomsCount int           `json:"bedrooms_count"`
+	Comment       string        `json:"comment"`
+	Status        string        `json:"status"`
+
+	// Вместимость и доплаты за человека в сутки сверх базового размещения
+	MaxOccupancy    int           `json:"max_occupancy"`
+	BaseOccupancy   int           `json:"base_occupancy"`
+	ExtraAdultPrice money.Decimal `json:"extra_adult_price"`
+	ExtraChildPrice money.Decimal `json:"extra_child_price"`
+}
+
+const selectRoomsQ = `SELECT id, room_number, room_type, price_per_night, bedrooms_count, comment, status,
+	max_occupancy, base_occupancy, extra_adult_price, extra_child_price FROM rooms`
+
+func scanRoom(row pgx.Row, room *Rooms) error {
+	return row.Scan(
+		&room.Id,
+		&room.RoomNumber,
+		&room.RoomType,
+		&room.PricePerNight,
+		&room.BedroomsCount,
+		&room.Comment,
+		&room.Status,
+		&room.MaxOccupancy,
+		&room.BaseOccupancy,
+		&room.ExtraAdultPrice,
+		&room.ExtraChildPrice)
+}
+
+// NightlyPrice - цена за сутки с учётом доплат за гостей сверх базового размещения.
+// Дети младше FreeChildAge не оплачиваются
+func (r *Rooms) NightlyPrice(adults int, childAges []int) money.Decimal {
+	price := r.PricePerNight
+	places := r.BaseOccupancy
+
+	extraAdults := adults - places
+	if extraAdults > 0 {
+		price += r.ExtraAdultPrice.Mul(extraAdults)
+		places = 0
+	} else {
+		places -= adults
+	}
+
+	for _, age := range childAges {
+		if age < FreeChildAge {
+			continue
+		}
+		if places > 0 {
+			places--
+			continue
+		}
+		price += r.ExtraChildPrice
+	}
+
+	return price
 }
 
 func (r *Rooms) checkRoomExist(db *pgxpool.Pool) bool {
@@ -65,9 +124,12 @@ func (r *Rooms) GetRooms(db *pgxpool.Pool) ([]Rooms, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Исправлено имя запроса (было GetClientsQ, должно быть GetRoomsQ)
-	GetRoomsQ := "SELECT id, room_number, room_type, price_per_night, bedrooms_count, comment, status FROM rooms"
-	rows, err := db.Query(ctx, GetRoomsQ)
+	return QueryList(ctx, db, "ORDER BY room_number")
+}
+
+// QueryList выполняет выборку номеров с произвольным условием
+func QueryList(ctx context.Context, q storage.Querier, where string, args ...interface{}) ([]Rooms, error) {
+	rows, err := q.Query(ctx, selectRoomsQ+" "+where, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query rooms: %w", err)
 	}
@@ -76,15 +138,7 @@ func (r *Rooms) GetRooms(db *pgxpool.Pool) ([]Rooms, error) {
 	var rooms []Rooms
 	for rows.Next() {
 		var room Rooms
-		// Исправлено: добавлен & для PricePerNight и добавлено поле Id
-		if err := rows.Scan(
-			&room.Id,
-			&room.RoomNumber,
-			&room.RoomType,
-			&room.PricePerNight, // <- ИСПРАВЛЕНО: добавлен &
-			&room.BedroomsCount,
-			&room.Comment,
-			&room.Status); err != nil {
+		if err := scanRoom(rows, &room); err != nil {
 			return nil, fmt.Errorf("failed to scan room row: %w", err)
 		}
 		rooms = append(rooms, room)
@@ -104,21 +158,50 @@ func GetRoomByID(db *pgxpool.Pool, id int) (*Rooms, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	query := "SELECT id, room_number, room_type, price_per_night, bedrooms_count, comment, status FROM rooms WHERE id = $1"
+	return GetRoomByIDTx(ctx, db, id)
+}
 
+func GetRoomByIDTx(ctx context.Context, q storage.Querier, id int) (*Rooms, error) {
 	var room Rooms
-	err := db.QueryRow(ctx, query, id).Scan(
-		&room.Id,
-		&room.RoomNumber,
-		&room.RoomType,
-		&room.PricePerNight,
-		&room.BedroomsCount,
-		&room.Comment,
-		&room.Status)
-
-	if err != nil {
+	if err := scanRoom(q.QueryRow(ctx, selectRoomsQ+" WHERE id = $1", id), &room); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New(data.RoomNotFound)
+		}
 		return nil, fmt.Errorf("failed to get room by id %d: %w", id, err)
 	}
 
 	return &room, nil
 }
+
+// SetStatusTx меняет статус номера по id (при заселении, выезде и т.п.)
+func SetStatusTx(ctx context.Context, q storage.Querier, id int, status string) error {
+	if _, err := q.Exec(ctx, "UPDATE rooms SET status = $1 WHERE id = $2", status, id); err != nil {
+		return fmt.Errorf("failed to update room status: %w", err)
+	}
+	return nil
+}
+
+// EditRoomOccupancy меняет вместимость номера и доплаты за гостей
+func (r *Rooms) EditRoomOccupancy(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if r.MaxOccupancy < 0 || r.BaseOccupancy < 0 || r.ExtraAdultPrice < 0 || r.ExtraChildPrice < 0 ||
+		(r.MaxOccupancy > 0 && r.BaseOccupancy > r.MaxOccupancy) {
+		return errors.New(data.WrongData)
+	}
+
+	editQ := `UPDATE rooms
+		SET max_occupancy = $1, base_occupancy = $2, extra_adult_price = $3, extra_child_price = $4
+		WHERE id = $5`
+
+	tag, err := db.Exec(ctx, editQ, r.MaxOccupancy, r.BaseOccupancy, r.ExtraAdultPrice, r.ExtraChildPrice, r.Id)
+	if err != nil {
+		return fmt.Errorf("failed to update room occupancy: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New(data.RoomNotFound)
+	}
+
+	return nil
+}
@@ -0,0 +1,400 @@
+package db_shifts
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// Shift statuses
+	Open        = "open"        // Кассир принимает оплаты
+	Closed      = "closed"      // Закрыта, суммы сошлись или расхождение подписано менеджером
+	Discrepancy = "discrepancy" // Закрыта с расхождением, ждёт подписи менеджера
+
+	// MethodCash - наличные: к ожидаемой сумме добавляется размен на начало смены
+	MethodCash = "cash"
+)
+
+// Shifts - кассовая смена пользователя. Все оплаты и возвраты в фолио,
+// проведённые пользователем, привязываются к его открытой смене
+type Shifts struct {
+	Id           int                `json:"id"`
+	Username     string             `json:"username"`
+	Status       string             `json:"status"`
+	OpeningFloat money.Decimal      `json:"opening_float"`
+	OpenedAt     pgtype.Timestamptz `json:"opened_at"`
+	ClosedAt     pgtype.Timestamptz `json:"closed_at"`
+	Totals       []Totals           `json:"totals"`
+	Notes        string             `json:"notes"`
+	SignedOffBy  string             `json:"signed_off_by,omitempty"`
+	SignedOffAt  pgtype.Timestamptz `json:"signed_off_at"`
+}
+
+// Totals - итог смены по способу оплаты: сколько должно быть по проводкам
+// (оплаты минус возвраты) и сколько насчитал кассир при закрытии
+type Totals struct {
+	Method     string        `json:"method"`
+	Expected   money.Decimal `json:"expected"`
+	Counted    money.Decimal `json:"counted"`
+	Difference money.Decimal `json:"difference"`
+}
+
+// CloseRequest - пересчёт кассы при закрытии смены по способам оплаты
+type CloseRequest struct {
+	Counted map[string]money.Decimal `json:"counted"`
+	Notes   string                   `json:"notes"`
+}
+
+const selectShiftsQ = `SELECT id, username, status, opening_float, opened_at, closed_at, notes,
+	COALESCE(signed_off_by, ''), signed_off_at FROM CashierShifts`
+
+func scanShift(row pgx.Row, s *Shifts) error {
+	return row.Scan(
+		&s.Id,
+		&s.Username,
+		&s.Status,
+		&s.OpeningFloat,
+		&s.OpenedAt,
+		&s.ClosedAt,
+		&s.Notes,
+		&s.SignedOffBy,
+		&s.SignedOffAt,
+	)
+}
+
+// Open открывает смену пользователя. Одновременно открыта только одна смена
+// пользователя: строка пользователя блокируется, чтобы параллельные запросы
+// не открыли две смены
+func (s *Shifts) Open(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if s.Username == "" || s.OpeningFloat < 0 {
+		return errors.New(data.WrongData)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var userId int
+	if err := tx.QueryRow(ctx, "SELECT id FROM users WHERE username = $1 FOR UPDATE", s.Username).Scan(&userId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New(data.UserNotFound)
+		}
+		return err
+	}
+
+	var exists bool
+	if err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM CashierShifts WHERE username = $1 AND status = $2)",
+		s.Username, Open).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return errors.New(data.ShiftAlreadyOpen)
+	}
+
+	s.Status = Open
+	s.Totals = []Totals{}
+	if err := tx.QueryRow(ctx, `INSERT INTO CashierShifts(username, status, opening_float, notes)
+		VALUES($1, $2, $3, $4) RETURNING id, opened_at`,
+		s.Username, s.Status, s.OpeningFloat, s.Notes).Scan(&s.Id, &s.OpenedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func currentTx(ctx context.Context, q storage.Querier, username string, forUpdate bool) (*Shifts, error) {
+	currentQ := selectShiftsQ + " WHERE username = $1 AND status = $2"
+	if forUpdate {
+		currentQ += " FOR UPDATE"
+	}
+
+	var shift Shifts
+	if err := scanShift(q.QueryRow(ctx, currentQ, username, Open), &shift); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New(data.ShiftNotOpen)
+		}
+		return nil, err
+	}
+
+	return &shift, nil
+}
+
+// Current возвращает открытую смену пользователя с текущими итогами
+func Current(db *pgxpool.Pool, username string) (*Shifts, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	shift, err := currentTx(ctx, db, username, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := shift.loadTotals(ctx, db); err != nil {
+		return nil, err
+	}
+
+	return shift, nil
+}
+
+// CurrentID - номер открытой смены пользователя для привязки проводок
+func CurrentID(db *pgxpool.Pool, username string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	shift, err := currentTx(ctx, db, username, false)
+	if err != nil {
+		return 0, err
+	}
+
+	return shift.Id, nil
+}
+
+// CheckOpenTx проверяет, что смена ещё открыта. Смена блокируется от
+// закрытия до конца транзакции, чтобы проводка не попала в закрытую смену
+func CheckOpenTx(ctx context.Context, q storage.Querier, id int) error {
+	var status string
+	if err := q.QueryRow(ctx, "SELECT status FROM CashierShifts WHERE id = $1 FOR SHARE", id).Scan(&status); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New(data.ShiftNotOpen)
+		}
+		return err
+	}
+	if status != Open {
+		return errors.New(data.ShiftNotOpen)
+	}
+
+	return nil
+}
+
+// Ожидаемые суммы по проводкам смены: оплаты (в фолио со знаком минус) за вычетом
+// возвратов и оплаты проданных подарочных сертификатов
+func (s *Shifts) expectedTx(ctx context.Context, q storage.Querier) (map[string]money.Decimal, error) {
+	rows, err := q.Query(ctx, `SELECT method, sum(amount) FROM (
+			SELECT method, -amount AS amount FROM FolioCharges WHERE shift_id = $1
+			UNION ALL
+			SELECT method, amount FROM VoucherSales WHERE shift_id = $1
+		) m GROUP BY method`, s.Id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	expected := map[string]money.Decimal{MethodCash: s.OpeningFloat}
+	for rows.Next() {
+		var method string
+		var amount money.Decimal
+		if err := rows.Scan(&method, &amount); err != nil {
+			return nil, err
+		}
+		expected[method] += amount
+	}
+
+	return expected, rows.Err()
+}
+
+// Итоги открытой смены считаются по проводкам, закрытой - берутся из отчёта закрытия
+func (s *Shifts) loadTotals(ctx context.Context, q storage.Querier) error {
+	s.Totals = []Totals{}
+
+	if s.Status == Open {
+		expected, err := s.expectedTx(ctx, q)
+		if err != nil {
+			return err
+		}
+		for method, amount := range expected {
+			s.Totals = append(s.Totals, Totals{Method: method, Expected: amount})
+		}
+		sort.Slice(s.Totals, func(a, b int) bool { return s.Totals[a].Method < s.Totals[b].Method })
+		return nil
+	}
+
+	rows, err := q.Query(ctx, "SELECT method, expected, counted FROM ShiftTotals WHERE shift_id = $1 ORDER BY method", s.Id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var total Totals
+		if err := rows.Scan(&total.Method, &total.Expected, &total.Counted); err != nil {
+			return err
+		}
+		total.Difference = total.Counted - total.Expected
+		s.Totals = append(s.Totals, total)
+	}
+
+	return rows.Err()
+}
+
+// Close закрывает смену пользователя по пересчёту кассы. Если хотя бы по одному
+// способу оплаты пересчёт не сошёлся, смена ждёт подписи менеджера
+func (r *CloseRequest) Close(db *pgxpool.Pool, username string) (*Shifts, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, amount := range r.Counted {
+		if amount < 0 {
+			return nil, errors.New(data.WrongData)
+		}
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	shift, err := currentTx(ctx, tx, username, true)
+	if err != nil {
+		return nil, err
+	}
+	expected, err := shift.expectedTx(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	for method := range r.Counted {
+		if _, ok := expected[method]; !ok {
+			expected[method] = 0
+		}
+	}
+
+	shift.Status = Closed
+	for method, amount := range expected {
+		if _, err := tx.Exec(ctx, "INSERT INTO ShiftTotals(shift_id, method, expected, counted) VALUES($1, $2, $3, $4)",
+			shift.Id, method, amount, r.Counted[method]); err != nil {
+			return nil, err
+		}
+		if r.Counted[method] != amount {
+			shift.Status = Discrepancy
+		}
+	}
+
+	if r.Notes != "" {
+		shift.Notes = r.Notes
+	}
+	if err := tx.QueryRow(ctx, "UPDATE CashierShifts SET status = $1, notes = $2, closed_at = now() WHERE id = $3 RETURNING closed_at",
+		shift.Status, shift.Notes, shift.Id).Scan(&shift.ClosedAt); err != nil {
+		return nil, err
+	}
+	if err := shift.loadTotals(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return shift, nil
+}
+
+// SignOff - подпись менеджера под расхождением закрытой смены.
+// Менеджер не может подписать расхождение своей собственной смены
+func SignOff(db *pgxpool.Pool, id int, manager, notes string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var status, cashier string
+	if err := tx.QueryRow(ctx, "SELECT status, username FROM CashierShifts WHERE id = $1 FOR UPDATE", id).Scan(&status, &cashier); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New(data.ShiftNotFound)
+		}
+		return err
+	}
+	if status != Discrepancy {
+		return errors.New(data.ShiftNoDiscrepancy)
+	}
+	if cashier == manager {
+		return errors.New(data.ShiftOwnSignOff)
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE CashierShifts SET status = $1, signed_off_by = $2, signed_off_at = now(),
+			notes = CASE WHEN $3 = '' THEN notes ELSE $3 END
+		WHERE id = $4`, Closed, manager, notes, id); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// QueryList выполняет выборку смен с произвольным условием вместе с итогами
+func QueryList(ctx context.Context, q storage.Querier, where string, args ...interface{}) ([]Shifts, error) {
+	rows, err := q.Query(ctx, selectShiftsQ+" "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shifts []Shifts
+	for rows.Next() {
+		var shift Shifts
+		if err := scanShift(rows, &shift); err != nil {
+			return nil, err
+		}
+		shifts = append(shifts, shift)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range shifts {
+		if err := shifts[i].loadTotals(ctx, q); err != nil {
+			return nil, err
+		}
+	}
+
+	return shifts, nil
+}
+
+func GetByID(db *pgxpool.Pool, id int) (*Shifts, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	shifts, err := QueryList(ctx, db, "WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(shifts) == 0 {
+		return nil, errors.New(data.ShiftNotFound)
+	}
+
+	return &shifts[0], nil
+}
+
+// GetList - смены за период по дате открытия; status не обязателен
+// (например, discrepancy - смены, ждущие подписи менеджера)
+func GetList(db *pgxpool.Pool, status string, from, to pgtype.Date) ([]Shifts, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, date := range []*pgtype.Date{&from, &to} {
+		if date.Status != pgtype.Present {
+			date.Status = pgtype.Null
+		}
+	}
+
+	return QueryList(ctx, db, `WHERE ($1 = '' OR status = $1)
+		AND ($2::date IS NULL OR opened_at >= $2::date)
+		AND ($3::date IS NULL OR opened_at < $3::date + 1)
+		ORDER BY opened_at, id`, status, from, to)
+}
@@ -0,0 +1,392 @@
+package db_stayhours
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_booking "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/booking"
+	db_folio "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/folio"
+	db_property "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/property"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// Request kinds
+	EarlyCheckIn = db_folio.ChargeEarlyCheckIn // Ранний заезд
+	LateCheckOut = db_folio.ChargeLateCheckOut // Поздний выезд
+
+	// Request statuses
+	Pending  = "pending"  // Ждёт решения
+	Approved = "approved" // Одобрен, доплата начислена
+	Rejected = "rejected" // Отклонён
+)
+
+// Fees - ступень тарифа на ранний заезд или поздний выезд:
+// действует, если разница со стандартным временем не больше UpToHours.
+// Доплата = Amount + PercentOfNight% от стоимости ночи
+type Fees struct {
+	Id             int           `json:"id"`
+	Kind           string        `json:"kind"`
+	UpToHours      int           `json:"up_to_hours"`
+	Amount         money.Decimal `json:"amount"`
+	PercentOfNight money.Decimal `json:"percent_of_night"`
+}
+
+// Requests - запрос гостя на ранний заезд или поздний выезд
+type Requests struct {
+	Id            int                `json:"id"`
+	BookingId     int                `json:"booking_id"`
+	Kind          string             `json:"kind"`
+	RequestedTime string             `json:"requested_time"`
+	Fee           money.Decimal      `json:"fee"`
+	Status        string             `json:"status"`
+	Reason        string             `json:"reason"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+}
+
+const selectRequestsQ = "SELECT id, booking_id, kind, requested_time, fee, status, reason, created_at FROM StayTimeRequests"
+
+func scanRequest(row pgx.Row, r *Requests) error {
+	return row.Scan(
+		&r.Id,
+		&r.BookingId,
+		&r.Kind,
+		&r.RequestedTime,
+		&r.Fee,
+		&r.Status,
+		&r.Reason,
+		&r.CreatedAt,
+	)
+}
+
+func validKind(kind string) bool {
+	return kind == EarlyCheckIn || kind == LateCheckOut
+}
+
+// SetFee добавляет ступень тарифа или меняет существующую (по виду и числу часов)
+func (f *Fees) SetFee(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if !validKind(f.Kind) || f.UpToHours <= 0 || f.Amount < 0 || f.PercentOfNight < 0 {
+		return errors.New(data.WrongData)
+	}
+
+	setQ := `INSERT INTO StayTimeFees(kind, up_to_hours, amount, percent_of_night) VALUES($1, $2, $3, $4)
+		ON CONFLICT (kind, up_to_hours) DO UPDATE SET amount = EXCLUDED.amount, percent_of_night = EXCLUDED.percent_of_night
+		RETURNING id`
+
+	return db.QueryRow(ctx, setQ, f.Kind, f.UpToHours, f.Amount, f.PercentOfNight).Scan(&f.Id)
+}
+
+func (f *Fees) DeleteFee(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tag, err := db.Exec(ctx, "DELETE FROM StayTimeFees WHERE id = $1", f.Id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New(data.WrongData)
+	}
+
+	return nil
+}
+
+func getFees(ctx context.Context, q storage.Querier) ([]Fees, error) {
+	rows, err := q.Query(ctx, "SELECT id, kind, up_to_hours, amount, percent_of_night FROM StayTimeFees ORDER BY kind, up_to_hours")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fees []Fees
+	for rows.Next() {
+		var fee Fees
+		if err := rows.Scan(&fee.Id, &fee.Kind, &fee.UpToHours, &fee.Amount, &fee.PercentOfNight); err != nil {
+			return nil, err
+		}
+		fees = append(fees, fee)
+	}
+
+	return fees, rows.Err()
+}
+
+func GetFees(db *pgxpool.Pool) ([]Fees, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return getFees(ctx, db)
+}
+
+// clockOffset - смещение времени заезда или выезда от полуночи дня заезда
+// (выезда). Поздний выезд раньше стандартного времени приходится на следующие
+// сутки (после полуночи), ранний заезд позже стандартного - на предыдущие
+func clockOffset(kind, standard, clock string) time.Duration {
+	from, _ := time.Parse("15:04", standard)
+	to, _ := time.Parse("15:04", clock)
+
+	offset := time.Duration(to.Hour())*time.Hour + time.Duration(to.Minute())*time.Minute
+	if kind == LateCheckOut && to.Before(from) {
+		offset += 24 * time.Hour
+	}
+	if kind == EarlyCheckIn && to.After(from) {
+		offset -= 24 * time.Hour
+	}
+	return offset
+}
+
+// Разница в часах (с округлением вверх) между стандартным и запрошенным временем
+func hoursOutside(kind, standard, requested string) int {
+	diff := clockOffset(kind, standard, standard) - clockOffset(kind, standard, requested)
+	if kind == LateCheckOut {
+		diff = -diff
+	}
+
+	return int(math.Ceil(diff.Hours()))
+}
+
+// Подбирает наименьшую подходящую ступень тарифа и считает доплату
+func (r *Requests) calculateFee(ctx context.Context, q storage.Querier, booking *db_booking.Bookings, settings *db_property.Settings) error {
+	standard := settings.CheckInTime
+	if r.Kind == LateCheckOut {
+		standard = settings.CheckOutTime
+	}
+
+	hours := hoursOutside(r.Kind, standard, r.RequestedTime)
+	if hours <= 0 {
+		r.Fee = 0
+		return nil
+	}
+
+	fees, err := getFees(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	nightPrice := booking.TotalPrice.Div(booking.Nights())
+	for _, fee := range fees {
+		if fee.Kind == r.Kind && fee.UpToHours >= hours {
+			r.Fee = fee.Amount + nightPrice.Percent(fee.PercentOfNight)
+			return nil
+		}
+	}
+
+	return errors.New(data.OutsideSchedule)
+}
+
+// checkConflict проверяет соседние брони того же номера: при раннем заезде -
+// гостей, выезжающих в день заезда или накануне, при позднем выезде - гостей,
+// заезжающих в день выезда или на следующий день. Время соседа - записанное
+// в его бронь по одобренному запросу или стандартное; время после полуночи
+// относится к соседним суткам
+func (r *Requests) checkConflict(ctx context.Context, q storage.Querier, booking *db_booking.Bookings, settings *db_property.Settings) error {
+	conflictQ := `SELECT b.check_out_date,
+			COALESCE(CASE WHEN b.check_out_date = bk.check_out_date THEN bk.requested_departure_time END, $4)
+		FROM ` + db_booking.RoomStaysQ + ` b JOIN Bookings bk ON bk.id = b.id
+		WHERE b.room_id = $1 AND b.id <> $2 AND b.check_out_date BETWEEN $3::date - 1 AND $3 AND b.status IN ($5, $6)`
+	day, neighbourKind, neighbourStandard := booking.Checkin, LateCheckOut, settings.CheckOutTime
+	if r.Kind == LateCheckOut {
+		conflictQ = `SELECT b.check_in_date,
+				COALESCE(CASE WHEN b.check_in_date = bk.check_in_date THEN bk.requested_arrival_time END, $4)
+			FROM ` + db_booking.RoomStaysQ + ` b JOIN Bookings bk ON bk.id = b.id
+			WHERE b.room_id = $1 AND b.id <> $2 AND b.check_in_date BETWEEN $3 AND $3::date + 1 AND b.status IN ($5, $6)`
+		day, neighbourKind, neighbourStandard = booking.Checkout, EarlyCheckIn, settings.CheckInTime
+	}
+
+	standard := settings.CheckInTime
+	if r.Kind == LateCheckOut {
+		standard = settings.CheckOutTime
+	}
+	requested := clockOffset(r.Kind, standard, r.RequestedTime)
+
+	rows, err := q.Query(ctx, conflictQ, booking.RoomId, booking.Id, day, neighbourStandard,
+		db_booking.Confirmed, db_booking.CheckedIn)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var date pgtype.Date
+		var clock string
+		if err := rows.Scan(&date, &clock); err != nil {
+			return err
+		}
+		neighbour := date.Time.Sub(day.Time) + clockOffset(neighbourKind, neighbourStandard, clock)
+		if (r.Kind == EarlyCheckIn && neighbour > requested) || (r.Kind == LateCheckOut && neighbour < requested) {
+			return errors.New(data.TimeConflict)
+		}
+	}
+
+	return rows.Err()
+}
+
+// Create регистрирует запрос и рассчитывает доплату по тарифу.
+// На каждую бронь допускается один действующий запрос каждого вида
+func (r *Requests) Create(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if !validKind(r.Kind) {
+		return errors.New(data.WrongData)
+	}
+	clock, err := db_property.NormalizeClock(r.RequestedTime)
+	if err != nil {
+		return err
+	}
+	r.RequestedTime = clock
+
+	booking, err := db_booking.GetByIDTx(ctx, db, r.BookingId)
+	if err != nil {
+		return err
+	}
+	if booking.Status != db_booking.Confirmed && booking.Status != db_booking.CheckedIn {
+		return errors.New(data.BookingNotFound)
+	}
+
+	settings, err := db_property.GetTx(ctx, db, false)
+	if err != nil {
+		return err
+	}
+	if err := r.calculateFee(ctx, db, booking, settings); err != nil {
+		return err
+	}
+
+	var exists int
+	if err := db.QueryRow(ctx, "SELECT count(*) FROM StayTimeRequests WHERE booking_id = $1 AND kind = $2 AND status IN ($3, $4)",
+		r.BookingId, r.Kind, Pending, Approved).Scan(&exists); err != nil {
+		return err
+	}
+	if exists > 0 {
+		return errors.New(data.RequestExists)
+	}
+
+	r.Status = Pending
+	createQ := `INSERT INTO StayTimeRequests(booking_id, kind, requested_time, fee, status, reason)
+		VALUES($1, $2, $3, $4, $5, '') RETURNING id, created_at`
+
+	return db.QueryRow(ctx, createQ, r.BookingId, r.Kind, r.RequestedTime, r.Fee, r.Status).Scan(&r.Id, &r.CreatedAt)
+}
+
+// Approve повторно проверяет соседние брони номера, одобряет запрос,
+// начисляет доплату в счёт гостя и записывает время в бронь
+func (r *Requests) Approve(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := scanRequest(tx.QueryRow(ctx, selectRequestsQ+" WHERE id = $1 AND status = $2 FOR UPDATE", r.Id, Pending), r); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New(data.RequestNotFound)
+		}
+		return err
+	}
+
+	booking, err := db_booking.GetByIDTx(ctx, tx, r.BookingId)
+	if err != nil {
+		return err
+	}
+	// Блокируем номер, чтобы соседние запросы одобрялись по очереди
+	if _, err := tx.Exec(ctx, "SELECT id FROM rooms WHERE id = $1 FOR UPDATE", booking.RoomId); err != nil {
+		return err
+	}
+
+	settings, err := db_property.GetTx(ctx, tx, false)
+	if err != nil {
+		return err
+	}
+	if err := r.checkConflict(ctx, tx, booking, settings); err != nil {
+		return err
+	}
+
+	r.Status = Approved
+	if _, err := tx.Exec(ctx, "UPDATE StayTimeRequests SET status = $1 WHERE id = $2", r.Status, r.Id); err != nil {
+		return err
+	}
+
+	timeColumn, serviceDate, description := "requested_arrival_time", booking.Checkin, "Ранний заезд в "
+	if r.Kind == LateCheckOut {
+		timeColumn, serviceDate, description = "requested_departure_time", booking.Checkout, "Поздний выезд в "
+	}
+	if _, err := tx.Exec(ctx, "UPDATE Bookings SET "+timeColumn+" = $1 WHERE id = $2", r.RequestedTime, booking.Id); err != nil {
+		return err
+	}
+
+	if r.Fee > 0 {
+		folioId, err := db_folio.GetOrCreateTx(ctx, tx, booking.Id)
+		if err != nil {
+			return err
+		}
+		charge := db_folio.Charges{
+			FolioId:     folioId,
+			ChargeType:  r.Kind,
+			Description: fmt.Sprint(description, r.RequestedTime),
+			Amount:      r.Fee,
+			ServiceDate: serviceDate,
+		}
+		if err := charge.PostChargeTx(ctx, tx); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *Requests) Reject(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tag, err := db.Exec(ctx, "UPDATE StayTimeRequests SET status = $1, reason = $2 WHERE id = $3 AND status = $4",
+		Rejected, r.Reason, r.Id, Pending)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New(data.RequestNotFound)
+	}
+	r.Status = Rejected
+
+	return nil
+}
+
+// GetRequests возвращает запросы, все или с заданным статусом
+func GetRequests(db *pgxpool.Pool, status string) ([]Requests, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.Query(ctx, selectRequestsQ+" WHERE $1 = '' OR status = $1 ORDER BY created_at", status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []Requests
+	for rows.Next() {
+		var request Requests
+		if err := scanRequest(rows, &request); err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return requests, nil
+}
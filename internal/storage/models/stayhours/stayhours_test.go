@@ -0,0 +1,55 @@
+package db_stayhours
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHoursOutside(t *testing.T) {
+	tests := []struct {
+		kind      string
+		standard  string
+		requested string
+		want      int
+	}{
+		{kind: EarlyCheckIn, standard: "14:00", requested: "14:00", want: 0},
+		{kind: EarlyCheckIn, standard: "14:00", requested: "10:00", want: 4},
+		{kind: EarlyCheckIn, standard: "14:00", requested: "11:30", want: 3},
+		{kind: EarlyCheckIn, standard: "14:00", requested: "00:00", want: 14},
+		{kind: EarlyCheckIn, standard: "14:00", requested: "23:00", want: 15},
+		{kind: LateCheckOut, standard: "12:00", requested: "12:00", want: 0},
+		{kind: LateCheckOut, standard: "12:00", requested: "15:00", want: 3},
+		{kind: LateCheckOut, standard: "12:00", requested: "18:20", want: 7},
+		{kind: LateCheckOut, standard: "12:00", requested: "23:59", want: 12},
+		{kind: LateCheckOut, standard: "12:00", requested: "00:30", want: 13},
+		{kind: LateCheckOut, standard: "12:00", requested: "02:00", want: 14},
+	}
+
+	for _, tt := range tests {
+		if got := hoursOutside(tt.kind, tt.standard, tt.requested); got != tt.want {
+			t.Errorf("hoursOutside(%s, %s, %s) = %d, want %d", tt.kind, tt.standard, tt.requested, got, tt.want)
+		}
+	}
+}
+
+func TestClockOffset(t *testing.T) {
+	tests := []struct {
+		kind     string
+		standard string
+		clock    string
+		want     time.Duration
+	}{
+		{kind: EarlyCheckIn, standard: "14:00", clock: "14:00", want: 14 * time.Hour},
+		{kind: EarlyCheckIn, standard: "14:00", clock: "09:15", want: 9*time.Hour + 15*time.Minute},
+		{kind: EarlyCheckIn, standard: "14:00", clock: "22:00", want: -2 * time.Hour},
+		{kind: LateCheckOut, standard: "12:00", clock: "12:00", want: 12 * time.Hour},
+		{kind: LateCheckOut, standard: "12:00", clock: "16:00", want: 16 * time.Hour},
+		{kind: LateCheckOut, standard: "12:00", clock: "00:30", want: 24*time.Hour + 30*time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := clockOffset(tt.kind, tt.standard, tt.clock); got != tt.want {
+			t.Errorf("clockOffset(%s, %s, %s) = %s, want %s", tt.kind, tt.standard, tt.clock, got, tt.want)
+		}
+	}
+}
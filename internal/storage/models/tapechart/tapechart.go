@@ -0,0 +1,136 @@
+package db_tapechart
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	db_booking "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/booking"
+	db_holds "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/holds"
+	db_rooms "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/rooms"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// Segment kinds
+	KindBooking = "booking" // Бронь
+	KindHold    = "hold"    // Временное удержание
+	KindBlock   = "block"   // Номер вне эксплуатации
+)
+
+// Segment - непрерывный отрезок занятости номера на шахматке
+type Segment struct {
+	Kind      string      `json:"kind"`
+	Id        int         `json:"id"`
+	Start     pgtype.Date `json:"start"`
+	End       pgtype.Date `json:"end"`
+	ClientId  *int        `json:"client_id,omitempty"`
+	GuestName string      `json:"guest_name"`
+	Status    string      `json:"status"`
+	Notes     string      `json:"notes"`
+}
+
+// RoomRow - строка шахматки: номер и его отрезки по порядку дат
+type RoomRow struct {
+	db_rooms.Rooms
+	Segments []Segment `json:"segments"`
+}
+
+// GetChart строит шахматку номеров на период [from, to).
+// Все данные берутся четырьмя запросами независимо от количества номеров
+func GetChart(db *pgxpool.Pool, from, to pgtype.Date) ([]RoomRow, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rooms, err := db_rooms.QueryList(ctx, db, "ORDER BY room_number")
+	if err != nil {
+		return nil, err
+	}
+
+	chart := make([]RoomRow, len(rooms))
+	index := make(map[int]int, len(rooms))
+	for i, room := range rooms {
+		chart[i] = RoomRow{Rooms: room, Segments: []Segment{}}
+		index[room.Id] = i
+	}
+
+	add := func(roomId int, segment Segment) {
+		if i, ok := index[roomId]; ok {
+			chart[i].Segments = append(chart[i].Segments, segment)
+		}
+	}
+
+	bookingsQ := `SELECT b.room_id, b.id, b.check_in_date, b.check_out_date, b.client_id,
+			COALESCE(c.full_name, ''), b.status, b.notes
+		FROM ` + db_booking.RoomStaysQ + ` b
+		LEFT JOIN Clients c ON c.id = b.client_id
+		WHERE b.status <> ALL($3) AND b.check_in_date < $2 AND b.check_out_date > $1
+		ORDER BY b.room_id, b.check_in_date`
+	if err := collect(ctx, db, add, KindBooking, bookingsQ, from, to, db_booking.InactiveStatuses); err != nil {
+		return nil, err
+	}
+
+	holdsQ := `SELECT h.room_id, h.id, h.check_in_date, h.check_out_date, h.client_id,
+			COALESCE(c.full_name, ''), h.status, h.notes
+		FROM RoomHolds h
+		LEFT JOIN Clients c ON c.id = h.client_id
+		WHERE h.status = $3 AND h.expires_at > now() AND h.check_in_date < $2 AND h.check_out_date > $1
+		ORDER BY h.room_id, h.check_in_date`
+	if err := collect(ctx, db, add, KindHold, holdsQ, from, to, db_holds.Active); err != nil {
+		return nil, err
+	}
+
+	blocks, err := db_rooms.GetBlocks(ctx, db, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, block := range blocks {
+		add(block.RoomId, Segment{
+			Kind:   KindBlock,
+			Id:     block.Id,
+			Start:  block.DateFrom,
+			End:    block.DateTo,
+			Status: KindBlock,
+			Notes:  block.Reason,
+		})
+	}
+
+	// Отрезки приходят из разных запросов, поэтому упорядочиваем их по началу
+	for i := range chart {
+		segments := chart[i].Segments
+		sort.SliceStable(segments, func(a, b int) bool {
+			return segments[a].Start.Time.Before(segments[b].Start.Time)
+		})
+	}
+
+	return chart, nil
+}
+
+func collect(ctx context.Context, db *pgxpool.Pool, add func(int, Segment), kind, query string, args ...interface{}) error {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var roomId int
+		segment := Segment{Kind: kind}
+		if err := rows.Scan(
+			&roomId,
+			&segment.Id,
+			&segment.Start,
+			&segment.End,
+			&segment.ClientId,
+			&segment.GuestName,
+			&segment.Status,
+			&segment.Notes,
+		); err != nil {
+			return err
+		}
+		add(roomId, segment)
+	}
+
+	return rows.Err()
+}
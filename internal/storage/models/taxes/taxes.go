@@ -0,0 +1,407 @@
+package db_taxes
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_property "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/property"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// Tax kinds
+	Percentage = "percentage" // Процент от суммы начисления
+	Fixed      = "fixed"      // Фиксированная сумма
+
+	// Bases for fixed taxes
+	PerNight  = "per_night"  // За ночь (за каждое начисление проживания)
+	PerPerson = "per_person" // За гостя за ночь
+	PerStay   = "per_stay"   // Один раз за проживание (с первой ночи)
+
+	// roomCharge совпадает с db_folio.ChargeRoom: фиксированные налоги
+	// за ночь, гостя и проживание считаются только с проживания
+	roomCharge = "room"
+)
+
+// Taxes - налог или сбор. Включённый в цену (Inclusive) выделяется из суммы
+// начисления, невключённый начисляется сверху отдельной строкой.
+// Гости категорий из ExemptCategories освобождаются от налога
+type Taxes struct {
+	Id               int           `json:"id"`
+	Name             string        `json:"name"`
+	Kind             string        `json:"kind"`
+	Rate             money.Decimal `json:"rate"`
+	Basis            string        `json:"basis"`
+	Inclusive        bool          `json:"inclusive"`
+	AppliesTo        []string      `json:"applies_to"`
+	EffectiveFrom    pgtype.Date   `json:"effective_from"`
+	EffectiveTo      pgtype.Date   `json:"effective_to"`
+	ExemptCategories []string      `json:"exempt_categories"`
+}
+
+// Lines - рассчитанная сумма налога
+type Lines struct {
+	TaxId     int           `json:"tax_id"`
+	Name      string        `json:"name"`
+	Amount    money.Decimal `json:"amount"`
+	Inclusive bool          `json:"inclusive"`
+}
+
+// Stay - данные брони, от которых зависит расчёт
+type Stay struct {
+	Guests       int
+	ExemptGuests map[string]int
+	Checkin      pgtype.Date
+}
+
+const selectTaxesQ = `SELECT id, name, kind, rate, basis, inclusive, applies_to, effective_from, effective_to,
+	COALESCE(exempt_categories, '{}') FROM Taxes`
+
+func scanTax(row pgx.Row, t *Taxes) error {
+	return row.Scan(
+		&t.Id,
+		&t.Name,
+		&t.Kind,
+		&t.Rate,
+		&t.Basis,
+		&t.Inclusive,
+		&t.AppliesTo,
+		&t.EffectiveFrom,
+		&t.EffectiveTo,
+		&t.ExemptCategories,
+	)
+}
+
+func (t *Taxes) validate() error {
+	if t.Name == "" || t.Rate <= 0 || len(t.AppliesTo) == 0 {
+		return errors.New(data.WrongData)
+	}
+	switch t.Kind {
+	case Percentage:
+		t.Basis = ""
+	case Fixed:
+		if t.Basis != PerNight && t.Basis != PerPerson && t.Basis != PerStay {
+			return errors.New(data.WrongData)
+		}
+	default:
+		return errors.New(data.WrongData)
+	}
+	if t.EffectiveFrom.Status == pgtype.Present && t.EffectiveTo.Status == pgtype.Present &&
+		t.EffectiveTo.Time.Before(t.EffectiveFrom.Time) {
+		return errors.New(data.WrongDates)
+	}
+	if t.EffectiveFrom.Status != pgtype.Present {
+		t.EffectiveFrom.Status = pgtype.Null
+	}
+	if t.EffectiveTo.Status != pgtype.Present {
+		t.EffectiveTo.Status = pgtype.Null
+	}
+	if t.ExemptCategories == nil {
+		t.ExemptCategories = []string{}
+	}
+	return nil
+}
+
+func (t *Taxes) Create(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := t.validate(); err != nil {
+		return err
+	}
+
+	createQ := `INSERT INTO Taxes(name, kind, rate, basis, inclusive, applies_to, effective_from, effective_to, exempt_categories)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
+
+	return db.QueryRow(ctx, createQ,
+		t.Name, t.Kind, t.Rate, t.Basis, t.Inclusive, t.AppliesTo, t.EffectiveFrom, t.EffectiveTo, t.ExemptCategories,
+	).Scan(&t.Id)
+}
+
+// Edit меняет налог. Уже начисленные суммы не пересчитываются
+func (t *Taxes) Edit(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := t.validate(); err != nil {
+		return err
+	}
+
+	editQ := `UPDATE Taxes SET name = $1, kind = $2, rate = $3, basis = $4, inclusive = $5, applies_to = $6,
+		effective_from = $7, effective_to = $8, exempt_categories = $9 WHERE id = $10`
+
+	tag, err := db.Exec(ctx, editQ,
+		t.Name, t.Kind, t.Rate, t.Basis, t.Inclusive, t.AppliesTo, t.EffectiveFrom, t.EffectiveTo, t.ExemptCategories, t.Id,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New(data.TaxNotFound)
+	}
+
+	return nil
+}
+
+func (t *Taxes) Delete(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tag, err := db.Exec(ctx, "DELETE FROM Taxes WHERE id = $1", t.Id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New(data.TaxNotFound)
+	}
+
+	return nil
+}
+
+func queryTaxes(ctx context.Context, q storage.Querier, where string, args ...interface{}) ([]Taxes, error) {
+	rows, err := q.Query(ctx, selectTaxesQ+" "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var taxes []Taxes
+	for rows.Next() {
+		var tax Taxes
+		if err := scanTax(rows, &tax); err != nil {
+			return nil, err
+		}
+		taxes = append(taxes, tax)
+	}
+
+	return taxes, rows.Err()
+}
+
+func GetList(db *pgxpool.Pool) ([]Taxes, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return queryTaxes(ctx, db, "ORDER BY id")
+}
+
+func (t *Taxes) effectiveOn(date time.Time) bool {
+	if t.EffectiveFrom.Status == pgtype.Present && date.Before(t.EffectiveFrom.Time) {
+		return false
+	}
+	if t.EffectiveTo.Status == pgtype.Present && date.After(t.EffectiveTo.Time) {
+		return false
+	}
+	return true
+}
+
+func (t *Taxes) appliesTo(chargeType string) bool {
+	for _, applies := range t.AppliesTo {
+		if applies == chargeType {
+			return true
+		}
+	}
+	return false
+}
+
+// Число гостей, с которых берётся налог: освобождённые категории не считаются
+func (t *Taxes) taxableGuests(stay Stay) int {
+	guests := stay.Guests
+	for _, category := range t.ExemptCategories {
+		guests -= stay.ExemptGuests[category]
+	}
+	if guests < 0 {
+		return 0
+	}
+	return guests
+}
+
+// Calculate считает налоги по начислению. Возвращает сумму начисления без
+// включённых в цену налогов и строки налогов (и включённых, и начисляемых сверху).
+// Налог, все гости которого освобождены, не начисляется
+func Calculate(taxes []Taxes, stay Stay, chargeType string, amount money.Decimal, serviceDate time.Time) (money.Decimal, []Lines) {
+	var lines []Lines
+	var fixedInclusive, percentInclusive money.Decimal
+
+	type pending struct {
+		tax    Taxes
+		amount money.Decimal
+	}
+	var fixed, percent []pending
+
+	for _, tax := range taxes {
+		if !tax.appliesTo(chargeType) || !tax.effectiveOn(serviceDate) {
+			continue
+		}
+		guests := tax.taxableGuests(stay)
+		if guests == 0 {
+			continue
+		}
+
+		if tax.Kind == Percentage {
+			percent = append(percent, pending{tax: tax})
+			if tax.Inclusive {
+				percentInclusive += tax.Rate
+			}
+			continue
+		}
+
+		// Фиксированные налоги за ночь, гостя и проживание - только с проживания
+		if chargeType == roomCharge {
+			switch tax.Basis {
+			case PerPerson:
+				fixed = append(fixed, pending{tax, tax.Rate.Mul(guests)})
+			case PerStay:
+				if serviceDate.Equal(stay.Checkin.Time) {
+					fixed = append(fixed, pending{tax, tax.Rate})
+				}
+			default:
+				fixed = append(fixed, pending{tax, tax.Rate})
+			}
+		} else {
+			fixed = append(fixed, pending{tax, tax.Rate})
+		}
+	}
+
+	for _, f := range fixed {
+		if f.tax.Inclusive {
+			// Включённый сбор не может быть больше самого начисления: иначе сумма
+			// без налогов стала бы отрицательной
+			if f.amount > amount-fixedInclusive {
+				f.amount = amount - fixedInclusive
+			}
+			fixedInclusive += f.amount
+		}
+		lines = append(lines, Lines{TaxId: f.tax.Id, Name: f.tax.Name, Amount: f.amount, Inclusive: f.tax.Inclusive})
+	}
+
+	// Включённые фиксированные сборы вычитаются, затем из остатка выделяются проценты
+	net := (amount - fixedInclusive).WithoutPercent(percentInclusive)
+	for _, p := range percent {
+		lines = append(lines, Lines{TaxId: p.tax.Id, Name: p.tax.Name, Amount: net.Percent(p.tax.Rate), Inclusive: p.tax.Inclusive})
+	}
+
+	// Копейки округления включённых налогов остаются в сумме начисления
+	net = amount
+	for _, line := range lines {
+		if line.Inclusive {
+			net -= line.Amount
+		}
+	}
+
+	return net, lines
+}
+
+// stayTx читает из брони состав гостей и освобождения по счёту
+func stayTx(ctx context.Context, q storage.Querier, where string, arg interface{}) (Stay, error) {
+	var stay Stay
+	err := q.QueryRow(ctx, `SELECT b.adults + b.children, COALESCE(b.exempt_guests, '{}'), b.check_in_date
+		FROM Bookings b `+where, arg).Scan(&stay.Guests, &stay.ExemptGuests, &stay.Checkin)
+	return stay, err
+}
+
+// CalculateTx считает налоги по начислению в фолио
+func CalculateTx(ctx context.Context, q storage.Querier, folioId int, chargeType string, amount money.Decimal, serviceDate pgtype.Date) (money.Decimal, []Lines, error) {
+	taxes, err := queryTaxes(ctx, q, "WHERE $1 = ANY(applies_to) ORDER BY id", chargeType)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(taxes) == 0 {
+		return amount, nil, nil
+	}
+
+	stay, err := stayTx(ctx, q, "JOIN Folios f ON f.booking_id = b.id WHERE f.id = $1", folioId)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	net, lines := Calculate(taxes, stay, chargeType, amount, serviceDate.Time)
+	return net, lines, nil
+}
+
+// Breakdown - налоги брони за всё проживание
+type Breakdown struct {
+	BookingId  int           `json:"booking_id"`
+	Currency   string        `json:"currency"`
+	RoomAmount money.Decimal `json:"room_amount"`
+	Net        money.Decimal `json:"net"`
+	Taxes      []Lines       `json:"taxes"`
+	Total      money.Decimal `json:"total"`
+}
+
+// BookingBreakdown рассчитывает налоги по всем ночам брони по её тарифу
+// (с учётом тарифов сегментов при переездах)
+func BookingBreakdown(db *pgxpool.Pool, bookingId int) (*Breakdown, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stay, err := stayTx(ctx, db, "WHERE b.id = $1", bookingId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New(data.BookingNotFound)
+		}
+		return nil, err
+	}
+
+	taxes, err := queryTaxes(ctx, db, "WHERE $1 = ANY(applies_to) ORDER BY id", roomCharge)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(ctx, `SELECT n.night::date,
+			COALESCE(s.nightly_rate, b.total_price / (b.check_out_date - b.check_in_date))
+		FROM Bookings b
+		CROSS JOIN generate_series(b.check_in_date, b.check_out_date - 1, interval '1 day') n(night)
+		LEFT JOIN BookingSegments s ON s.booking_id = b.id AND s.date_from <= n.night AND s.date_to > n.night
+		WHERE b.id = $1 ORDER BY n.night`, bookingId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings, err := db_property.GetTx(ctx, db, false)
+	if err != nil {
+		return nil, err
+	}
+
+	breakdown := Breakdown{BookingId: bookingId, Currency: settings.BaseCurrency}
+	totals := make(map[string]*Lines)
+	for rows.Next() {
+		var night time.Time
+		var price money.Decimal
+		if err := rows.Scan(&night, &price); err != nil {
+			return nil, err
+		}
+
+		net, lines := Calculate(taxes, stay, roomCharge, price, night)
+		breakdown.RoomAmount += price
+		breakdown.Net += net
+		for _, line := range lines {
+			if total, ok := totals[line.Name]; ok {
+				total.Amount += line.Amount
+				continue
+			}
+			copied := line
+			totals[line.Name] = &copied
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	breakdown.Taxes = []Lines{}
+	breakdown.Total = breakdown.Net
+	for _, line := range totals {
+		breakdown.Taxes = append(breakdown.Taxes, *line)
+		breakdown.Total += line.Amount
+	}
+	sort.Slice(breakdown.Taxes, func(a, b int) bool { return breakdown.Taxes[a].TaxId < breakdown.Taxes[b].TaxId })
+
+	return &breakdown, nil
+}
@@ -0,0 +1,132 @@
+package db_taxes
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/jackc/pgtype"
+)
+
+func TestCalculate(t *testing.T) {
+	checkin := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	nextDay := checkin.AddDate(0, 0, 1)
+	stay := Stay{Guests: 2, Checkin: pgtype.Date{Time: checkin, Status: pgtype.Present}}
+
+	vat := Taxes{Id: 1, Name: "НДС", Kind: Percentage, Rate: money.Units(20), Inclusive: true, AppliesTo: []string{"room", "service"}}
+	cityTax := Taxes{Id: 2, Name: "Туристический налог", Kind: Percentage, Rate: money.Units(10), AppliesTo: []string{"room"}}
+	perPerson := Taxes{Id: 3, Name: "Сбор за гостя", Kind: Fixed, Basis: PerPerson, Rate: money.Units(100),
+		AppliesTo: []string{"room"}, ExemptCategories: []string{"child"}}
+	perStay := Taxes{Id: 4, Name: "Сбор за проживание", Kind: Fixed, Basis: PerStay, Rate: money.Units(50), AppliesTo: []string{"room", "service"}}
+	resortFee := Taxes{Id: 5, Name: "Курортный сбор", Kind: Fixed, Basis: PerNight, Rate: money.Units(50), Inclusive: true, AppliesTo: []string{"room"}}
+	expired := Taxes{Id: 6, Name: "Старый сбор", Kind: Fixed, Basis: PerNight, Rate: money.Units(10), AppliesTo: []string{"room"},
+		EffectiveTo: pgtype.Date{Time: checkin.AddDate(0, 0, -1), Status: pgtype.Present}}
+	bigFee := Taxes{Id: 7, Name: "Сбор", Kind: Fixed, Basis: PerNight, Rate: money.Units(300), Inclusive: true, AppliesTo: []string{"room"}}
+
+	tests := []struct {
+		name       string
+		taxes      []Taxes
+		stay       Stay
+		chargeType string
+		amount     money.Decimal
+		date       time.Time
+		wantNet    money.Decimal
+		wantLines  []Lines
+	}{
+		{
+			name: "inclusive percentage", taxes: []Taxes{vat}, stay: stay, chargeType: "room",
+			amount: money.Units(120), date: checkin,
+			wantNet:   money.Units(100),
+			wantLines: []Lines{{TaxId: 1, Name: "НДС", Amount: money.Units(20), Inclusive: true}},
+		},
+		{
+			name: "inclusive percentage rounding stays in net", taxes: []Taxes{vat}, stay: stay, chargeType: "room",
+			amount: money.Units(100), date: checkin,
+			wantNet:   money.Cents(8333),
+			wantLines: []Lines{{TaxId: 1, Name: "НДС", Amount: money.Cents(1667), Inclusive: true}},
+		},
+		{
+			name: "exclusive percentage", taxes: []Taxes{cityTax}, stay: stay, chargeType: "room",
+			amount: money.Units(100), date: checkin,
+			wantNet:   money.Units(100),
+			wantLines: []Lines{{TaxId: 2, Name: "Туристический налог", Amount: money.Units(10)}},
+		},
+		{
+			name: "per person", taxes: []Taxes{perPerson}, stay: stay, chargeType: "room",
+			amount: money.Units(100), date: checkin,
+			wantNet:   money.Units(100),
+			wantLines: []Lines{{TaxId: 3, Name: "Сбор за гостя", Amount: money.Units(200)}},
+		},
+		{
+			name: "per person with exempt guest", taxes: []Taxes{perPerson},
+			stay:       Stay{Guests: 2, ExemptGuests: map[string]int{"child": 1}, Checkin: stay.Checkin},
+			chargeType: "room", amount: money.Units(100), date: checkin,
+			wantNet:   money.Units(100),
+			wantLines: []Lines{{TaxId: 3, Name: "Сбор за гостя", Amount: money.Units(100)}},
+		},
+		{
+			name: "all guests exempt", taxes: []Taxes{perPerson},
+			stay:       Stay{Guests: 1, ExemptGuests: map[string]int{"child": 1}, Checkin: stay.Checkin},
+			chargeType: "room", amount: money.Units(100), date: checkin,
+			wantNet: money.Units(100),
+		},
+		{
+			name: "per stay on first night", taxes: []Taxes{perStay}, stay: stay, chargeType: "room",
+			amount: money.Units(100), date: checkin,
+			wantNet:   money.Units(100),
+			wantLines: []Lines{{TaxId: 4, Name: "Сбор за проживание", Amount: money.Units(50)}},
+		},
+		{
+			name: "per stay on later night", taxes: []Taxes{perStay}, stay: stay, chargeType: "room",
+			amount: money.Units(100), date: nextDay,
+			wantNet: money.Units(100),
+		},
+		{
+			name: "fixed on service charge ignores basis", taxes: []Taxes{perStay}, stay: stay, chargeType: "service",
+			amount: money.Units(100), date: nextDay,
+			wantNet:   money.Units(100),
+			wantLines: []Lines{{TaxId: 4, Name: "Сбор за проживание", Amount: money.Units(50)}},
+		},
+		{
+			name: "not applicable charge type", taxes: []Taxes{cityTax}, stay: stay, chargeType: "minibar",
+			amount: money.Units(100), date: checkin,
+			wantNet: money.Units(100),
+		},
+		{
+			name: "not effective", taxes: []Taxes{expired}, stay: stay, chargeType: "room",
+			amount: money.Units(100), date: checkin,
+			wantNet: money.Units(100),
+		},
+		{
+			name: "inclusive fixed then inclusive percentage", taxes: []Taxes{resortFee, vat}, stay: stay, chargeType: "room",
+			amount: money.Units(170), date: checkin,
+			wantNet: money.Units(100),
+			wantLines: []Lines{
+				{TaxId: 5, Name: "Курортный сбор", Amount: money.Units(50), Inclusive: true},
+				{TaxId: 1, Name: "НДС", Amount: money.Units(20), Inclusive: true},
+			},
+		},
+		{
+			name: "inclusive fixed capped at charge", taxes: []Taxes{bigFee, vat}, stay: stay, chargeType: "room",
+			amount: money.Units(100), date: checkin,
+			wantNet: 0,
+			wantLines: []Lines{
+				{TaxId: 7, Name: "Сбор", Amount: money.Units(100), Inclusive: true},
+				{TaxId: 1, Name: "НДС", Amount: 0, Inclusive: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			net, lines := Calculate(tt.taxes, tt.stay, tt.chargeType, tt.amount, tt.date)
+			if net != tt.wantNet {
+				t.Errorf("net = %s, want %s", net, tt.wantNet)
+			}
+			if !reflect.DeepEqual(lines, tt.wantLines) {
+				t.Errorf("lines = %+v, want %+v", lines, tt.wantLines)
+			}
+		})
+	}
+}
@@ -0,0 +1,432 @@
+package db_vouchers
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/money"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage"
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_folio "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/folio"
+	db_property "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/property"
+	db_shifts "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/shifts"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// Voucher kinds
+	KindAmount = "amount" // Сертификат на сумму, гасится частями
+	KindNight  = "night"  // Одна ночь в номере типа RoomType, гасится целиком
+
+	// Voucher statuses (вычисляются на операционный день)
+	Active   = "active"
+	Redeemed = "redeemed"
+	Expired  = "expired"
+
+	// MethodVoucher - способ оплаты в фолио при погашении сертификата
+	MethodVoucher = "voucher"
+)
+
+// Алфавит без похожих символов (0/O, 1/I/L), чтобы код было легко продиктовать
+const codeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+const codeGroups, codeGroupLength = 3, 4
+
+// Vouchers - подарочный сертификат. Amount - номинал (для сертификата на ночь -
+// цена ночи при продаже), Balance - непогашенный остаток, он же обязательство отеля.
+// Method и ShiftId - оплата сертификата покупателем в открытую смену кассира
+type Vouchers struct {
+	Id          int                `json:"id"`
+	Code        string             `json:"code"`
+	Kind        string             `json:"kind"`
+	RoomType    string             `json:"room_type,omitempty"`
+	Amount      money.Decimal      `json:"amount"`
+	Balance     money.Decimal      `json:"balance"`
+	ExpiresAt   pgtype.Date        `json:"expires_at"`
+	Purchaser   string             `json:"purchaser"`
+	Recipient   string             `json:"recipient"`
+	Method      string             `json:"method,omitempty"`
+	ShiftId     *int               `json:"-"`
+	Status      string             `json:"status"`
+	Redemptions []Redemptions      `json:"redemptions,omitempty"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+}
+
+// Redemptions - погашение сертификата оплатой в фолио
+type Redemptions struct {
+	Id        int                `json:"id"`
+	FolioId   int                `json:"folio_id"`
+	ChargeId  int                `json:"charge_id"`
+	Amount    money.Decimal      `json:"amount"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+// RedeemRequest - погашение сертификата в счёт фолио.
+// Нулевая сумма - весь остаток; гасится не больше долга по фолио.
+// ShiftId - открытая смена кассира, проводящего погашение
+type RedeemRequest struct {
+	Code    string        `json:"code"`
+	FolioId int           `json:"folio_id"`
+	Amount  money.Decimal `json:"amount"`
+	ShiftId *int          `json:"-"`
+}
+
+// Liability - обязательства по сертификатам на операционный день.
+// Остатки просроченных сертификатов показываются отдельно
+type Liability struct {
+	Date        pgtype.Date   `json:"date"`
+	Outstanding money.Decimal `json:"outstanding"`
+	Count       int           `json:"count"`
+	Expired     money.Decimal `json:"expired"`
+	Vouchers    []Vouchers    `json:"vouchers"`
+}
+
+const selectVouchersQ = `SELECT id, code, kind, COALESCE(room_type, ''), amount, balance, expires_at,
+	purchaser, recipient, created_at FROM Vouchers`
+
+func scanVoucher(row pgx.Row, v *Vouchers) error {
+	return row.Scan(
+		&v.Id,
+		&v.Code,
+		&v.Kind,
+		&v.RoomType,
+		&v.Amount,
+		&v.Balance,
+		&v.ExpiresAt,
+		&v.Purchaser,
+		&v.Recipient,
+		&v.CreatedAt,
+	)
+}
+
+func randomCode() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(codeAlphabet)))
+	for i := 0; i < codeGroups*codeGroupLength; i++ {
+		if i > 0 && i%codeGroupLength == 0 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(codeAlphabet[n.Int64()])
+	}
+
+	return b.String(), nil
+}
+
+// NormalizeCode приводит введённый код к виду XXXX-XXXX-XXXX
+func NormalizeCode(code string) string {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if len(code) != codeGroups*codeGroupLength {
+		return code
+	}
+
+	parts := make([]string, 0, codeGroups)
+	for i := 0; i < len(code); i += codeGroupLength {
+		parts = append(parts, code[i:i+codeGroupLength])
+	}
+	return strings.Join(parts, "-")
+}
+
+func (v *Vouchers) setStatus(today time.Time) {
+	switch {
+	case v.Balance <= 0:
+		v.Status = Redeemed
+	case v.ExpiresAt.Status == pgtype.Present && v.ExpiresAt.Time.Before(today):
+		v.Status = Expired
+	default:
+		v.Status = Active
+	}
+}
+
+// Issue продаёт сертификат с уникальным кодом: оплата покупателя проводится
+// в смену кассира, остаток сертификата становится обязательством отеля.
+// Номинал сертификата на ночь по умолчанию - минимальная цена ночи в номерах этого типа
+func (v *Vouchers) Issue(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if v.ShiftId == nil {
+		return errors.New(data.ShiftNotOpen)
+	}
+	if v.Method == "" || v.Method == MethodVoucher {
+		return errors.New(data.WrongData)
+	}
+
+	switch v.Kind {
+	case KindAmount:
+		v.RoomType = ""
+		if v.Amount <= 0 {
+			return errors.New(data.WrongData)
+		}
+	case KindNight:
+		if v.RoomType == "" || v.Amount < 0 {
+			return errors.New(data.WrongData)
+		}
+	default:
+		return errors.New(data.WrongData)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := db_shifts.CheckOpenTx(ctx, tx, *v.ShiftId); err != nil {
+		return err
+	}
+
+	settings, err := db_property.GetTx(ctx, tx, false)
+	if err != nil {
+		return err
+	}
+	if v.ExpiresAt.Status != pgtype.Present {
+		return errors.New(data.WrongData)
+	}
+	if v.ExpiresAt.Time.Before(settings.BusinessDate.Time) {
+		return errors.New(data.WrongDates)
+	}
+
+	if v.Kind == KindNight && v.Amount == 0 {
+		if err := tx.QueryRow(ctx, "SELECT COALESCE(min(price_per_night), 0) FROM rooms WHERE room_type = $1",
+			v.RoomType).Scan(&v.Amount); err != nil {
+			return err
+		}
+		if v.Amount == 0 {
+			return errors.New(data.RoomNotFound)
+		}
+	}
+	v.Balance = v.Amount
+
+	for attempt := 0; attempt < 5; attempt++ {
+		code, err := randomCode()
+		if err != nil {
+			return err
+		}
+
+		// Коллизия кода - конфликт по уникальному индексу, пробуем другой
+		err = tx.QueryRow(ctx, `INSERT INTO Vouchers(code, kind, room_type, amount, balance, expires_at, purchaser, recipient)
+			VALUES($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8)
+			ON CONFLICT (code) DO NOTHING RETURNING id, created_at`,
+			code, v.Kind, v.RoomType, v.Amount, v.Balance, v.ExpiresAt, v.Purchaser, v.Recipient,
+		).Scan(&v.Id, &v.CreatedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, "INSERT INTO VoucherSales(voucher_id, shift_id, method, amount) VALUES($1, $2, $3, $4)",
+			v.Id, *v.ShiftId, v.Method, v.Amount); err != nil {
+			return err
+		}
+
+		v.Code = code
+		v.setStatus(settings.BusinessDate.Time)
+		return tx.Commit(ctx)
+	}
+
+	return errors.New("failed to generate unique voucher code")
+}
+
+func getTx(ctx context.Context, q storage.Querier, code string, forUpdate bool) (*Vouchers, error) {
+	getQ := selectVouchersQ + " WHERE code = $1"
+	if forUpdate {
+		getQ += " FOR UPDATE"
+	}
+
+	var voucher Vouchers
+	if err := scanVoucher(q.QueryRow(ctx, getQ, NormalizeCode(code)), &voucher); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New(data.VoucherNotFound)
+		}
+		return nil, err
+	}
+
+	return &voucher, nil
+}
+
+// Redeem гасит сертификат оплатой в фолио. Сертификат на ночь гасится целиком
+// на цену одной ночи брони, если её номер - того же типа
+func (r *RedeemRequest) Redeem(db *pgxpool.Pool) (*db_folio.Charges, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if r.Amount < 0 {
+		return nil, errors.New(data.WrongData)
+	}
+	if r.ShiftId == nil {
+		return nil, errors.New(data.ShiftNotOpen)
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	voucher, err := getTx(ctx, tx, r.Code, true)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := db_property.GetTx(ctx, tx, false)
+	if err != nil {
+		return nil, err
+	}
+	voucher.setStatus(settings.BusinessDate.Time)
+	if voucher.Status != Active {
+		return nil, errors.New(data.VoucherNotActive)
+	}
+
+	var due, nightPrice money.Decimal
+	var roomType string
+	var nights int
+	if err := tx.QueryRow(ctx, `SELECT
+			(SELECT COALESCE(sum(amount), 0) FROM FolioCharges WHERE folio_id = f.id),
+			r.room_type, b.total_price, b.check_out_date - b.check_in_date
+		FROM Folios f JOIN Bookings b ON b.id = f.booking_id JOIN rooms r ON r.id = b.room_id
+		WHERE f.id = $1`, r.FolioId).Scan(&due, &roomType, &nightPrice, &nights); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New(data.FolioNotFound)
+		}
+		return nil, err
+	}
+
+	// Погашение не больше долга по фолио, иначе переплата по сертификату
+	// осталась бы в фолио и могла быть возвращена деньгами
+	amount := r.Amount
+	if voucher.Kind == KindNight {
+		if roomType != voucher.RoomType || nights <= 0 {
+			return nil, errors.New(data.VoucherNotApplicable)
+		}
+		// Цена ночи - средняя по брони (с учётом договорных цен и скидок)
+		amount = nightPrice.Div(nights)
+		if due < amount {
+			amount = due
+		}
+		if amount <= 0 {
+			return nil, errors.New(data.WrongData)
+		}
+		voucher.Balance = 0
+	} else {
+		if amount > voucher.Balance {
+			return nil, errors.New(data.WrongData)
+		}
+		if amount == 0 {
+			amount = voucher.Balance
+		}
+		if due < amount {
+			amount = due
+		}
+		if amount <= 0 {
+			return nil, errors.New(data.WrongData)
+		}
+		voucher.Balance -= amount
+	}
+
+	payment := db_folio.Charges{
+		FolioId:     r.FolioId,
+		EntryType:   db_folio.EntryPayment,
+		Description: fmt.Sprintf("Подарочный сертификат %s", voucher.Code),
+		Amount:      amount,
+		Method:      MethodVoucher,
+		ShiftId:     r.ShiftId,
+	}
+	if err := payment.PostTx(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE Vouchers SET balance = $1 WHERE id = $2", voucher.Balance, voucher.Id); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, "INSERT INTO VoucherRedemptions(voucher_id, folio_id, charge_id, amount) VALUES($1, $2, $3, $4)",
+		voucher.Id, r.FolioId, payment.Id, -payment.Amount); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &payment, nil
+}
+
+// GetByCode - проверка остатка сертификата вместе с историей погашений
+func GetByCode(db *pgxpool.Pool, code string) (*Vouchers, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	voucher, err := getTx(ctx, db, code, false)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := db_property.GetTx(ctx, db, false)
+	if err != nil {
+		return nil, err
+	}
+	voucher.setStatus(settings.BusinessDate.Time)
+
+	rows, err := db.Query(ctx, `SELECT id, folio_id, charge_id, amount, created_at
+		FROM VoucherRedemptions WHERE voucher_id = $1 ORDER BY id`, voucher.Id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	voucher.Redemptions = []Redemptions{}
+	for rows.Next() {
+		var redemption Redemptions
+		if err := rows.Scan(&redemption.Id, &redemption.FolioId, &redemption.ChargeId, &redemption.Amount, &redemption.CreatedAt); err != nil {
+			return nil, err
+		}
+		voucher.Redemptions = append(voucher.Redemptions, redemption)
+	}
+
+	return voucher, rows.Err()
+}
+
+// LiabilityReport - непогашенные сертификаты на текущий операционный день
+func LiabilityReport(db *pgxpool.Pool) (*Liability, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	settings, err := db_property.GetTx(ctx, db, false)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(ctx, selectVouchersQ+" WHERE balance > 0 ORDER BY expires_at, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &Liability{Date: settings.BusinessDate, Vouchers: []Vouchers{}}
+	for rows.Next() {
+		var voucher Vouchers
+		if err := scanVoucher(rows, &voucher); err != nil {
+			return nil, err
+		}
+		voucher.setStatus(settings.BusinessDate.Time)
+		if voucher.Status == Expired {
+			report.Expired += voucher.Balance
+			continue
+		}
+		report.Outstanding += voucher.Balance
+		report.Count++
+		report.Vouchers = append(report.Vouchers, voucher)
+	}
+
+	return report, rows.Err()
+}
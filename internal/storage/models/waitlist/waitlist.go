@@ -0,0 +1,331 @@
+package db_waitlist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/data"
+	db_booking "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/booking"
+	db_notifications "github.com/ArtemSilin1/HotelCrm-HTTP/internal/storage/models/notifications"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// Waitlist statuses
+	Waiting   = "waiting"   // Ждёт освобождения номера
+	Matched   = "matched"   // Найден свободный номер, нужно предложить гостю
+	Booked    = "booked"    // Гость забронировал
+	Cancelled = "cancelled" // Запрос снят
+	Expired   = "expired"   // Дата заезда прошла, номер не нашёлся или не был забронирован
+)
+
+// Waitlist - запрос гостя на даты, когда свободных номеров не было
+type Waitlist struct {
+	Id            int                `json:"id"`
+	ClientId      int                `json:"client_id"`
+	Checkin       pgtype.Date        `json:"check_in_data"`
+	Checkout      pgtype.Date        `json:"check_out_data"`
+	RoomType      string             `json:"room_type"`
+	GuestsCount   int                `json:"guests_count"`
+	Priority      int                `json:"priority"`
+	Notes         string             `json:"notes"`
+	Status        string             `json:"status"`
+	MatchedRoomId *int               `json:"matched_room_id,omitempty"`
+	BookingId     *int               `json:"booking_id,omitempty"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+}
+
+const selectWaitlistQ = `SELECT id, client_id, check_in_date, check_out_date, room_type, guests_count,
+	priority, notes, status, matched_room_id, booking_id, created_at FROM Waitlist`
+
+func scanWaitlist(row pgx.Row, w *Waitlist) error {
+	return row.Scan(
+		&w.Id,
+		&w.ClientId,
+		&w.Checkin,
+		&w.Checkout,
+		&w.RoomType,
+		&w.GuestsCount,
+		&w.Priority,
+		&w.Notes,
+		&w.Status,
+		&w.MatchedRoomId,
+		&w.BookingId,
+		&w.CreatedAt,
+	)
+}
+
+func (w *Waitlist) AddEntry(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if w.Checkin.Status != pgtype.Present || w.Checkout.Status != pgtype.Present {
+		return errors.New(data.WrongData)
+	}
+	if !w.Checkout.Time.After(w.Checkin.Time) {
+		return errors.New(data.WrongDates)
+	}
+
+	w.Status = Waiting
+	addQ := `INSERT INTO Waitlist(client_id, check_in_date, check_out_date, room_type, guests_count, priority, notes, status)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at`
+
+	return db.QueryRow(ctx, addQ,
+		w.ClientId, w.Checkin, w.Checkout, w.RoomType, w.GuestsCount, w.Priority, w.Notes, w.Status,
+	).Scan(&w.Id, &w.CreatedAt)
+}
+
+func (w *Waitlist) Cancel(db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cancelQ := "UPDATE Waitlist SET status = $1 WHERE id = $2 AND status IN ($3, $4)"
+
+	tag, err := db.Exec(ctx, cancelQ, Cancelled, w.Id, Waiting, Matched)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New(data.WaitlistNotFound)
+	}
+
+	return nil
+}
+
+// Book бронирует найденный для запроса номер
+func (w *Waitlist) Book(db *pgxpool.Pool, booking *db_booking.Bookings) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := scanWaitlist(tx.QueryRow(ctx, selectWaitlistQ+" WHERE id = $1 AND status = $2 FOR UPDATE", w.Id, Matched), w); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New(data.WaitlistNotFound)
+		}
+		return err
+	}
+
+	booking.ClientId = w.ClientId
+	booking.RoomId = *w.MatchedRoomId
+	booking.Checkin = w.Checkin
+	booking.Checkout = w.Checkout
+	if booking.Adults == 0 && booking.Children == 0 {
+		booking.Adults = w.GuestsCount
+	}
+	if booking.Notes == "" {
+		booking.Notes = w.Notes
+	}
+	if err := booking.CreateTx(ctx, tx); err != nil {
+		return err
+	}
+
+	w.Status = Booked
+	w.BookingId = &booking.Id
+	if _, err := tx.Exec(ctx, "UPDATE Waitlist SET status = $1, booking_id = $2 WHERE id = $3", w.Status, w.BookingId, w.Id); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (w *Waitlist) GetList(db *pgxpool.Pool, status string) ([]Waitlist, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.Query(ctx, selectWaitlistQ+" WHERE $1 = '' OR status = $1 ORDER BY priority DESC, created_at", status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Waitlist
+	for rows.Next() {
+		var entry Waitlist
+		if err := scanWaitlist(rows, &entry); err != nil {
+			return nil, err
+		}
+		list = append(list, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+type period struct {
+	roomId            int
+	checkin, checkout time.Time
+}
+
+// expireStale снимает устаревшие предложения перед новым подбором: запросы с
+// прошедшей датой заезда истекают, а предложенный номер, который успели занять
+// или заблокировать, освобождается - запрос снова ждёт подбора
+func expireStale(ctx context.Context, db *pgxpool.Pool) error {
+	if _, err := db.Exec(ctx, "UPDATE Waitlist SET status = $1 WHERE status IN ($2, $3) AND check_in_date < current_date",
+		Expired, Waiting, Matched); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(ctx, `UPDATE Waitlist SET status = $1, matched_room_id = NULL
+		WHERE status = $2 AND NOT (`+db_booking.RoomFreeCond("Waitlist.matched_room_id", "Waitlist.check_in_date", "Waitlist.check_out_date", "$3")+`)`,
+		Waiting, Matched, db_booking.InactiveStatuses)
+	return err
+}
+
+// candidate - свободный номер, подходящий к ожидающему запросу
+type candidate struct {
+	entryId    int
+	roomId     int
+	roomNumber int
+}
+
+// MatchFreedInventory проверяет ожидающие запросы на появление свободных номеров
+// (после отмены или изменения броней), помечает найденные и уведомляет персонал.
+// Запускается по расписанию. Запросы обрабатываются по приоритету, один номер
+// не предлагается двум гостям сразу
+func MatchFreedInventory(ctx context.Context, db *pgxpool.Pool) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if err := expireStale(ctx, db); err != nil {
+		return err
+	}
+
+	rows, err := db.Query(ctx,
+		selectWaitlistQ+" WHERE status = $1 ORDER BY priority DESC, created_at, id", Waiting)
+	if err != nil {
+		return err
+	}
+	var entries []Waitlist
+	for rows.Next() {
+		var entry Waitlist
+		if err := scanWaitlist(rows, &entry); err != nil {
+			rows.Close()
+			return err
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	// Свободные номера для всех ожидающих запросов одним запросом
+	rows, err = db.Query(ctx, `SELECT w.id, rooms.id, rooms.room_number FROM Waitlist w
+		JOIN rooms ON (w.room_type = '' OR rooms.room_type = w.room_type)
+			AND (w.guests_count = 0 OR rooms.max_occupancy = 0 OR rooms.max_occupancy >= w.guests_count)
+		WHERE w.status = $1
+		AND `+db_booking.RoomFreeCond("rooms.id", "w.check_in_date", "w.check_out_date", "$2")+`
+		ORDER BY w.id, rooms.room_number`, Waiting, db_booking.InactiveStatuses)
+	if err != nil {
+		return err
+	}
+	candidates := make(map[int][]candidate)
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.entryId, &c.roomId, &c.roomNumber); err != nil {
+			rows.Close()
+			return err
+		}
+		candidates[c.entryId] = append(candidates[c.entryId], c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Номера, уже предложенные другим запросам из листа ожидания
+	offered, err := offeredPeriods(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		for _, room := range candidates[entry.Id] {
+			if overlapsOffered(offered, room.roomId, entry.Checkin.Time, entry.Checkout.Time) {
+				continue
+			}
+
+			if err := entry.markMatched(ctx, db, room.roomId, room.roomNumber); err != nil {
+				return err
+			}
+			offered = append(offered, period{room.roomId, entry.Checkin.Time, entry.Checkout.Time})
+			break
+		}
+	}
+
+	return nil
+}
+func offeredPeriods(ctx context.Context, db *pgxpool.Pool) ([]period, error) {
+	rows, err := db.Query(ctx, "SELECT matched_room_id, check_in_date, check_out_date FROM Waitlist WHERE status = $1", Matched)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var periods []period
+	for rows.Next() {
+		var p period
+		if err := rows.Scan(&p.roomId, &p.checkin, &p.checkout); err != nil {
+			return nil, err
+		}
+		periods = append(periods, p)
+	}
+
+	return periods, rows.Err()
+}
+
+func overlapsOffered(offered []period, roomId int, checkin, checkout time.Time) bool {
+	for _, p := range offered {
+		if p.roomId == roomId && p.checkin.Before(checkout) && p.checkout.After(checkin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Waitlist) markMatched(ctx context.Context, db *pgxpool.Pool, roomId, roomNumber int) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Номер проверяется ещё раз перед уведомлением: его могли занять после подбора
+	tag, err := tx.Exec(ctx, `UPDATE Waitlist SET status = $1, matched_room_id = $2 WHERE id = $3 AND status = $4
+		AND `+db_booking.RoomFreeCond("$2", "Waitlist.check_in_date", "Waitlist.check_out_date", "$5"),
+		Matched, roomId, w.Id, Waiting, db_booking.InactiveStatuses)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	message := fmt.Sprintf("Освободился номер %d на %s - %s для клиента #%d (лист ожидания #%d)",
+		roomNumber,
+		w.Checkin.Time.Format("2006-01-02"),
+		w.Checkout.Time.Format("2006-01-02"),
+		w.ClientId,
+		w.Id,
+	)
+	if err := db_notifications.Notify(ctx, tx, "Лист ожидания", message); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -7,6 +7,8 @@ import (
 
 	"github.com/ArtemSilin1/HotelCrm-HTTP/internal/config"
 
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
@@ -29,3 +31,11 @@ func (d *DatabaseClient) OpenDBClient(ctx context.Context, config config.Storage
 	log.Println("\033[32mПодключено к бд\033[0m")
 	return pool, nil
 }
+
+// Querier - общий интерфейс для пула и транзакции,
+// чтобы модели могли выполнять запросы как отдельно, так и внутри tx
+type Querier interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}